@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+// etag returns a strong entity tag for a resource at the given version. Our
+// resources are versioned for optimistic locking, so the version is all that
+// is needed to tell two versions of the same resource apart. Representations
+// in other formats than the default are told apart by a variant appended to
+// the version by writeResponse, such as "3-xml". See encoding.etag. Movies
+// also depend on their ratings and language, and lists on their movies, so
+// they have their own tags. See movieETag and listETag.
+func etag(version int32) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// movieETag returns the entity tag of a movie. A movie's rating isn't covered
+// by its version, and its score changes with every rating of any movie, so if
+// the movie has a rating, a variant made from a hash of it is appended to the
+// version. If the movie was localized, the tag of its translation is appended
+// too, so that each language has its own tag, such as "3-r5f2c9a1b-es-MX".
+// Translations are covered by the version. Only the version is compared by
+// preconditionsMet, so neither makes an If-Match header fail.
+func movieETag(movie *data.Movie) string {
+	tag := strconv.Itoa(int(movie.Version))
+
+	if movie.Rating != nil {
+		h := fnv.New32a()
+		fmt.Fprintf(h, "%d/%g/%g", movie.Rating.Count, movie.Rating.Average, movie.Rating.Score)
+		tag += fmt.Sprintf("-r%08x", h.Sum32())
+	}
+	if movie.Language != "" {
+		tag += "-" + movie.Language
+	}
+
+	return `"` + tag + `"`
+}
+
+// listETag returns the entity tag of a list. A list's version is incremented
+// when its entries change, but not when their movies are renamed, or moved to
+// or restored from the trash, which changes its entry count and the entries
+// that are shown. So a variant made from a hash of the entry count and of
+// each entry's movie ID, title, and year is appended to the version, such as
+// "3-e5f2c9a1b".
+func listETag(list *data.List) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d", list.EntryCount)
+	for _, e := range list.Entries {
+		fmt.Fprintf(h, "/%d:%q:%d", e.MovieID, e.Title, e.Year)
+	}
+	return fmt.Sprintf(`"%d-e%08x"`, list.Version, h.Sum32())
+}
+
+// etagVersion returns the version that an entity tag was made from by etag,
+// without its variant, if it has one. For example, the version of "3-xml" is
+// "3". Tags that aren't quoted have no version.
+func etagVersion(tag string) (string, bool) {
+	if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		return "", false
+	}
+	version, _, _ := strings.Cut(tag[1:len(tag)-1], "-")
+	return version, true
+}
+
+// etagMatches reports whether the entity tag is matched by an If-Match or
+// If-None-Match header value. The header may contain a comma-separated list
+// of entity tags, or "*", which matches any tag.
+//
+// If weak is true, the weak comparison function is used, and a "W/" prefix on
+// either tag is ignored. This is what RFC 9110 specifies for If-None-Match.
+// Otherwise, the strong comparison function is used, and weak tags never
+// match. This is what RFC 9110 specifies for If-Match.
+func etagMatches(header, tag string, weak bool) bool {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == strings.TrimPrefix(tag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The notModified helper returns true if the request's If-None-Match header
+// matches the entity tag of the current representation of the resource, given
+// the tag of its default representation, such as etag(version). In that case
+// a 304 Not Modified response has already been sent, and the caller should
+// return without writing a body.
+func (app *application) notModified(w http.ResponseWriter, r *http.Request, tag string) bool {
+	tag = app.contextGetEncoding(r).etag(tag)
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagMatches(header, tag, true) {
+		return false
+	}
+
+	w.Header().Set("ETag", tag)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// The preconditionsMet helper checks the request's If-Match header against
+// the entity tag of the current version of the resource. It returns true if
+// the request may proceed. Otherwise, an error response has already been sent
+// and the caller should return.
+//
+// Only the version of the tags is compared, so the tag of any representation
+// of the current version matches, whatever format it was fetched in.
+//
+//   - If the header doesn't match, a 412 Precondition Failed is sent.
+//   - If the header is missing and the -require-if-match flag is set, a 428
+//     Precondition Required is sent. Otherwise, the request may proceed.
+func (app *application) preconditionsMet(w http.ResponseWriter, r *http.Request, version int32) bool {
+	header := r.Header.Get("If-Match")
+
+	if header == "" {
+		if app.config.requireIfMatch {
+			app.preconditionRequiredResponse(w, r)
+			return false
+		}
+		return true
+	}
+
+	if !versionMatches(header, version) {
+		app.preconditionFailedResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// versionMatches reports whether an If-Match header value matches the given
+// version. It is like etagMatches with the strong comparison function, but
+// the variants of the tags in the header are ignored.
+func versionMatches(header string, version int32) bool {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return true
+	}
+
+	want, _ := etagVersion(etag(version))
+
+	for _, candidate := range strings.Split(header, ",") {
+		got, ok := etagVersion(strings.TrimSpace(candidate))
+		if ok && got == want {
+			return true
+		}
+	}
+
+	return false
+}
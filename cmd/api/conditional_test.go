@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/kvnloughead/greenlight/internal/assert"
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		tag    string
+		weak   bool
+		want   bool
+	}{
+		{"Exact match", `"3"`, `"3"`, false, true},
+		{"Mismatch", `"2"`, `"3"`, false, false},
+		{"Wildcard", `*`, `"3"`, false, true},
+		{"List", `"1", "2" ,"3"`, `"3"`, false, true},
+		{"Weak tag, strong comparison", `W/"3"`, `"3"`, false, false},
+		{"Weak tag, weak comparison", `W/"3"`, `"3"`, true, true},
+		{"Unquoted", `3`, `"3"`, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, etagMatches(tt.header, tt.tag, tt.weak), tt.want)
+		})
+	}
+}
+
+func TestVersionMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{"Default representation", `"3"`, true},
+		{"Other representation", `"3-xml"`, true},
+		{"Other version", `"2-xml"`, false},
+		{"Wildcard", `*`, true},
+		{"List", `"1", "3-compact"`, true},
+		{"Rating variant", `"3-r5f2c9a1b-xml"`, true},
+		{"Weak tag", `W/"3"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, versionMatches(tt.header, 3), tt.want)
+		})
+	}
+}
+
+func TestMovieETag(t *testing.T) {
+	movie := &data.Movie{Version: 3}
+	assert.Equal(t, movieETag(movie), `"3"`)
+
+	movie.Rating = &data.MovieRating{Average: 8, Count: 2, Score: 6.5}
+	rated := movieETag(movie)
+	version, _ := etagVersion(rated)
+	assert.Equal(t, version, "3")
+	assert.Equal(t, movieETag(movie), rated)
+
+	// A rating of another movie changes the score, and so the tag.
+	movie.Rating.Score = 6.4
+	assert.Equal(t, movieETag(movie) != rated, true)
+
+	// Each language has its own tag.
+	movie.Rating = nil
+	movie.Localize(data.MovieTranslation{Language: "es", Region: "MX", Title: "Casablanca"})
+	assert.Equal(t, movieETag(movie), `"3-es-MX"`)
+	assert.Equal(t, versionMatches(movieETag(movie), 3), true)
+}
+
+func TestListETag(t *testing.T) {
+	list := &data.List{Version: 3, EntryCount: 2, Entries: []data.ListEntry{
+		{MovieID: 1, Title: "Casablanca", Year: 1942},
+		{MovieID: 2, Title: "Vertigo", Year: 1958},
+	}}
+	tag := listETag(list)
+	version, _ := etagVersion(tag)
+	assert.Equal(t, version, "3")
+
+	// Renaming a movie changes the tag.
+	list.Entries[1].Title = "Psycho"
+	renamed := listETag(list)
+	assert.Equal(t, renamed != tag, true)
+
+	// So does moving a movie to the trash, which leaves it out.
+	list.EntryCount, list.Entries = 1, list.Entries[:1]
+	assert.Equal(t, listETag(list) != renamed, true)
+}
@@ -5,12 +5,17 @@ import (
 	"net/http"
 
 	"github.com/kvnloughead/greenlight/internal/data"
+	"github.com/kvnloughead/greenlight/internal/i18n"
 )
 
 // The contextKey type is a custom string type for request context keys.
 type contextKey string
 
-var userContextKey = contextKey("user")
+var (
+	userContextKey      = contextKey("user")
+	requestIDContextKey = contextKey("request_id")
+	localeContextKey    = contextKey("locale")
+)
 
 // The contextSetUser method accepts a request and a user struct as arguments,
 // adds the user to the request's context with a key of "user", and returns a
@@ -32,3 +37,27 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// The contextSetRequestID method adds a request ID to the request's context,
+// and returns a copy of the request.
+func (app *application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// The contextGetRequestID method returns the request's ID, or an empty string
+// if the requestID middleware hasn't set one.
+func (app *application) contextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// The contextGetLocale method returns the locale chosen for the request by the
+// selectLocale middleware, or i18n.DefaultLocale if there isn't one.
+func (app *application) contextGetLocale(r *http.Request) string {
+	locale, ok := r.Context().Value(localeContextKey).(string)
+	if !ok {
+		return i18n.DefaultLocale
+	}
+	return locale
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+// listDiaryEntries handles GET requests to the /v1/users/me/diary endpoint.
+// The authenticated user's diary entries can be filtered by the "year" they
+// were watched in, and by "movie_id". They are sorted by "watched_on" or
+// "created_at", most recent first by default, and paginated by page number,
+// like movies.
+func (app *application) listDiaryEntries(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.DiaryFilter
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.DiaryFilter.Year = app.readQueryInt(qs, "year", 0, v)
+	input.DiaryFilter.MovieID = int64(app.readQueryInt(qs, "movie_id", 0, v))
+	input.Filters.Page = app.readQueryInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readQueryInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readQueryString(qs, "sort", "-watched_on")
+	input.Filters.SortSafelist = []string{"id", "watched_on", "created_at", "-id", "-watched_on", "-created_at"}
+
+	data.ValidateDiaryFilter(v, input.DiaryFilter)
+	data.ValidateFilters(v, input.Filters)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	entries, metadata, err := app.models.Diary.GetAllForUser(user.ID, input.DiaryFilter, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	if link := pageLinkHeader(r, metadata, nil); link != "" {
+		headers.Set("Link", link)
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"entries": entries, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createDiaryEntry handles POST requests to the /v1/users/me/diary endpoint.
+// The request body has the "movie_id" of a movie that isn't in the trash, the
+// "watched_on" date as "YYYY-MM-DD", and optionally "rewatch" and "rating".
+// Request bodies are validated by data.ValidateDiaryEntry.
+func (app *application) createDiaryEntry(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MovieID   int64     `json:"movie_id"`
+		WatchedOn data.Date `json:"watched_on"`
+		Rewatch   bool      `json:"rewatch"`
+		Rating    *int      `json:"rating"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	entry := &data.DiaryEntry{
+		UserID:    app.contextGetUser(r).ID,
+		MovieID:   input.MovieID,
+		WatchedOn: input.WatchedOn,
+		Rewatch:   input.Rewatch,
+		Rating:    input.Rating,
+	}
+
+	v := validator.New()
+	data.ValidateDiaryEntry(v, entry)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(entry.MovieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddErrorCode("movie_id", validator.CodeNotFound, "must refer to an existing movie", "value", entry.MovieID)
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	entry.Title = movie.Title
+	entry.Year = movie.Year
+
+	err = app.models.Diary.Insert(entry)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/users/me/diary/%d", entry.ID))
+	headers.Set("ETag", etag(entry.Version))
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"entry": entry}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showDiaryEntry handles GET requests to the /v1/users/me/diary/:id endpoint.
+// Other users' diary entries aren't found.
+func (app *application) showDiaryEntry(w http.ResponseWriter, r *http.Request) {
+	entry, ok := app.readDiaryEntry(w, r)
+	if !ok {
+		return
+	}
+
+	if app.notModified(w, r, etag(entry.Version)) {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(entry.Version))
+
+	err := app.writeResponse(w, r, http.StatusOK, envelope{"entry": entry}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateDiaryEntry handles PATCH requests to the /v1/users/me/diary/:id
+// endpoint. The "watched_on" date, "rewatch" flag, and "rating" can be
+// changed, and fields that are omitted from the request body are left
+// unchanged. Since an omitted rating can't be told apart from a null one, a
+// rating of 0 removes the entry's rating.
+//
+// If the request has an If-Match header, it must match the ETag of the current
+// version of the entry, or a 412 Precondition Failed is sent.
+func (app *application) updateDiaryEntry(w http.ResponseWriter, r *http.Request) {
+	entry, ok := app.readDiaryEntry(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.preconditionsMet(w, r, entry.Version) {
+		return
+	}
+
+	var input struct {
+		WatchedOn *data.Date `json:"watched_on"`
+		Rewatch   *bool      `json:"rewatch"`
+		Rating    *int       `json:"rating"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.WatchedOn != nil {
+		entry.WatchedOn = *input.WatchedOn
+	}
+	if input.Rewatch != nil {
+		entry.Rewatch = *input.Rewatch
+	}
+	if input.Rating != nil {
+		entry.Rating = input.Rating
+		if *input.Rating == 0 {
+			entry.Rating = nil
+		}
+	}
+
+	v := validator.New()
+	data.ValidateDiaryEntry(v, entry)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Diary.Update(entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(entry.Version))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"entry": entry}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteDiaryEntry handles DELETE requests to the /v1/users/me/diary/:id
+// endpoint. The entry is deleted permanently.
+func (app *application) deleteDiaryEntry(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Diary.Delete(app.contextGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "diary entry successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showUserStats handles GET requests to the /v1/users/me/stats endpoint. The
+// response has the statistics of the authenticated user's diary for the
+// "year" query parameter, which defaults to the current year. See
+// data.DiaryStats for the statistics.
+func (app *application) showUserStats(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	year := app.readQueryInt(qs, "year", time.Now().Year(), v)
+
+	data.ValidateDiaryFilter(v, data.DiaryFilter{Year: year})
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	stats, err := app.models.Diary.Stats(app.contextGetUser(r).ID, year)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readDiaryEntry fetches the authenticated user's diary entry with the ID in
+// the request's URL. If there is no such entry, or the fetch fails, an error
+// response is sent, and ok is false.
+func (app *application) readDiaryEntry(w http.ResponseWriter, r *http.Request) (entry *data.DiaryEntry, ok bool) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	entry, err = app.models.Diary.Get(app.contextGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return entry, true
+}
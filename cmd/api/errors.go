@@ -3,30 +3,42 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/i18n"
 )
 
-// logError logs an error message, as well as the request method and URL.
+// logError logs an error message, as well as the request method, URL and ID.
 func (app *application) logError(r *http.Request, errMsg string) {
 	var (
 		method = r.Method
 		uri    = r.URL.RequestURI() // returns /path?query from the request URL
+		id     = app.contextGetRequestID(r)
 	)
 
-	app.logger.Error(errMsg, "method", method, "uri", uri)
+	app.logger.Error(errMsg, "method", method, "uri", uri, "request_id", id)
 }
 
 // The errorResponse helper sends arbitrary, JSON formatted errors to the
-// client. It accepts a status code and a message of any type, wrapping the
-// message in a JSON object with key "error". The result is sent using
-// app.writeJSON.
+// client. It accepts a status code, a problem type, and a message of any type,
+// wrapping the message in a JSON object with key "error". The result is sent
+// using app.writeResponse, so it is encoded in the format the client asked for.
+//
+// If the client asks for application/problem+json, or the -problem-details flag
+// is set, an RFC 9457 problem details object is sent instead. See
+// app.problemDetails for its members. Problem details encoded as JSON have a
+// Content-Type of application/problem+json.
 //
-// If app.writeJSON encounters an error, the function logs the error and sends
+// If app.writeResponse encounters an error, the function logs the error and sends
 // a blank response with a 500 status code.
 //
-// Error message are also logged to the terminal via app.logError().
-func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
-	env := envelope{"error": message}
-
+// Messages of type i18n.Message are translated into the locale chosen by the
+// selectLocale middleware. Other messages are sent as they are.
+//
+// Error message are also logged to the terminal via app.logError(), in English.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, pt problemType, message any) {
 	// Log the error.
 	switch msg := message.(type) {
 	case error:
@@ -37,7 +49,23 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 		app.logError(r, fmt.Sprintf("%v", msg))
 	}
 
-	err := app.writeJSON(w, status, env, nil)
+	locale := app.contextGetLocale(r)
+	if msg, ok := message.(i18n.Message); ok {
+		message = msg.In(locale)
+	}
+	w.Header().Set("Content-Language", locale)
+
+	env := envelope{"error": message}
+
+	var headers http.Header
+	if app.wantProblem(r) {
+		env = app.problemDetails(r, status, pt, message)
+		if app.contextGetEncoding(r).mediaType == mediaTypeJSON {
+			headers = http.Header{"Content-Type": {mediaTypeProblemJSON}}
+		}
+	}
+
+	err := app.writeResponse(w, r, status, env, headers)
 	if err != nil {
 		app.logError(r, err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
@@ -50,56 +78,154 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logError(r, err.Error())
 
-	msg := "the server encountered a problem and couldn't process your request"
-	app.errorResponse(w, r, http.StatusInternalServerError, msg)
+	msg := i18n.NewMessage(problemServerError.key(), "the server encountered a problem and couldn't process your request")
+	app.errorResponse(w, r, http.StatusInternalServerError, problemServerError, msg)
 }
 
 // notFoundResponse sends JSON response with a 404 status code, and logs it
 // using app.errorResponse().
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
-	msg := "the requested resource cannot be found"
-	app.errorResponse(w, r, http.StatusNotFound, msg)
+	msg := i18n.NewMessage(problemNotFound.key(), "the requested resource cannot be found")
+	app.errorResponse(w, r, http.StatusNotFound, problemNotFound, msg)
 }
 
 // methodNotAllowedResponse sends a JSON response with a 405 status code, and
 // logs it using app.errorResponse().
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
-	msg := fmt.Sprintf("the %s method is not allowed for this resource", r.Method)
-	app.errorResponse(w, r, http.StatusMethodNotAllowed, msg)
+	msg := i18n.NewMessage(problemMethodNotAllowed.key(),
+		fmt.Sprintf("the %s method is not allowed for this resource", r.Method),
+		"method", r.Method)
+	app.errorResponse(w, r, http.StatusMethodNotAllowed, problemMethodNotAllowed, msg)
 }
 
 // badRequestResponse sends a JSON response with a 400 status code, and logs it
 // using app.errorResponse(). It accepts an error argument and includes it in the
 // response.
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+	app.errorResponse(w, r, http.StatusBadRequest, problemBadRequest, err.Error())
+}
+
+// failedValidationResponse sends a JSON response with a 422 status code, and logs it using app.errorResponse(). It accepts a validator and sends its errors in the response.
+//
+// By default, the errors are a map of each invalid field to its first message.
+// Clients that send a "Prefer: errors=detailed" header receive every error for
+// each field instead, with its code and params, as in validator.FieldError.
+// Messages are translated by their codes. See translateFieldError.
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator) {
+	w.Header().Add("Vary", "Prefer")
+
+	locale := app.contextGetLocale(r)
+	v.Translate(func(e validator.FieldError) string {
+		return translateFieldError(locale, e)
+	})
+
+	var errors any = v.Errors
+	if preference(r, "errors") == "detailed" {
+		w.Header().Set("Preference-Applied", "errors=detailed")
+		errors = v.Details
+	}
+
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, problemValidation, errors)
 }
 
-// failedValidationResponse sends a JSON response with a 422 status code, and logs it using app.errorResponse(). It accepts a map of errors and their messages and sends them in the response.
-func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+// translateFieldError returns the message of a validation error in a locale, or
+// an empty string if there isn't a translation. Messages are looked up by the
+// key "validation.<code>.<params>", with the error's param names in
+// alphabetical order, and then by "validation.<code>". For example, an
+// out_of_range error with a "min" param has the key
+// "validation.out_of_range.min".
+//
+// Errors with the invalid code aren't looked up by "validation.invalid",
+// since their messages say what is wrong, such as "must be a two letter ISO
+// 3166-1 country code", and a generic translation would lose that. They keep
+// their English message unless their code and params have a translation. For
+// the same reason, the catalogues have no generic translations of the
+// invalid_format code, or of the not_permitted code without params.
+func translateFieldError(locale string, e validator.FieldError) string {
+	names := make([]string, 0, len(e.Params))
+	for name := range e.Params {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var keys []string
+	if e.Code != validator.CodeInvalid {
+		keys = append(keys, "validation."+e.Code)
+	}
+	if len(names) > 0 {
+		keys = append([]string{"validation." + e.Code + "." + strings.Join(names, ".")}, keys...)
+	}
+
+	for _, key := range keys {
+		if msg, ok := i18n.Translate(locale, key, "", e.Params); ok {
+			return msg
+		}
+	}
+	return ""
+}
+
+// unsupportedMediaTypeResponse sends a JSON response with a 415 status code.
+// It is sent when a request's body is in an unsupported format. For PATCH
+// requests, the Accept-Patch header lists the supported formats.
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPatch {
+		w.Header().Set("Accept-Patch", strings.Join([]string{
+			mediaTypeJSON, mediaTypeXML, mediaTypeMsgpack, mediaTypeMergePatch, mediaTypeJSONPatch,
+		}, ", "))
+	}
+	mediaType := r.Header.Get("Content-Type")
+	msg := i18n.NewMessage(problemUnsupportedMediaType.key(),
+		fmt.Sprintf("the %q media type is not supported for this resource", mediaType),
+		"media_type", mediaType)
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, problemUnsupportedMediaType, msg)
+}
+
+// notAcceptableResponse sends a JSON response with a 406 status code. It is
+// sent when none of the media types in a request's Accept header are
+// supported, and lists the types that are.
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+	msg := i18n.NewMessage(problemNotAcceptable.key(),
+		fmt.Sprintf("the requested media type is not available, use one of %s", strings.Join(responseMediaTypes, ", ")),
+		"types", responseMediaTypes)
+	app.errorResponse(w, r, http.StatusNotAcceptable, problemNotAcceptable, msg)
 }
 
 // editConflictResponse sends a JSON response with a 409 status code and a
 // message that indicates a conflict while attempting to edit a resource. It
 // also and logs the error using app.errorResponse().
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
-	msg := "unable to update the record due to an edit conflict, please try again"
-	app.errorResponse(w, r, http.StatusConflict, msg)
+	msg := i18n.NewMessage(problemEditConflict.key(), "unable to update the record due to an edit conflict, please try again")
+	app.errorResponse(w, r, http.StatusConflict, problemEditConflict, msg)
+}
+
+// preconditionFailedResponse sends a JSON response with a 412 status code. It
+// is sent when a request's If-Match header doesn't match the current version
+// of the resource.
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	msg := i18n.NewMessage(problemPreconditionFailed.key(), "the resource has been modified since it was retrieved, please fetch it and try again")
+	app.errorResponse(w, r, http.StatusPreconditionFailed, problemPreconditionFailed, msg)
+}
+
+// preconditionRequiredResponse sends a JSON response with a 428 status code.
+// It is sent when a request that modifies a resource is missing an If-Match
+// header, and the -require-if-match flag is set.
+func (app *application) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	msg := i18n.NewMessage(problemPreconditionRequired.key(), "this request must include an If-Match header")
+	app.errorResponse(w, r, http.StatusPreconditionRequired, problemPreconditionRequired, msg)
 }
 
 // rateLimitExceededReponse sends a JSON response with a 429 status code and a
 // message that indicates that the rate limit has been exceeded.
 func (app *application) rateLimitExceededReponse(w http.ResponseWriter, r *http.Request) {
-	msg := "rate limit exceeded"
-	app.errorResponse(w, r, http.StatusTooManyRequests, msg)
+	msg := i18n.NewMessage(problemRateLimitExceeded.key(), "rate limit exceeded")
+	app.errorResponse(w, r, http.StatusTooManyRequests, problemRateLimitExceeded, msg)
 }
 
 // notFoundResponse sends JSON response with a 404 status code, and logs it
 // using app.errorResponse().
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
-	msg := "invalid authentication credentials"
-	app.errorResponse(w, r, http.StatusUnauthorized, msg)
+	msg := i18n.NewMessage(problemInvalidCredentials.key(), "invalid authentication credentials")
+	app.errorResponse(w, r, http.StatusUnauthorized, problemInvalidCredentials, msg)
 }
 
 // The invalidAuthenicationTokenResponse helper sends JSON response with a 401
@@ -112,28 +238,35 @@ func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *htt
 // missing or malformed.
 func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("WWW-Authenticate", "Bearer")
-	msg := "invalid authentication token"
-	app.errorResponse(w, r, http.StatusUnauthorized, msg)
+	msg := i18n.NewMessage(problemInvalidToken.key(), "invalid authentication token")
+	app.errorResponse(w, r, http.StatusUnauthorized, problemInvalidToken, msg)
 }
 
 // An authenticationRequiredResponse is sent with a 401 status code when an
 // unauthenticated user attempts to access a resource that requires
 // authentication.
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
-	msg := "you must be authenticated to access this resource"
-	app.errorResponse(w, r, http.StatusUnauthorized, msg)
+	msg := i18n.NewMessage(problemAuthenticationRequired.key(), "you must be authenticated to access this resource")
+	app.errorResponse(w, r, http.StatusUnauthorized, problemAuthenticationRequired, msg)
 }
 
 // An activationRequiredResponse is sent with a 403 status code when an
 // unactivated user attempts to access a resource that requires activation.
 func (app *application) activationRequiredResponse(w http.ResponseWriter, r *http.Request) {
-	msg := "your user account must be activated to access this resource"
-	app.errorResponse(w, r, http.StatusForbidden, msg)
+	msg := i18n.NewMessage(problemActivationRequired.key(), "your user account must be activated to access this resource")
+	app.errorResponse(w, r, http.StatusForbidden, problemActivationRequired, msg)
 }
 
 // An permissionRequiredResponse is sent with a 403 status code when a user
 // attempts to access a resource that they don't have permission to access.
 func (app *application) permissionRequiredResponse(w http.ResponseWriter, r *http.Request) {
-	msg := "your user account doesn't have the necessary permissions to access this resource"
-	app.errorResponse(w, r, http.StatusForbidden, msg)
+	msg := i18n.NewMessage(problemPermissionRequired.key(), "your user account doesn't have the necessary permissions to access this resource")
+	app.errorResponse(w, r, http.StatusForbidden, problemPermissionRequired, msg)
+}
+
+// A notOwnerResponse is sent with a 403 status code when a user attempts to
+// change a resource that belongs to another user, such as their review.
+func (app *application) notOwnerResponse(w http.ResponseWriter, r *http.Request) {
+	msg := i18n.NewMessage(problemNotOwner.key(), "you can only change resources that belong to you")
+	app.errorResponse(w, r, http.StatusForbidden, problemNotOwner, msg)
 }
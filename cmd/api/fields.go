@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+)
+
+// wantFields returns the sparse fieldset requested with the "fields" query
+// parameter, as a slice of field names. It returns nil if every field should
+// be included. The fields should have been validated by app.validateFields.
+func (app *application) wantFields(r *http.Request) []string {
+	var fields []string
+	for _, field := range app.readQueryCSV(r.URL.Query(), "fields", nil) {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// The validateFields middleware checks the fields requested with the "fields"
+// query parameter against the safelist, and sends a 422 response if any of
+// them aren't permitted. Like requirePermission, it wraps individual routes.
+func (app *application) validateFields(safelist []string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := validator.New()
+		for i, field := range app.wantFields(r) {
+			v.CheckCode(validator.PermittedValue(field, safelist...), validator.Path("fields", i),
+				validator.CodeNotPermitted, "must only contain "+strings.Join(safelist, ", "), "permitted", safelist)
+		}
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// sparse marshals v, which must encode as a JSON object, keeping only the
+// members named in fields, in their original order. Members whose names begin
+// with an underscore, such as _links, are always kept. If fields is empty,
+// every member is kept.
+func sparse(v any, fields []string) ([]byte, error) {
+	js, err := json.Marshal(v)
+	if err != nil || len(fields) == 0 {
+		return js, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+
+	// Read the opening brace of the object.
+	_, err = dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	kept := 0
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+
+		var value json.RawMessage
+		err = dec.Decode(&value)
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.HasPrefix(key, "_") && !slices.Contains(fields, key) {
+			continue
+		}
+
+		if kept > 0 {
+			buf.WriteByte(',')
+		}
+		kept++
+
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
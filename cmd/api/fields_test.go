@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kvnloughead/greenlight/internal/assert"
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+func TestSparse(t *testing.T) {
+	movie := &data.Movie{ID: 1, Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation"}, Version: 1}
+
+	tests := []struct {
+		name string
+		res  movieResource
+		want string
+	}{
+		{
+			"Every field",
+			movieResource{Movie: movie},
+			`{"id":1,"title":"Moana","year":2016,"runtime":"107 mins","genres":["animation"],"version":1}`,
+		},
+		{
+			"Selected fields keep their order",
+			movieResource{Movie: movie, fields: []string{"year", "id"}},
+			`{"id":1,"year":2016}`,
+		},
+		{
+			"Links are always kept",
+			movieResource{Movie: movie, fields: []string{"title"}, Links: links{"self": {Href: "/v1/movies/1"}}},
+			`{"title":"Moana","_links":{"self":{"href":"/v1/movies/1"}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js, err := json.Marshal(tt.res)
+			assert.IsNil(t, err)
+			assert.Equal(t, string(js), tt.want)
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+// listGenres handles GET requests to the /v1/genres endpoint. Every genre in
+// the taxonomy is listed, sorted by name, with its aliases and the number of
+// movies in it.
+func (app *application) listGenres(w http.ResponseWriter, r *http.Request) {
+	genres, err := app.models.Genres.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"genres": genres}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createGenre handles POST requests to the /v1/genres endpoint. If the slug
+// is omitted, it is derived from the name. Aliases are trimmed and lowercased.
+//
+// Request bodies are validated by data.ValidateGenre. The slug, name, and
+// aliases must not already refer to another genre, or a 422 is sent.
+func (app *application) createGenre(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Slug    string   `json:"slug"`
+		Name    string   `json:"name"`
+		Aliases []string `json:"aliases"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	genre := &data.Genre{
+		Slug:    input.Slug,
+		Name:    strings.TrimSpace(input.Name),
+		Aliases: []string{},
+	}
+	if genre.Slug == "" {
+		genre.Slug = data.Slugify(genre.Name)
+	}
+	for _, alias := range input.Aliases {
+		genre.Aliases = append(genre.Aliases, strings.ToLower(strings.TrimSpace(alias)))
+	}
+
+	v := validator.New()
+	data.ValidateGenre(v, genre)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	_, exists := taxonomy[genre.Slug]
+	v.CheckCode(!exists, "slug", validator.CodeConflict, "a genre with this slug already exists")
+	_, exists = taxonomy.Resolve(genre.Name)
+	v.CheckCode(!exists, "name", validator.CodeConflict, "is already used by another genre")
+	for i, alias := range genre.Aliases {
+		_, exists = taxonomy.Resolve(alias)
+		v.CheckCode(!exists, validator.Path("aliases", i), validator.CodeConflict, "is already used by another genre")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Genres.Insert(genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGenre):
+			v.AddErrorCode("slug", validator.CodeConflict, "a genre with this slug already exists")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"genre": genre}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergeGenres handles POST requests to the /v1/genres/merge endpoint. The
+// request body has a "source" and a "target", which can be slugs, names, or
+// aliases of two different genres. Movies in the source genre are moved to
+// the target, the source's slug, name, and aliases become aliases of the
+// target, and the source is deleted.
+//
+// The response has the merged genre, and the number of movies that were
+// changed. If either genre is deleted by a concurrent merge, a 409 is sent.
+func (app *application) mergeGenres(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Source string `json:"source"`
+		Target string `json:"target"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.CheckCode(input.Source != "", "source", validator.CodeRequired, "must be provided")
+	v.CheckCode(input.Target != "", "target", validator.CodeRequired, "must be provided")
+	source, ok := taxonomy.Resolve(input.Source)
+	v.CheckCode(ok, "source", validator.CodeNotFound, "must be a known genre", "value", input.Source)
+	target, ok := taxonomy.Resolve(input.Target)
+	v.CheckCode(ok, "target", validator.CodeNotFound, "must be a known genre", "value", input.Target)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	v.CheckCode(source != target, "target", validator.CodeConflict, "must be a different genre than the source")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	moviesUpdated, err := app.models.Genres.Merge(source, target)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	genre, err := app.models.Genres.Get(target)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"genre": genre, "movies_updated": moviesUpdated}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -12,6 +14,8 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/data"
+	"github.com/kvnloughead/greenlight/internal/patch"
 )
 
 // envelope is a type used for wrapping JSON responses to ensure a consistent
@@ -26,9 +30,15 @@ type envelope map[string]any
 // readIdParam reads an ID param from the request context and parses it as an
 // int64. If the ID doesn't parse to a positive integer, an error is returned.
 func (app *application) readIdParam(r *http.Request) (int64, error) {
+	return app.readNamedIdParam(r, "id")
+}
+
+// readNamedIdParam is like readIdParam, but it reads the param with the given
+// name, for routes with more than one ID, such as /v1/lists/:id/entries/:movie_id.
+func (app *application) readNamedIdParam(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
 		return 0, errors.New("ID must be a positive integer")
 	}
@@ -55,18 +65,30 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 		w.Header()[k] = v
 	}
 
-	// Add Content-type header and status code. Then write JSON to response, appending a newline for QOL.
-	w.Header().Set("Content-type", "application/json")
+	// Add Content-type header, unless the headers map has one, and status code.
+	// Then write JSON to response, appending a newline for QOL.
+	if headers.Get("Content-Type") == "" {
+		w.Header().Set("Content-type", "application/json")
+	}
 	w.WriteHeader(status)
 	w.Write(append(js, '\n'))
 
 	return nil
 }
 
+// maxBodyBytes is the maximum size of a request body read by app.readJSON and
+// app.readPatch.
+const maxBodyBytes = 1_048_576
+
 // readJSON decodes a requests body to the target destination. If the target destination is not a
 // non-nil pointer, panic will ensue. Only a single JSON value per request is
 // accepted.
 //
+// Bodies in other formats are converted to JSON first, according to their
+// Content-Type header. See app.readBody for the supported formats. If the
+// -strict-content-type flag is set, an errUnsupportedMediaType error is
+// returned for unsupported formats.
+//
 // The following errors are caught and responded to specifically.
 //
 //  1. In most cases, general syntax errors will result in a json.SyntaxError.
@@ -93,10 +115,21 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 // All other errors are returned as-is.
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
 	// Restrict size of request bodyy to 1MB.
-	maxBytes := 1_048_576
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+
+	body, err := app.readBody(r)
+	if err != nil {
+		return err
+	}
 
-	dec := json.NewDecoder(r.Body)
+	return app.decodeJSON(body, dst)
+}
+
+// decodeJSON decodes a single JSON value from the reader to the target
+// destination, translating decoding errors into client-friendly messages. See
+// app.readJSON for details.
+func (app *application) decodeJSON(body io.Reader, dst any) error {
+	dec := json.NewDecoder(body)
 	dec.DisallowUnknownFields()
 
 	err := dec.Decode(dst)
@@ -150,6 +183,78 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	return nil
 }
 
+// Supported media types for PATCH request bodies, in addition to those
+// supported by app.readJSON.
+const (
+	mediaTypeJSON       = "application/json"
+	mediaTypeMergePatch = "application/merge-patch+json"
+	mediaTypeJSONPatch  = "application/json-patch+json"
+)
+
+// errUnsupportedMediaType is returned by app.readJSON and app.readPatch if the
+// request's Content-Type isn't a supported format.
+var errUnsupportedMediaType = errors.New("unsupported media type")
+
+// readPatch reads a patch document from the request body and applies it to
+// the JSON representation of doc. The patched document is then decoded into
+// dst with app.decodeJSON, so the same errors are returned as by app.readJSON.
+//
+// The patch format is chosen by the request's Content-Type header.
+//
+//   - application/merge-patch+json is applied as a JSON Merge Patch (RFC 7396).
+//   - application/json-patch+json is applied as a JSON Patch (RFC 6902).
+//
+// Any other media type results in an errUnsupportedMediaType error.
+func (app *application) readPatch(w http.ResponseWriter, r *http.Request, doc any, dst any) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return errUnsupportedMediaType
+	}
+
+	var apply func(doc, patch []byte) ([]byte, error)
+
+	switch mediaType {
+	case mediaTypeMergePatch:
+		apply = patch.Merge
+	case mediaTypeJSONPatch:
+		apply = patch.Apply
+	default:
+		return errUnsupportedMediaType
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return fmt.Errorf("body must not exceed %d bytes", maxBytesError.Limit)
+		}
+		return err
+	}
+	if len(body) == 0 {
+		return errors.New("request body must not be empty")
+	}
+
+	original, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	patched, err := apply(original, body)
+	if err != nil {
+		switch {
+		case errors.Is(err, patch.ErrInvalidPatch),
+			errors.Is(err, patch.ErrPathNotFound),
+			errors.Is(err, patch.ErrTestFailed):
+			return fmt.Errorf("unable to apply patch: %v", err)
+		default:
+			return errors.New("body contains badly-formed JSON")
+		}
+	}
+
+	return app.decodeJSON(bytes.NewReader(patched), dst)
+}
+
 // readQueryString returns the value of the key in the provided query string
 // map. If the value is an empty string, the default value is returned instead.
 func (app *application) readQueryString(qs url.Values, key string, defaultValue string) string {
@@ -184,13 +289,101 @@ func (app *application) readQueryInt(qs url.Values, key string, defaultValue int
 
 	i, err := strconv.Atoi(s)
 	if err != nil {
-		v.AddError(key, "must be an integer value")
+		v.AddErrorCode(key, validator.CodeInvalidType, "must be an integer value")
 		return defaultValue
 	}
 
 	return i
 }
 
+// readQueryBool reads a boolean valued field from the query string argument.
+// If the field is empty, the default value is returned. If the field can't be
+// converted to a boolean, the default value is returned, and an error is
+// added to the validator instance.
+func (app *application) readQueryBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddErrorCode(key, validator.CodeInvalidType, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// readQueryDate reads a date valued field, in the format YYYY-MM-DD, from the
+// query string argument. If the field is empty, the zero date is returned. If
+// the field can't be parsed, the zero date is returned, and an error is added
+// to the validator instance.
+func (app *application) readQueryDate(qs url.Values, key string, v *validator.Validator) data.Date {
+	s := qs.Get(key)
+
+	if s == "" {
+		return data.Date{}
+	}
+
+	d, err := data.ParseDate(s)
+	if err != nil {
+		v.AddErrorCode(key, validator.CodeInvalidType, "must be a date in the format YYYY-MM-DD")
+		return data.Date{}
+	}
+
+	return d
+}
+
+// readMovieFilter reads the movie filtering parameters from the query string
+// argument into a data.MovieFilter, setting reasonable defaults if any are
+// omitted. Errors are added to the validator instance for values that should
+// be integers or dates, and the filter is then validated by
+// data.ValidateMovieFilter. Countries and certifications are uppercased, so
+// "released_in=us&certification_max=pg-13" is accepted.
+func (app *application) readMovieFilter(qs url.Values, v *validator.Validator) data.MovieFilter {
+	filter := data.MovieFilter{
+		Title:      app.readQueryString(qs, "title", ""),
+		SearchMode: app.readQueryString(qs, "search_mode", "fulltext"),
+		Genres:     app.readQueryCSV(qs, "genres", []string{}),
+		GenresMode: app.readQueryString(qs, "genres_mode", "all"),
+		YearMin:    app.readQueryInt(qs, "year_min", 0, v),
+		YearMax:    app.readQueryInt(qs, "year_max", 0, v),
+		RuntimeMin: app.readQueryInt(qs, "runtime_min", 0, v),
+		RuntimeMax: app.readQueryInt(qs, "runtime_max", 0, v),
+		Person:     app.readQueryInt(qs, "person", 0, v),
+		PersonRole: app.readQueryString(qs, "person_role", ""),
+
+		ReleasedIn:       strings.ToUpper(app.readQueryString(qs, "released_in", "")),
+		ReleasedAfter:    app.readQueryDate(qs, "released_after", v),
+		ReleasedBefore:   app.readQueryDate(qs, "released_before", v),
+		CertificationMax: strings.ToUpper(app.readQueryString(qs, "certification_max", "")),
+	}
+
+	data.ValidateMovieFilter(v, filter)
+	return filter
+}
+
+// readQueryCursor reads a pagination cursor from the query string argument.
+// If the field is absent, nil is returned, and offset pagination should be
+// used. If it is present but empty, a cursor for the first page is returned.
+// If the cursor can't be decoded, nil is returned, and an error is added to
+// the validator instance.
+func (app *application) readQueryCursor(qs url.Values, key string, v *validator.Validator) *data.Cursor {
+	if !qs.Has(key) {
+		return nil
+	}
+
+	cursor, err := data.DecodeCursor(qs.Get(key))
+	if err != nil {
+		v.AddErrorCode(key, validator.CodeInvalidFormat, "must be a cursor returned by a previous request")
+		return nil
+	}
+
+	return cursor
+}
+
 // The background method launches a background goroutine. This goroutine
 // recovers from panics, logging the resulting errors with app.logger, and
 // calls the function argument.
@@ -213,3 +406,45 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+// preference returns the value of a preference in the request's Prefer headers
+// (RFC 7240), or an empty string if it isn't present. Preference names are
+// case-insensitive, and quotes around values are removed. Parameters of the
+// preference are ignored.
+func preference(r *http.Request, name string) string {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			pref, _, _ = strings.Cut(pref, ";")
+			key, value, _ := strings.Cut(pref, "=")
+			if strings.EqualFold(strings.TrimSpace(key), name) {
+				return strings.Trim(strings.TrimSpace(value), `"`)
+			}
+		}
+	}
+	return ""
+}
+
+// readMovie fetches the movie with the ID in the request's URL, for endpoints
+// that act on a movie's related resources, such as its credits. Movies in the
+// trash aren't found. If there is no such movie, or the fetch fails, an error
+// response is sent, and ok is false.
+func (app *application) readMovie(w http.ResponseWriter, r *http.Request) (movie *data.Movie, ok bool) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	movie, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return movie, true
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"time"
+
+	"github.com/kvnloughead/greenlight/internal/suggest"
+)
+
+// The schedulePurge method launches a goroutine that permanently deletes
+// movies that have been in the trash for longer than the configured retention
+// period. The purge runs once every cfg.trash.purgeInterval.
+//
+// If the retention period is not positive, no purges are scheduled. Like the
+// rate limiter's cleanup goroutine, this goroutine isn't tracked by app.wg,
+// since it never completes.
+func (app *application) schedulePurge() {
+	if app.config.trash.retention <= 0 || app.config.trash.purgeInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(app.config.trash.purgeInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			func() {
+				// Recover from panics so that a single failed purge doesn't stop
+				// the schedule or crash the application.
+				defer func() {
+					if err := recover(); err != nil {
+						app.logger.Error("trash purge panicked", "error", err)
+					}
+				}()
+
+				before := time.Now().Add(-app.config.trash.retention)
+				purged, err := app.models.Movies.Purge(before)
+				if err != nil {
+					app.logger.Error(err.Error())
+					return
+				}
+
+				if purged > 0 {
+					app.logger.Info("purged movies from trash", "count", purged)
+				}
+			}()
+		}
+	}()
+}
+
+// The scheduleSuggestRefresh method builds the in-memory suggestion index and
+// launches a goroutine that rebuilds it whenever app.invalidateSuggestions()
+// is called, and once every cfg.suggest.refreshInterval. The periodic rebuild
+// picks up changes made by other instances of the application.
+//
+// If the -suggest-trie flag isn't set, app.suggestions is left nil and
+// suggestions are served from the database. Like schedulePurge, the goroutine
+// isn't tracked by app.wg.
+func (app *application) scheduleSuggestRefresh() {
+	if !app.config.suggest.trie {
+		return
+	}
+
+	app.suggestions = &suggest.Trie{}
+	// The channel is buffered so that requests for a rebuild made while one is
+	// in progress are coalesced into a single further rebuild.
+	app.refreshSuggestions = make(chan struct{}, 1)
+
+	refresh := func() {
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error("suggestion index refresh panicked", "error", err)
+			}
+		}()
+
+		titles, err := app.models.Movies.Titles()
+		if err != nil {
+			app.logger.Error(err.Error())
+			return
+		}
+
+		entries := make([]suggest.Entry, len(titles))
+		for i, t := range titles {
+			entries[i] = suggest.Entry{ID: t.ID, Title: t.Title}
+		}
+		app.suggestions.Load(entries)
+	}
+
+	refresh()
+
+	go func() {
+		var tick <-chan time.Time
+		if app.config.suggest.refreshInterval > 0 {
+			ticker := time.NewTicker(app.config.suggest.refreshInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+			select {
+			case <-tick:
+			case <-app.refreshSuggestions:
+			}
+			refresh()
+		}
+	}()
+}
+
+// The invalidateSuggestions method requests a rebuild of the in-memory
+// suggestion index. It should be called after movies are created, renamed,
+// or moved in or out of the trash. It never blocks, and does nothing if the
+// index is disabled.
+func (app *application) invalidateSuggestions() {
+	if app.refreshSuggestions == nil {
+		return
+	}
+
+	select {
+	case app.refreshSuggestions <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+// link is a hypermedia link in the _links section of a resource. Method is
+// omitted for links that should be followed with GET.
+type link struct {
+	Href   string `json:"href"`
+	Method string `json:"method,omitempty"`
+}
+
+// links maps link relations to links.
+type links map[string]link
+
+// movieResource is the representation of a movie in a response. It is a
+// data.Movie with an optional _links section. If fields is non-empty, only
+// those fields are included.
+type movieResource struct {
+	*data.Movie
+	Links  links `json:"_links,omitempty"`
+	fields []string
+}
+
+func (res movieResource) MarshalJSON() ([]byte, error) {
+	// The conversion drops the MarshalJSON method, to avoid infinite recursion.
+	type resource movieResource
+	return sparse(resource(res), res.fields)
+}
+
+// userResource is the representation of a user in a response. It is a
+// data.User with an optional _links section. If fields is non-empty, only
+// those fields are included.
+type userResource struct {
+	*data.User
+	Links  links `json:"_links,omitempty"`
+	fields []string
+}
+
+func (res userResource) MarshalJSON() ([]byte, error) {
+	type resource userResource
+	return sparse(resource(res), res.fields)
+}
+
+// wantLinks returns true if the client asked for _links sections with the
+// "links" query parameter. Invalid values are treated as false.
+func (app *application) wantLinks(r *http.Request) bool {
+	b, _ := strconv.ParseBool(r.URL.Query().Get("links"))
+	return b
+}
+
+// movieLinks returns the links for a movie. Movies in the trash link to the
+// restore action rather than to themselves, since they can't be fetched.
+// Other movies link to their actions and their related resources. There is
+// no revisions link, since past versions of movies aren't kept.
+func movieLinks(movie *data.Movie) links {
+	self := fmt.Sprintf("/v1/movies/%d", movie.ID)
+
+	if movie.DeletedAt != nil {
+		return links{
+			"restore":    {Href: self + "/restore", Method: http.MethodPost},
+			"collection": {Href: "/v1/movies/trash"},
+		}
+	}
+
+	return links{
+		"self":         {Href: self},
+		"update":       {Href: self, Method: http.MethodPatch},
+		"replace":      {Href: self, Method: http.MethodPut},
+		"delete":       {Href: self, Method: http.MethodDelete},
+		"collection":   {Href: "/v1/movies"},
+		"credits":      {Href: self + "/credits"},
+		"translations": {Href: self + "/translations"},
+		"releases":     {Href: self + "/releases"},
+		"reviews":      {Href: self + "/reviews"},
+		"similar":      {Href: self + "/similar"},
+	}
+}
+
+// movieResponse wraps a movie for a response, adding its _links section if
+// the client asked for it, and restricting it to the sparse fieldset that the
+// client asked for, if any. A title's highlight, and the original title and
+// language of a localized title, are included with the title.
+func (app *application) movieResponse(r *http.Request, movie *data.Movie) movieResource {
+	res := movieResource{Movie: movie, fields: app.wantFields(r)}
+	if slices.Contains(res.fields, "title") {
+		res.fields = append(res.fields, "title_highlight", "original_title", "language")
+	}
+	if app.wantLinks(r) {
+		res.Links = movieLinks(movie)
+	}
+	return res
+}
+
+// moviesResponse wraps a slice of movies for a response, adding their _links
+// sections if the client asked for them.
+func (app *application) moviesResponse(r *http.Request, movies []*data.Movie) []movieResource {
+	res := make([]movieResource, len(movies))
+	for i, movie := range movies {
+		res[i] = app.movieResponse(r, movie)
+	}
+	return res
+}
+
+// userResponse wraps a user for a response, adding its _links section if the
+// client asked for it, and restricting it to the sparse fieldset that the
+// client asked for, if any. Users link to the actions that are available to
+// them, and activated users link to themselves at /v1/users/me, since they
+// can't fetch other users.
+func (app *application) userResponse(r *http.Request, user *data.User) userResource {
+	res := userResource{User: user, fields: app.wantFields(r)}
+	if !app.wantLinks(r) {
+		return res
+	}
+
+	res.Links = links{
+		"authenticate": {Href: "/v1/tokens/authentication", Method: http.MethodPost},
+		"movies":       {Href: "/v1/movies"},
+	}
+	if user.Activated {
+		res.Links["self"] = link{Href: "/v1/users/me"}
+	} else {
+		res.Links["activate"] = link{Href: "/v1/users/activated", Method: http.MethodPut}
+		res.Links["resend_activation"] = link{Href: "/v1/tokens/activation", Method: http.MethodPost}
+	}
+
+	return res
+}
+
+// pageLinkHeader returns the value of a Link header (RFC 8288) with the
+// first, prev, next, and last pages of a paginated collection. The links are
+// built from the request's URL, with only the pagination parameters changed,
+// so the client's filters and sorting are preserved.
+//
+// For offset pagination, the next and last links require the total number of
+// records to be known. For keyset pagination, the links use the cursors in
+// the metadata, and there is no last link. An empty string is returned if
+// there are no links.
+func pageLinkHeader(r *http.Request, metadata data.Metadata, cursor *data.Cursor) string {
+	// The parameter of the pagination method that isn't in use is dropped.
+	unused := "cursor"
+	if cursor != nil {
+		unused = "page"
+	}
+
+	pageURL := func(set map[string]string) string {
+		qs := r.URL.Query()
+		qs.Del(unused)
+		for key, value := range set {
+			qs.Set(key, value)
+		}
+		u := url.URL{Path: r.URL.Path, RawQuery: qs.Encode()}
+		return u.String()
+	}
+
+	var relations []string
+	add := func(rel string, set map[string]string) {
+		relations = append(relations, fmt.Sprintf(`<%s>; rel="%s"`, pageURL(set), rel))
+	}
+
+	if cursor != nil {
+		add("first", map[string]string{"cursor": ""})
+		if metadata.PrevCursor != "" {
+			add("prev", map[string]string{"cursor": metadata.PrevCursor})
+		}
+		if metadata.NextCursor != "" {
+			add("next", map[string]string{"cursor": metadata.NextCursor})
+		}
+		return strings.Join(relations, ", ")
+	}
+
+	// The metadata is empty if there were no records on the current page.
+	if metadata.CurrentPage == 0 {
+		return ""
+	}
+
+	page := func(n int) map[string]string {
+		return map[string]string{"page": strconv.Itoa(n)}
+	}
+
+	add("first", page(metadata.FirstPage))
+	if metadata.CurrentPage > metadata.FirstPage {
+		add("prev", page(metadata.CurrentPage-1))
+	}
+	if metadata.LastPage > 0 {
+		if metadata.CurrentPage < metadata.LastPage {
+			add("next", page(metadata.CurrentPage+1))
+		}
+		add("last", page(metadata.LastPage))
+	}
+
+	return strings.Join(relations, ", ")
+}
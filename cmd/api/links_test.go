@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kvnloughead/greenlight/internal/assert"
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+func TestMovieLinks(t *testing.T) {
+	l := movieLinks(&data.Movie{ID: 3})
+	assert.Equal(t, l["self"].Href, "/v1/movies/3")
+	assert.Equal(t, l["credits"].Href, "/v1/movies/3/credits")
+	assert.Equal(t, l["similar"].Href, "/v1/movies/3/similar")
+
+	deletedAt := time.Now()
+	l = movieLinks(&data.Movie{ID: 3, DeletedAt: &deletedAt})
+	_, hasSelf := l["self"]
+	assert.Equal(t, hasSelf, false)
+	assert.Equal(t, l["restore"].Href, "/v1/movies/3/restore")
+}
+
+func TestUserResponseLinks(t *testing.T) {
+	app := &application{}
+	r := httptest.NewRequest("GET", "/v1/users/me?links=true", nil)
+
+	res := app.userResponse(r, &data.User{ID: 1, Activated: true})
+	assert.Equal(t, res.Links["self"].Href, "/v1/users/me")
+
+	res = app.userResponse(r, &data.User{ID: 1})
+	_, hasSelf := res.Links["self"]
+	assert.Equal(t, hasSelf, false)
+	assert.Equal(t, res.Links["activate"].Href, "/v1/users/activated")
+}
@@ -0,0 +1,591 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+// listLists handles GET requests to the /v1/lists endpoint. By default, the
+// authenticated user's own lists are shown, whatever their privacy. If the
+// "user" query parameter is the ID of another user, only their public lists
+// are shown. Entries aren't included.
+//
+// Lists are sorted by "id", "name", "created_at", or "updated_at", oldest
+// first by default, so the watchlist comes first.
+func (app *application) listLists(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		UserID int
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.UserID = app.readQueryInt(qs, "user", 0, v)
+	input.Filters.Page = app.readQueryInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readQueryInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readQueryString(qs, "sort", "created_at")
+	input.Filters.SortSafelist = []string{"id", "name", "created_at", "updated_at", "-id", "-name", "-created_at", "-updated_at"}
+
+	data.ValidateFilters(v, input.Filters)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	userID := user.ID
+	if input.UserID != 0 {
+		userID = int64(input.UserID)
+	}
+
+	lists, metadata, err := app.models.Lists.GetAllForUser(userID, userID != user.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	if link := pageLinkHeader(r, metadata, nil); link != "" {
+		headers.Set("Link", link)
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"lists": lists, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createList handles POST requests to the /v1/lists endpoint. The list's owner
+// is the authenticated user, and its privacy is "private" unless otherwise
+// specified. Request bodies are validated by data.ValidateList.
+func (app *application) createList(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name    string `json:"name"`
+		Privacy string `json:"privacy"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	list := &data.List{
+		UserID:  app.contextGetUser(r).ID,
+		Name:    strings.TrimSpace(input.Name),
+		Privacy: input.Privacy,
+	}
+	if list.Privacy == "" {
+		list.Privacy = "private"
+	}
+
+	v := validator.New()
+	data.ValidateList(v, list)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Lists.Insert(list)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/lists/%d", list.ID))
+	headers.Set("ETag", listETag(list))
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"list": list}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showList handles GET requests to the /v1/lists/:id endpoint. The list's
+// entries are included, in order. Other users' private lists aren't found.
+//
+// The list's version is incremented whenever its entries change, so
+// conditional requests are supported, like for movies. The ETag also changes
+// when the movies in the list are renamed or trashed. See listETag.
+func (app *application) showList(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+
+	// The entries are read first, since the list's entity tag depends on
+	// their movies.
+	var err error
+	list.Entries, err = app.models.Lists.GetEntries(list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if app.notModified(w, r, listETag(list)) {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", listETag(list))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"list": list}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateList handles PATCH requests to the /v1/lists/:id endpoint. Only the
+// list's owner can update its name and privacy. Fields that are omitted from
+// the request body are left unchanged.
+//
+// Like the other endpoints that change a list, if the request has an If-Match
+// header, it must match the ETag of the current version of the list, or a 412
+// Precondition Failed is sent.
+func (app *application) updateList(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.preconditionsMet(w, r, list.Version) {
+		return
+	}
+
+	var input struct {
+		Name    *string `json:"name"`
+		Privacy *string `json:"privacy"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.Name != nil {
+		list.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Privacy != nil {
+		list.Privacy = *input.Privacy
+	}
+
+	v := validator.New()
+	data.ValidateList(v, list)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Lists.Update(list)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", listETag(list))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"list": list}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteList handles DELETE requests to the /v1/lists/:id endpoint. Only the
+// list's owner can delete it, and it is deleted permanently, with its
+// entries. Watchlists can't be deleted, so a 422 is sent.
+//
+// Like the handlers that change a list's entries, it sends a 409 Conflict if
+// the list changes between being fetched and being written, or a 412 if the
+// request was conditional.
+func (app *application) deleteList(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.preconditionsMet(w, r, list.Version) {
+		return
+	}
+
+	if list.Watchlist {
+		v := validator.New()
+		v.AddErrorCode("watchlist", validator.CodeInvalid, "the watchlist can't be deleted")
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err := app.models.Lists.Delete(list)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "list successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// addListEntry handles POST requests to the /v1/lists/:id/entries endpoint.
+// The request body has the "movie_id" of a movie that isn't in the trash, and
+// an optional "note". The movie is added to the end of the list.
+//
+// If the movie is already in the list, or the list has 1,000 movies, a 422 is
+// sent. The response has the list's new ETag, as do those of the other
+// endpoints that change its entries, so that a client can chain conditional
+// requests.
+func (app *application) addListEntry(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.preconditionsMet(w, r, list.Version) {
+		return
+	}
+
+	var input struct {
+		MovieID int64  `json:"movie_id"`
+		Note    string `json:"note"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	v.CheckCode(input.MovieID != 0, "movie_id", validator.CodeRequired, "must be provided")
+	data.ValidateListNote(v, input.Note)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(input.MovieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddErrorCode("movie_id", validator.CodeNotFound, "must refer to an existing movie", "value", input.MovieID)
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	entry := &data.ListEntry{
+		MovieID: movie.ID,
+		Title:   movie.Title,
+		Year:    movie.Year,
+		Note:    input.Note,
+	}
+
+	err = app.models.Lists.AddEntry(list, entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddErrorCode("movie_id", validator.CodeNotFound, "must refer to an existing movie", "value", input.MovieID)
+			app.failedValidationResponse(w, r, v)
+		case errors.Is(err, data.ErrDuplicateEntry):
+			v.AddErrorCode("movie_id", validator.CodeConflict, "is already in the list", "value", input.MovieID)
+			app.failedValidationResponse(w, r, v)
+		case errors.Is(err, data.ErrListFull):
+			v.AddErrorCode("movie_id", validator.CodeInvalid, "the list already has the maximum number of movies")
+			app.failedValidationResponse(w, r, v)
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(list.Version))
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"entry": entry}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateListEntry handles PATCH requests to the /v1/lists/:id/entries/:movie_id
+// endpoint. The request body has the entry's new "note". The response has
+// the list's new ETag.
+func (app *application) updateListEntry(w http.ResponseWriter, r *http.Request) {
+	list, movieID, ok := app.readOwnListEntry(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Note *string `json:"note"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	v.CheckCode(input.Note != nil, "note", validator.CodeRequired, "must be provided")
+	if input.Note != nil {
+		data.ValidateListNote(v, *input.Note)
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	entry := &data.ListEntry{MovieID: movieID, Note: *input.Note}
+
+	err = app.models.Lists.UpdateEntry(list, entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(list.Version))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"entry": entry}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// removeListEntry handles DELETE requests to the
+// /v1/lists/:id/entries/:movie_id endpoint. The movie is removed from the
+// list, and the positions of the other entries are unchanged. The response has
+// the list's new ETag.
+func (app *application) removeListEntry(w http.ResponseWriter, r *http.Request) {
+	list, movieID, ok := app.readOwnListEntry(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Lists.RemoveEntry(list, movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(list.Version))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "movie successfully removed from list"}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// reorderList handles PUT requests to the /v1/lists/:id/order endpoint. The
+// request body has "movie_ids", which must contain the ID of every movie in
+// the list exactly once, in their new order. The response has the reordered
+// list, with its entries.
+func (app *application) reorderList(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.preconditionsMet(w, r, list.Version) {
+		return
+	}
+
+	var input struct {
+		MovieIDs []int64 `json:"movie_ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	data.ValidateListOrder(v, input.MovieIDs)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Lists.Reorder(list, input.MovieIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrOrderMismatch):
+			v.AddErrorCode("movie_ids", validator.CodeInvalid, "must contain every movie in the list exactly once")
+			app.failedValidationResponse(w, r, v)
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	list, err = app.models.Lists.Get(list.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	list.Entries, err = app.models.Lists.GetEntries(list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", listETag(list))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"list": list}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readList fetches the list with the ID in the request's URL. If there is no
+// such list, or it is another user's private list, or the fetch fails, an
+// error response is sent, and ok is false.
+func (app *application) readList(w http.ResponseWriter, r *http.Request) (list *data.List, ok bool) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	list, err = app.models.Lists.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if !list.VisibleTo(app.contextGetUser(r).ID) {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return list, true
+}
+
+// readOwnList is like readList, but it also sends a 403 if the list isn't
+// owned by the authenticated user.
+func (app *application) readOwnList(w http.ResponseWriter, r *http.Request) (list *data.List, ok bool) {
+	list, ok = app.readList(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if list.UserID != app.contextGetUser(r).ID {
+		app.notOwnerResponse(w, r)
+		return nil, false
+	}
+
+	return list, true
+}
+
+// readOwnListEntry is like readOwnList, but it also reads the movie ID in the
+// request's URL, and checks the request's preconditions.
+func (app *application) readOwnListEntry(w http.ResponseWriter, r *http.Request) (list *data.List, movieID int64, ok bool) {
+	movieID, err := app.readNamedIdParam(r, "movie_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, 0, false
+	}
+
+	list, ok = app.readOwnList(w, r)
+	if !ok {
+		return nil, 0, false
+	}
+
+	if !app.preconditionsMet(w, r, list.Version) {
+		return nil, 0, false
+	}
+
+	return list, movieID, true
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/kvnloughead/greenlight/internal/data"
 	"github.com/kvnloughead/greenlight/internal/mailer"
+	"github.com/kvnloughead/greenlight/internal/suggest"
 	_ "github.com/lib/pq"
 )
 
@@ -25,7 +26,16 @@ const version = "1.0.0"
 type config struct {
 	port int
 	env  string
-	db   struct {
+
+	// If requireIfMatch is true, requests that modify a versioned resource
+	// must include an If-Match header.
+	requireIfMatch bool
+
+	// If strictContentType is true, request bodies with a Content-Type that
+	// isn't supported are rejected, rather than read as JSON.
+	strictContentType bool
+
+	db struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
@@ -53,6 +63,43 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+
+	// cfg.trash is a struct containing configuration for purging soft-deleted
+	// movies. A retention of 0 disables scheduled purges.
+	trash struct {
+		retention     time.Duration // Defaults to 30 days.
+		purgeInterval time.Duration // Defaults to 1 hour.
+	}
+
+	// cfg.imports is a struct containing limits for bulk movie imports.
+	imports struct {
+		maxBytes int64         // Defaults to 100MB.
+		timeout  time.Duration // Defaults to 5 minutes.
+	}
+
+	// cfg.exports is a struct containing limits for streaming movie exports.
+	exports struct {
+		timeout time.Duration // Defaults to 10 minutes.
+	}
+
+	// cfg.problems is a struct containing configuration for error responses. If
+	// enabled is true, errors are always sent as RFC 9457 problem details.
+	// Otherwise, they are only sent to clients that accept
+	// application/problem+json. Problem types are documented at URIs that start
+	// with typeBase. If it is empty, the type of every problem is "about:blank".
+	problems struct {
+		enabled  bool   // Defaults to false.
+		typeBase string // Defaults to "".
+	}
+
+	// cfg.suggest is a struct containing configuration for title autocomplete.
+	// If trie is true, suggestions are served from an in-memory index, which is
+	// rebuilt when movies change and every refreshInterval. Otherwise they are
+	// served from the database.
+	suggest struct {
+		trie            bool          // Defaults to false.
+		refreshInterval time.Duration // Defaults to 5 minutes.
+	}
 }
 
 // The application struct is used for dependency injection.
@@ -66,6 +113,12 @@ type application struct {
 	// prevent shutdown until they are all completed. No need for initialization,
 	// the zero-valued sync.WaitGroup is useable, with counter set to 0.
 	wg sync.WaitGroup
+
+	// suggestions is the in-memory autocomplete index. It is nil unless the
+	// -suggest-trie flag is set. Sending to refreshSuggestions requests a
+	// rebuild of the index. See app.scheduleSuggestRefresh() for details.
+	suggestions        *suggest.Trie
+	refreshSuggestions chan struct{}
 }
 
 func main() {
@@ -78,6 +131,9 @@ func main() {
 		"development",
 		"Environment (development|staging|production)")
 
+	flag.BoolVar(&cfg.requireIfMatch, "require-if-match", false, "Require an If-Match header on PATCH and DELETE requests")
+	flag.BoolVar(&cfg.strictContentType, "strict-content-type", false, "Reject request bodies with an unsupported Content-Type")
+
 	// Read DB-related settings from CLI flags.
 	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "Postgresql DSN")
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "Postgresql max open connections")
@@ -104,6 +160,22 @@ func main() {
 			return nil
 		})
 
+	// Read trash related settings from CLI flags.
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted movies are kept before being purged (0 disables purging)")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often to purge expired movies from the trash")
+
+	// Read bulk import related settings from CLI flags.
+	flag.Int64Var(&cfg.imports.maxBytes, "import-max-bytes", 100*1_048_576, "Maximum size of a movie import request body")
+	flag.DurationVar(&cfg.imports.timeout, "import-timeout", 5*time.Minute, "Maximum duration of a movie import")
+
+	flag.DurationVar(&cfg.exports.timeout, "export-timeout", 10*time.Minute, "Maximum duration of a movie export")
+
+	flag.BoolVar(&cfg.problems.enabled, "problem-details", false, "Send all errors as RFC 9457 problem details")
+	flag.StringVar(&cfg.problems.typeBase, "problem-type-base", "", "URI prefix of problem types, such as https://api.example.com/problems/")
+
+	flag.BoolVar(&cfg.suggest.trie, "suggest-trie", false, "Serve title suggestions from an in-memory index")
+	flag.DurationVar(&cfg.suggest.refreshInterval, "suggest-refresh-interval", 5*time.Minute, "How often to rebuild the in-memory suggestion index")
+
 	flag.Parse()
 
 	// Create structured logger (to be added to dependencies).
@@ -129,6 +201,14 @@ func main() {
 			cfg.smtp.password, cfg.smtp.sender),
 	}
 
+	// Periodically purge movies that have been in the trash for longer than
+	// the retention period.
+	app.schedulePurge()
+
+	// Build the in-memory suggestion index, if it is enabled, and keep it up
+	// to date.
+	app.scheduleSuggestRefresh()
+
 	err = app.serve()
 	if err != nil {
 		logger.Error(err.Error())
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"expvar"
 	"fmt"
@@ -13,6 +16,7 @@ import (
 
 	validator "github.com/kvnloughead/greenlight/internal"
 	"github.com/kvnloughead/greenlight/internal/data"
+	"github.com/kvnloughead/greenlight/internal/i18n"
 	"golang.org/x/time/rate"
 )
 
@@ -285,13 +289,19 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 				if app.config.cors.trustedOrigins[i] == origin {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
 
+					// Allow scripts to read the ETag header, so that they can make
+					// conditional requests, the Link header, so that they can
+					// follow pagination links, and the X-Request-ID header, so that
+					// they can report failures.
+					w.Header().Set("Access-Control-Expose-Headers", "ETag, Link, X-Request-ID")
+
 					// If the request is a preflight request, set the necessary headers
 					// and send a 200 OK response with no further action.
 					if app.isPreflight(r) {
 						w.Header().Set("Access-Control-Allow-Methods",
 							"OPTIONS, PUT, PATCH, DELETE")
 						w.Header().Set("Access-Control-Allow-Headers",
-							"Authorization, Content-Type")
+							"Authorization, Content-Type, If-Match, If-None-Match, Prefer, X-Request-ID")
 						w.WriteHeader(http.StatusOK)
 						return
 					}
@@ -305,6 +315,64 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 	})
 }
 
+// maxRequestIDLength is the maximum length of a client's X-Request-ID header.
+const maxRequestIDLength = 128
+
+// The requestID middleware gives each request an ID, so that its log entries
+// and error responses can be matched up. The ID in the request's X-Request-ID
+// header is used if it is valid, so that requests can be traced through
+// proxies. Otherwise a random ID is generated. The ID is sent in the
+// response's X-Request-ID header, and added to the request context.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			b := make([]byte, 16)
+			_, err := rand.Read(b)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			id = hex.EncodeToString(b)
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, app.contextSetRequestID(r, id))
+	})
+}
+
+// validRequestID reports whether a client's request ID can be used. To keep
+// logs and headers safe, it must be no longer than maxRequestIDLength, and
+// contain only letters, digits, and the characters "-", "_", and ".".
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// The selectLocale middleware chooses the locale of a request from its
+// Accept-Language header, and adds it to the request context. Error messages
+// are translated into the locale, and it is the default preferred locale of
+// new users. See i18n.Match for details.
+func (app *application) selectLocale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Language")
+
+		locale := i18n.Match(r.Header.Get("Accept-Language"))
+		ctx := context.WithValue(r.Context(), localeContextKey, locale)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // The logRequest middleware logs info about each HTTP request, including the
 // request's IP, protocol, method, and URI.
 func (app *application) logRequest(next http.Handler) http.Handler {
@@ -316,7 +384,7 @@ func (app *application) logRequest(next http.Handler) http.Handler {
 			uri      = r.URL.RequestURI()
 		)
 
-		app.logger.Info("received request", "ip", ip, "protocol", protocol, "method", method, "uri", uri)
+		app.logger.Info("received request", "ip", ip, "protocol", protocol, "method", method, "uri", uri, "request_id", app.contextGetRequestID(r))
 
 		next.ServeHTTP(w, r)
 	})
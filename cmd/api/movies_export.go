@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+// exportFormats maps the values of the "format" query parameter to the media
+// types of the export formats.
+var exportFormats = map[string]string{
+	"csv":    mediaTypeCSV,
+	"ndjson": mediaTypeNDJSON,
+	"json":   mediaTypeJSON,
+}
+
+// exportFlushInterval is the number of movies written between flushes of the
+// response.
+const exportFlushInterval = 500
+
+// exportMediaType returns the media type an export should be written in. The
+// "format" query parameter takes precedence. Otherwise, the first supported
+// media type in the Accept header is used, and JSON is the default.
+func exportMediaType(r *http.Request, format string) string {
+	if format != "" {
+		return exportFormats[format]
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		for _, supported := range exportFormats {
+			if mediaType == supported {
+				return mediaType
+			}
+		}
+	}
+
+	return mediaTypeJSON
+}
+
+// A movieWriter writes movies to an export stream. Begin is called before the
+// first movie, and End after the last one.
+type movieWriter interface {
+	Begin() error
+	Write(movie *data.Movie) error
+	End() error
+}
+
+// csvMovieWriter writes movies as CSV, in the format accepted by POST
+// /v1/movies/import. Runtimes are written as a number of minutes.
+type csvMovieWriter struct {
+	w *csv.Writer
+}
+
+func (cw *csvMovieWriter) Begin() error {
+	return cw.w.Write([]string{"id", "title", "year", "runtime", "genres", "version"})
+}
+
+func (cw *csvMovieWriter) Write(movie *data.Movie) error {
+	return cw.w.Write([]string{
+		strconv.FormatInt(movie.ID, 10),
+		movie.Title,
+		strconv.Itoa(int(movie.Year)),
+		strconv.Itoa(int(movie.Runtime)),
+		strings.Join(movie.Genres, ","),
+		strconv.Itoa(int(movie.Version)),
+	})
+}
+
+func (cw *csvMovieWriter) End() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// ndjsonMovieWriter writes movies as newline-delimited JSON, one movie per
+// line, in the format accepted by POST /v1/movies/import. Each line is a
+// movieDocument, since the importer rejects unknown fields such as "id" and
+// "version".
+type ndjsonMovieWriter struct {
+	enc *json.Encoder
+}
+
+func (nw *ndjsonMovieWriter) Begin() error { return nil }
+
+func (nw *ndjsonMovieWriter) Write(movie *data.Movie) error {
+	return nw.enc.Encode(movieDocument{
+		Title:   movie.Title,
+		Year:    movie.Year,
+		Runtime: movie.Runtime,
+		Genres:  movie.Genres,
+	})
+}
+
+func (nw *ndjsonMovieWriter) End() error { return nil }
+
+// jsonMovieWriter writes movies as a single JSON document, of the same shape
+// as the GET /v1/movies response body, without the metadata.
+type jsonMovieWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (jw *jsonMovieWriter) Begin() error {
+	_, err := io.WriteString(jw.w, `{"movies":[`)
+	return err
+}
+
+func (jw *jsonMovieWriter) Write(movie *data.Movie) error {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return err
+	}
+
+	if jw.count > 0 {
+		js = append([]byte{','}, js...)
+	}
+	jw.count++
+
+	_, err = jw.w.Write(append(js, '\n'))
+	return err
+}
+
+func (jw *jsonMovieWriter) End() error {
+	_, err := io.WriteString(jw.w, "]}\n")
+	return err
+}
+
+// exportMovies handles GET requests to the /v1/movies/export endpoint. It
+// streams every movie that matches the filtering query parameters, which work
+// the same way as in listMovies.
+//
+// The format is chosen by the "format" query parameter (csv, ndjson, or json)
+// or, if that is omitted, by the Accept header. Movies are read through a
+// database cursor and flushed to the client as they are written, so memory
+// use stays flat however large the catalogue is.
+//
+// Once streaming has begun, errors can't be reported to the client, so they
+// are logged and the response is cut short.
+func (app *application) exportMovies(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.MovieFilter
+		Format string
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.MovieFilter = app.readMovieFilter(qs, v)
+	input.Format = app.readQueryString(qs, "format", "")
+
+	v.CheckCode(input.Format == "" || exportFormats[input.Format] != "", "format",
+		validator.CodeNotPermitted, "must be csv, ndjson, or json", "permitted", []string{"csv", "ndjson", "json"})
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	if len(input.MovieFilter.Genres) > 0 {
+		taxonomy, err := app.models.Genres.Taxonomy()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		input.MovieFilter.ResolveGenres(taxonomy)
+	}
+
+	mediaType := exportMediaType(r, input.Format)
+
+	var mw movieWriter
+	switch mediaType {
+	case mediaTypeCSV:
+		mw = &csvMovieWriter{w: csv.NewWriter(w)}
+	case mediaTypeNDJSON:
+		mw = &ndjsonMovieWriter{enc: json.NewEncoder(w)}
+	default:
+		mw = &jsonMovieWriter{w: w}
+	}
+
+	// Large exports take longer than the server's write timeout allows, so it
+	// is extended for this request.
+	rc := http.NewResponseController(w)
+	err := rc.SetWriteDeadline(time.Now().Add(app.config.exports.timeout))
+	if err != nil {
+		app.logError(r, err.Error())
+	}
+
+	// The response is only begun when the first movie is read, so that errors
+	// that occur before then can still be sent to the client.
+	started := false
+	begin := func() error {
+		started = true
+
+		extension := map[string]string{mediaTypeCSV: "csv", mediaTypeNDJSON: "ndjson", mediaTypeJSON: "json"}[mediaType]
+		w.Header().Set("Content-Type", mediaType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="movies.%s"`, extension))
+		w.WriteHeader(http.StatusOK)
+
+		return mw.Begin()
+	}
+
+	written := 0
+	err = app.models.Movies.Export(input.MovieFilter, app.config.exports.timeout, func(movie *data.Movie) error {
+		if !started {
+			if err := begin(); err != nil {
+				return err
+			}
+		}
+
+		err := mw.Write(movie)
+		if err != nil {
+			return err
+		}
+
+		written++
+		if written%exportFlushInterval == 0 {
+			if csvw, ok := mw.(*csvMovieWriter); ok {
+				csvw.w.Flush()
+			}
+			return rc.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if !started {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.logError(r, fmt.Sprintf("export interrupted after %d movies: %v", written, err))
+		return
+	}
+
+	if !started {
+		err = begin()
+	}
+	if err == nil {
+		err = mw.End()
+	}
+	if err != nil {
+		app.logError(r, err.Error())
+	}
+}
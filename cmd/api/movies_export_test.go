@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/kvnloughead/greenlight/internal/assert"
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+func TestNDJSONExportRoundTrip(t *testing.T) {
+	movies := []*data.Movie{
+		{ID: 1, Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"crime", "thriller"}, Version: 3, Synopsis: "..."},
+		{ID: 2, Title: "Alien", Year: 1979, Runtime: 117, Genres: []string{"horror"}, Version: 1},
+	}
+
+	var buf bytes.Buffer
+	nw := &ndjsonMovieWriter{enc: json.NewEncoder(&buf)}
+	for _, movie := range movies {
+		assert.IsNil(t, nw.Write(movie))
+	}
+
+	nr := newNDJSONMovieReader(&application{}, &buf)
+	for _, want := range movies {
+		got, err := nr.Next()
+		assert.IsNil(t, err)
+		assert.Equal(t, got.Title, want.Title)
+		assert.Equal(t, got.Year, want.Year)
+		assert.Equal(t, got.Runtime, want.Runtime)
+		assert.Equal(t, len(got.Genres), len(want.Genres))
+	}
+}
@@ -3,20 +3,61 @@ package main
 import (
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	validator "github.com/kvnloughead/greenlight/internal"
 	"github.com/kvnloughead/greenlight/internal/data"
 )
 
 // listMovies handles GET requests to the /v1/movies endpoint.
+//
+// Movies can be filtered by the "title", "search_mode", "genres",
+// "genres_mode", "year_min", "year_max", "runtime_min", "runtime_max",
+// "person", "person_role", "released_in", "released_after",
+// "released_before", and "certification_max" query parameters. See
+// data.MovieFilter for details.
+//
+// A title search also matches movies by their alternate titles, in any
+// language. If a title is given, the results can be sorted by "relevance",
+// which puts the closest matches first. Each movie also has a
+// title_highlight, with the matching parts of its title wrapped in <mark>
+// tags, unless the "highlight" query parameter is false. The highlight is
+// HTML, so the rest of the title is escaped.
+//
+// Each movie has a rating section, with the average and number of users'
+// ratings, and a Bayesian score. Sorting by "-rating" puts the movies with
+// the highest scores first. Scores change with every rating, so pages fetched
+// by cursor while ratings are being made can skip or repeat movies.
+//
+// If the "facets" query parameter is true, the response has a facets section
+// with the number of matching movies per genre, decade, and runtime bucket,
+// for building filter controls. See data.MovieModel.Facets for details.
+//
+// Results are paginated by page number by default. If the "cursor" query
+// parameter is present, keyset pagination is used instead: an empty cursor
+// selects the first page, and the next_cursor and prev_cursor values in the
+// response metadata select the adjacent pages.
+//
+// The "include_total" query parameter determines whether the total number of
+// matching movies is counted. It defaults to true with page numbers, and to
+// false with cursors.
+//
+// The response has a Link header with the URLs of the first, previous, next,
+// and last pages, where they exist. If the "links" query parameter is true,
+// each movie also has a _links section. The "fields" query parameter selects
+// a sparse fieldset, such as "id,title", which is applied both to the query
+// and to the response.
 func (app *application) listMovies(w http.ResponseWriter, r *http.Request) {
 	// input is an anonymous struct intended to store the query params for
 	// filtering, sorting, and pagination.
 	var input struct {
-		Title  string
-		Genres []string
+		data.MovieFilter
 		data.Filters
+		Facets bool
 	}
 
 	v := validator.New()
@@ -24,27 +65,41 @@ func (app *application) listMovies(w http.ResponseWriter, r *http.Request) {
 
 	// Read query params into the input struct, setting reasonable defaults if
 	// any are omitted, and validating the values that should be integers.
-	input.Title = app.readQueryString(qs, "title", "")
-	input.Genres = app.readQueryCSV(qs, "genres", []string{})
+	input.MovieFilter = app.readMovieFilter(qs, v)
+	input.MovieFilter.Highlight = app.readQueryBool(qs, "highlight", true, v)
+	input.Facets = app.readQueryBool(qs, "facets", false, v)
 	input.Filters.Page = app.readQueryInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readQueryInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readQueryString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "relevance", "rating", "-id", "-title", "-year", "-runtime", "-relevance", "-rating"}
+	input.Filters.Cursor = app.readQueryCursor(qs, "cursor", v)
+	input.Filters.IncludeTotal = app.readQueryBool(qs, "include_total", !qs.Has("cursor"), v)
+	input.Filters.Fields = app.wantFields(r)
 
 	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
 	data.ValidateFilters(v, input.Filters)
+	v.CheckCode(input.MovieFilter.Title != "" || strings.TrimPrefix(input.Filters.Sort, "-") != "relevance",
+		"sort", validator.CodeNotPermitted, "relevance can only be used with a title search")
 	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
+	if len(input.MovieFilter.Genres) > 0 {
+		taxonomy, err := app.models.Genres.Taxonomy()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		input.MovieFilter.ResolveGenres(taxonomy)
+	}
+
 	movies, metadata, err := app.models.Movies.GetAll(
-		input.Title,
-		input.Genres,
+		input.MovieFilter,
 		input.Filters,
 	)
 
@@ -53,12 +108,25 @@ func (app *application) listMovies(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.writeJSON(
-		w,
-		http.StatusOK,
-		envelope{"movies": movies, "metadata": metadata},
-		nil,
-	)
+	env := envelope{"movies": app.moviesResponse(r, movies), "metadata": metadata}
+
+	if input.Facets {
+		facets, err := app.models.Movies.Facets(input.MovieFilter)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env["facets"] = facets
+	}
+
+	// Link to the adjacent pages, so that clients don't have to build the URLs
+	// themselves.
+	headers := make(http.Header)
+	if link := pageLinkHeader(r, metadata, input.Filters.Cursor); link != "" {
+		headers.Set("Link", link)
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, env, headers)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -70,8 +138,9 @@ func (app *application) listMovies(w http.ResponseWriter, r *http.Request) {
 // body is decoded by the app.readJSON helper. See that function for details
 // about error handling.
 //
-// Request bodies are validated by ValidateMovie. A failedValidationResponse
-// error is sent if one or more fields fails validation.
+// Request bodies are validated by ValidateMovie, against the genre taxonomy.
+// A failedValidationResponse error is sent if one or more fields fails
+// validation.
 func (app *application) createMovie(w http.ResponseWriter, r *http.Request) {
 	// Struct to store the data from the responses body. The struct's fields must
 	// be exported to use it with json.NewDecoder.
@@ -84,7 +153,12 @@ func (app *application) createMovie(w http.ResponseWriter, r *http.Request) {
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
 		return
 	}
 
@@ -95,11 +169,17 @@ func (app *application) createMovie(w http.ResponseWriter, r *http.Request) {
 		Genres:  input.Genres,
 	}
 
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	v := validator.New()
-	data.ValidateMovie(v, movie)
+	data.ValidateMovie(v, movie, taxonomy)
 
 	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
@@ -108,19 +188,30 @@ func (app *application) createMovie(w http.ResponseWriter, r *http.Request) {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.invalidateSuggestions()
 
 	// Specify the API location of the created resource.
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("ETag", movieETag(movie))
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"movie": app.movieResponse(r, movie)}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 }
 
-// showMovie handles GET requests to the /v1/movies/:id endpoint.
+// showMovie handles GET requests to the /v1/movies/:id endpoint. The response
+// includes an ETag header derived from the movie's version and its rating. If
+// the request's If-None-Match header matches it, a 304 Not Modified is sent
+// instead. See movieETag.
+//
+// The title is localized to the client's preferred language, if the movie
+// has a translation in it, and the original title and synopsis are included
+// too. Each language has its own ETag. Only this endpoint localizes movies,
+// so it is the only one where the "synopsis" field can be selected. See
+// localizeMovie.
 func (app *application) showMovie(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIdParam(r)
 	if err != nil {
@@ -139,19 +230,103 @@ func (app *application) showMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	// The movie is localized first, since its entity tag depends on the
+	// language of the translation.
+	err = app.localizeMovie(r, movie)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+
+	if app.notModified(w, r, movieETag(movie)) {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": app.movieResponse(r, movie)}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// suggestMovies handles GET requests to the /v1/movies/suggest endpoint. It
+// returns the IDs and titles of up to "limit" movies whose titles begin with
+// the "q" query parameter, for type-ahead search.
+//
+// Suggestions are served from the in-memory index if the -suggest-trie flag is
+// set, and otherwise from the database, with a short query timeout.
+func (app *application) suggestMovies(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Query string
+		Limit int
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Query = strings.TrimSpace(app.readQueryString(qs, "q", ""))
+	input.Limit = app.readQueryInt(qs, "limit", 10, v)
+
+	v.CheckCode(input.Query != "", "q", validator.CodeRequired, "must be provided")
+	v.CheckCode(utf8.RuneCountInString(input.Query) <= 100, "q", validator.CodeTooLong, "must not be more than 100 characters long", "max", 100)
+	v.CheckCode(input.Limit > 0, "limit", validator.CodeOutOfRange, "must be greater than zero", "min", 1)
+	v.CheckCode(input.Limit <= 20, "limit", validator.CodeOutOfRange, "must be a maximum of 20", "max", 20)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	var suggestions []data.MovieSuggestion
+
+	if app.suggestions != nil {
+		suggestions = []data.MovieSuggestion{}
+		for _, e := range app.suggestions.Search(input.Query, input.Limit) {
+			suggestions = append(suggestions, data.MovieSuggestion{ID: e.ID, Title: e.Title})
+		}
+	} else {
+		var err error
+		suggestions, err = app.models.Movies.Suggest(input.Query, input.Limit)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err := app.writeResponse(w, r, http.StatusOK, envelope{"suggestions": suggestions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// movieDocument is the editable representation of a movie. It is the body of
+// PUT requests, and the document that PATCH requests' patches are applied to.
+type movieDocument struct {
+	Title   string       `json:"title"`
+	Year    int32        `json:"year"`
+	Runtime data.Runtime `json:"runtime"`
+	Genres  []string     `json:"genres"`
 }
 
-// updateMovie handles PATCH requests to the /v1/movies/:id endpoint. It's body
-// should contain one or more movie fields to be modified. Partial updates are
-// supported.
+// updateMovie handles PATCH requests to the /v1/movies/:id endpoint. The
+// format of the request body is chosen by its Content-Type header.
 //
-// If fields are omitted in the request body, or if they are given a null value
-// they will be unchanged.
+//   - application/json (or no Content-Type) bodies should contain one or more
+//     movie fields to be modified. If fields are omitted, or if they are given
+//     a null value they will be unchanged. XML and MessagePack bodies are
+//     treated the same way, see app.readJSON.
+//   - application/merge-patch+json bodies are JSON Merge Patches (RFC 7396).
+//     Fields given a null value are cleared.
+//   - application/json-patch+json bodies are JSON Patches (RFC 6902).
+//
+// The patches are applied to the movie's movieDocument representation. Other
+// media types result in a 415 Unsupported Media Type response. In every case
+// the updated movie is validated with data.ValidateMovie.
+//
+// If the request has an If-Match header, it must match the ETag of the current
+// version of the movie, or a 412 Precondition Failed is sent.
 func (app *application) updateMovie(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIdParam(r)
 	if err != nil {
@@ -171,42 +346,149 @@ func (app *application) updateMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// input is a struct to store the JSON values from the request body. We use
-	// pointers to facilitate partial updates. If a value is not provided, the
-	// pointer will be nil, and we can leave the corresponding field unchanged.
-	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
+	if !app.preconditionsMet(w, r, movie.Version) {
+		return
 	}
 
-	// Read JSON from request body into the input struct.
-	err = app.readJSON(w, r, &input)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	default:
+		// input is a struct to store the JSON values from the request body. We use
+		// pointers to facilitate partial updates. If a value is not provided, the
+		// pointer will be nil, and we can leave the corresponding field unchanged.
+		var input struct {
+			Title   *string       `json:"title"`
+			Year    *int32        `json:"year"`
+			Runtime *data.Runtime `json:"runtime"`
+			Genres  []string      `json:"genres"`
+		}
+
+		// Read JSON from request body into the input struct.
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			switch {
+			case errors.Is(err, errUnsupportedMediaType):
+				app.unsupportedMediaTypeResponse(w, r)
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+
+		// If the input field isn't nil, update the corresponding field in the
+		// record.
+		if input.Title != nil {
+			movie.Title = *input.Title
+		}
+		if input.Year != nil {
+			movie.Year = *input.Year
+		}
+		if input.Runtime != nil {
+			movie.Runtime = *input.Runtime
+		}
+		if input.Genres != nil {
+			movie.Genres = input.Genres
+		}
+
+	case mediaTypeMergePatch, mediaTypeJSONPatch:
+		doc := movieDocument{
+			Title:   movie.Title,
+			Year:    movie.Year,
+			Runtime: movie.Runtime,
+			Genres:  movie.Genres,
+		}
+
+		// Apply the patch to the movie's current document. Fields that the patch
+		// removes are left with their zero values.
+		var patched movieDocument
+		err = app.readPatch(w, r, doc, &patched)
+		if err != nil {
+			switch {
+			case errors.Is(err, errUnsupportedMediaType):
+				app.unsupportedMediaTypeResponse(w, r)
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+
+		movie.Title = patched.Title
+		movie.Year = patched.Year
+		movie.Runtime = patched.Runtime
+		movie.Genres = patched.Genres
+	}
+
+	app.saveMovie(w, r, movie)
+}
+
+// replaceMovie handles PUT requests to the /v1/movies/:id endpoint. Its body
+// should contain a complete movieDocument, which replaces the movie's
+// editable fields. Omitted fields are cleared, so they will fail validation.
+//
+// If the request has an If-Match header, it must match the ETag of the current
+// version of the movie, or a 412 Precondition Failed is sent.
+func (app *application) replaceMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.notFoundResponse(w, r)
 		return
 	}
 
-	// If the input field isn't nil, update the corresponding field in the record.
-	if input.Title != nil {
-		movie.Title = *input.Title
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
 	}
-	if input.Year != nil {
-		movie.Year = *input.Year
+
+	if !app.preconditionsMet(w, r, movie.Version) {
+		return
 	}
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
+
+	var input movieDocument
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
 	}
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+
+	movie.Title = input.Title
+	movie.Year = input.Year
+	movie.Runtime = input.Runtime
+	movie.Genres = input.Genres
+
+	app.saveMovie(w, r, movie)
+}
+
+// saveMovie validates a modified movie, saves it with Movies.Update(), and
+// writes the updated movie and its new ETag to the response. It is shared by
+// the PATCH and PUT handlers.
+//
+// A 422 is sent if validation fails. Edit conflicts result in a 409, or in a
+// 412 if the request was conditional.
+func (app *application) saveMovie(w http.ResponseWriter, r *http.Request, movie *data.Movie) {
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	// Validate the updated movie record, or return a 422 response.
 	v := validator.New()
-	data.ValidateMovie(v, movie)
+	data.ValidateMovie(v, movie, taxonomy)
 	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
@@ -214,6 +496,10 @@ func (app *application) updateMovie(w http.ResponseWriter, r *http.Request) {
 	err = app.models.Movies.Update(movie)
 	if err != nil {
 		switch {
+		// For conditional requests, a conflict means that the version the client
+		// saw is no longer current, which is a failed precondition.
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
 		default:
@@ -221,15 +507,26 @@ func (app *application) updateMovie(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	app.invalidateSuggestions()
+
+	// Write updated JSON to response, along with the new ETag.
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
 
-	// Write updated JSON to response.
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": app.movieResponse(r, movie)}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
-		return
 	}
 }
 
+// deleteMovie handles DELETE requests to the /v1/movies/:id endpoint. Movies
+// aren't deleted permanently, they are moved to the trash, where they can be
+// restored until they are purged.
+//
+// If the request has an If-Match header, it must match the ETag of the current
+// version of the movie, or a 412 Precondition Failed is sent. If the movie is
+// updated between being fetched and being deleted, a 409 Conflict is sent, or
+// a 412 if the request was conditional.
 func (app *application) deleteMovie(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIdParam(r)
 	if err != nil {
@@ -237,8 +534,101 @@ func (app *application) deleteMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete record or send an error response.
-	err = app.models.Movies.Delete(id)
+	// Fetch the existing movie to check the request's preconditions against.
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.preconditionsMet(w, r, movie.Version) {
+		return
+	}
+
+	// Move record to the trash or send an error response.
+	err = app.models.Movies.Delete(movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.invalidateSuggestions()
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "movie successfully moved to trash"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listTrash handles GET requests to the /v1/movies/trash endpoint. It lists
+// the movies that have been deleted but not yet purged, most recently deleted
+// first by default.
+func (app *application) listTrash(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readQueryInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readQueryInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readQueryString(qs, "sort", "-deleted_at")
+	input.Filters.SortSafelist = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+	input.Filters.IncludeTotal = true
+	input.Filters.Fields = app.wantFields(r)
+
+	data.ValidateFilters(v, input.Filters)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetAllDeleted(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	if link := pageLinkHeader(r, metadata, nil); link != "" {
+		headers.Set("Link", link)
+	}
+
+	err = app.writeResponse(
+		w,
+		r,
+		http.StatusOK,
+		envelope{"movies": app.moviesResponse(r, movies), "metadata": metadata},
+		headers,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreMovie handles POST requests to the /v1/movies/:id/restore endpoint.
+// It moves a movie out of the trash and responds with the restored movie. A
+// 404 is sent if the movie isn't in the trash.
+func (app *application) restoreMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Restore(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -248,8 +638,29 @@ func (app *application) deleteMovie(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	app.invalidateSuggestions()
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": app.movieResponse(r, movie)}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeTrash handles DELETE requests to the /v1/movies/trash endpoint. It
+// permanently deletes every movie in the trash, regardless of the retention
+// period, and responds with the number of movies purged.
+func (app *application) purgeTrash(w http.ResponseWriter, r *http.Request) {
+	purged, err := app.models.Movies.Purge(time.Now())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successful deleted"}, nil)
+	env := envelope{"message": "trash successfully purged", "purged": purged}
+	err = app.writeResponse(w, r, http.StatusOK, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
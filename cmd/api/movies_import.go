@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+// Import modes, chosen by the "mode" query parameter.
+const (
+	// In atomic mode, either every row is inserted or none are.
+	importModeAtomic = "atomic"
+
+	// In best_effort mode, valid rows are inserted and invalid rows are skipped.
+	importModeBestEffort = "best_effort"
+)
+
+const (
+	// importBatchSize is the number of rows copied into the database at a time.
+	importBatchSize = 500
+
+	// maxImportErrors is the maximum number of row errors in an import report.
+	maxImportErrors = 1000
+)
+
+// Supported media types for import request bodies.
+const (
+	mediaTypeCSV    = "text/csv"
+	mediaTypeNDJSON = "application/x-ndjson"
+)
+
+// importRowError describes the problems with a single row of an import. Rows
+// are numbered from 1, not counting the CSV header.
+type importRowError struct {
+	Row    int               `json:"row"`
+	Errors map[string]string `json:"errors"`
+}
+
+// importReport summarizes the result of an import.
+type importReport struct {
+	Mode      string           `json:"mode"`
+	Rows      int              `json:"rows"`
+	Inserted  int              `json:"inserted"`
+	Failed    int              `json:"failed"`
+	Errors    []importRowError `json:"errors"`
+	Truncated bool             `json:"errors_truncated,omitempty"`
+}
+
+// addError records an error for a row, unless the report already contains
+// maxImportErrors errors.
+func (rep *importReport) addError(row int, errs map[string]string) {
+	rep.Failed++
+
+	if len(rep.Errors) >= maxImportErrors {
+		rep.Truncated = true
+		return
+	}
+	rep.Errors = append(rep.Errors, importRowError{Row: row, Errors: errs})
+}
+
+// A movieRowReader reads movies from an import stream, one row at a time. Next
+// returns io.EOF when there are no more rows. If a row can't be parsed, a
+// rowError is returned, and the reader may continue with the next row.
+type movieRowReader interface {
+	Next() (*data.Movie, error)
+}
+
+// rowError is returned by a movieRowReader if a row can't be parsed.
+type rowError struct {
+	errs map[string]string
+}
+
+func (e rowError) Error() string {
+	return fmt.Sprintf("malformed row: %v", e.errs)
+}
+
+// csvMovieReader reads movies from CSV. The first record must be a header
+// containing the columns title, year, runtime, and genres, in any order.
+// Runtimes may be given as "<runtime> mins" or as a number of minutes, and
+// genres are comma-separated within their field.
+type csvMovieReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func newCSVMovieReader(body io.Reader) (*csvMovieReader, error) {
+	r := csv.NewReader(body)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.ReuseRecord = true
+
+	header, err := r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("request body must not be empty")
+		}
+		return nil, fmt.Errorf("body contains malformed CSV: %v", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, name := range []string{"title", "year", "runtime", "genres"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV header must contain a %q column", name)
+		}
+	}
+
+	return &csvMovieReader{r: r, columns: columns}, nil
+}
+
+func (cr *csvMovieReader) Next() (*data.Movie, error) {
+	record, err := cr.r.Read()
+	if err != nil {
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			return nil, rowError{map[string]string{"row": parseError.Err.Error()}}
+		}
+		return nil, err
+	}
+
+	field := func(name string) string {
+		i := cr.columns[name]
+		if i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	movie := &data.Movie{Title: field("title")}
+	errs := make(map[string]string)
+
+	if s := field("year"); s != "" {
+		year, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			errs["year"] = "must be an integer value"
+		}
+		movie.Year = int32(year)
+	}
+
+	if s := field("runtime"); s != "" {
+		s = strings.TrimSuffix(s, " mins")
+		runtime, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			errs["runtime"] = "must be an integer value, or of the format \"<runtime> mins\""
+		}
+		movie.Runtime = data.Runtime(runtime)
+	}
+
+	if s := field("genres"); s != "" {
+		for _, genre := range strings.Split(s, ",") {
+			movie.Genres = append(movie.Genres, strings.TrimSpace(genre))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, rowError{errs}
+	}
+
+	return movie, nil
+}
+
+// ndjsonMovieReader reads movies from newline-delimited JSON. Each non-blank
+// line must be a movieDocument, in the same format as the body of a POST
+// /v1/movies request, and must not be longer than maxBodyBytes. A longer line
+// stops the import with a bufio.ErrTooLong error, since the rest of the body
+// can't be read line by line.
+type ndjsonMovieReader struct {
+	app     *application
+	scanner *bufio.Scanner
+}
+
+func newNDJSONMovieReader(app *application, body io.Reader) *ndjsonMovieReader {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBodyBytes)
+	return &ndjsonMovieReader{app: app, scanner: scanner}
+}
+
+func (nr *ndjsonMovieReader) Next() (*data.Movie, error) {
+	for nr.scanner.Scan() {
+		line := bytes.TrimSpace(nr.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var doc movieDocument
+		err := nr.app.decodeJSON(bytes.NewReader(line), &doc)
+		if err != nil {
+			return nil, rowError{map[string]string{"row": err.Error()}}
+		}
+
+		return &data.Movie{
+			Title:   doc.Title,
+			Year:    doc.Year,
+			Runtime: doc.Runtime,
+			Genres:  doc.Genres,
+		}, nil
+	}
+
+	err := nr.scanner.Err()
+	if err == nil {
+		return nil, io.EOF
+	}
+	return nil, err
+}
+
+// importMovies handles POST requests to the /v1/movies/import endpoint. It
+// bulk inserts movies from a CSV (text/csv) or NDJSON (application/x-ndjson)
+// request body. The body may be as large as the -import-max-bytes flag allows,
+// rather than the 1MB that app.readJSON allows.
+//
+// Every row is validated with data.ValidateMovie. Valid rows are inserted in
+// batches of importBatchSize using pq.CopyIn. The "mode" query parameter
+// determines what happens if some rows are invalid.
+//
+//   - atomic (default): nothing is inserted, and a 422 response is sent.
+//   - best_effort: valid rows are inserted, and invalid rows are skipped.
+//
+// In either case the response contains an import report, listing the errors
+// for each row that couldn't be inserted.
+//
+// A body larger than -import-max-bytes, or an NDJSON line larger than 1MB,
+// stops the import with a 413 response.
+func (app *application) importMovies(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	mode := app.readQueryString(r.URL.Query(), "mode", importModeAtomic)
+	v.CheckCode(validator.PermittedValue(mode, importModeAtomic, importModeBestEffort), "mode",
+		validator.CodeNotPermitted, "must be atomic or best_effort", "permitted", []string{importModeAtomic, importModeBestEffort})
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// Large imports take longer than the server's read and write timeouts
+	// allow, so they are extended for this request.
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(app.config.imports.timeout)
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		app.logError(r, err.Error())
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		app.logError(r, err.Error())
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.imports.maxBytes)
+
+	var rows movieRowReader
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case mediaTypeCSV:
+		cr, err := newCSVMovieReader(r.Body)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		rows = cr
+	case mediaTypeNDJSON, "application/ndjson":
+		rows = newNDJSONMovieReader(app, r.Body)
+	default:
+		msg := fmt.Sprintf("the %q media type is not supported, use %s or %s",
+			r.Header.Get("Content-Type"), mediaTypeCSV, mediaTypeNDJSON)
+		app.errorResponse(w, r, http.StatusUnsupportedMediaType, problemUnsupportedMediaType, msg)
+		return
+	}
+
+	report, err := app.runImport(r, rows, mode)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			msg := fmt.Sprintf("body must not exceed %d bytes", maxBytesError.Limit)
+			app.errorResponse(w, r, http.StatusRequestEntityTooLarge, problemBodyTooLarge, msg)
+		case errors.Is(err, bufio.ErrTooLong):
+			msg := fmt.Sprintf("each line must not exceed %d bytes", maxBodyBytes)
+			app.errorResponse(w, r, http.StatusRequestEntityTooLarge, problemBodyTooLarge, msg)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if report.Inserted > 0 {
+		app.invalidateSuggestions()
+	}
+
+	status := http.StatusOK
+	if mode == importModeAtomic && report.Failed > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	err = app.writeResponse(w, r, status, envelope{"import": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runImport reads, validates, and inserts every row from the reader, and
+// returns a report of the results. Errors that prevent the import from
+// continuing, such as a broken connection or an oversized body, are returned.
+//
+// In atomic mode, all rows are inserted in a single transaction, which is only
+// committed if every row is valid. In best_effort mode, each batch is inserted
+// in its own transaction, and a batch that the database rejects is reported
+// as an error for each of its rows. The database's error is logged, rather
+// than reported, since it may reveal details of the schema.
+func (app *application) runImport(r *http.Request, rows movieRowReader, mode string) (*importReport, error) {
+	report := &importReport{Mode: mode, Errors: []importRowError{}}
+
+	// Genres are validated against the taxonomy as it was when the import
+	// began.
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		return nil, err
+	}
+
+	var importer *data.MovieImporter
+	if mode == importModeAtomic {
+		importer, err = app.models.Movies.NewImporter(app.config.imports.timeout)
+		if err != nil {
+			return nil, err
+		}
+		defer importer.Rollback()
+	}
+
+	var (
+		batch     []*data.Movie
+		batchRows []int
+	)
+
+	// flush inserts the current batch. It returns an error only if the import
+	// can't continue.
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		defer func() { batch, batchRows = batch[:0], batchRows[:0] }()
+
+		// In atomic mode, there is no point inserting rows once a row has failed,
+		// since the transaction will be rolled back.
+		if mode == importModeAtomic {
+			if report.Failed > 0 {
+				return nil
+			}
+			err := importer.Insert(batch)
+			if err != nil {
+				app.rejectBatch(r, report, batchRows, err)
+				return nil
+			}
+			report.Inserted += len(batch)
+			return nil
+		}
+
+		batchImporter, err := app.models.Movies.NewImporter(app.config.imports.timeout)
+		if err != nil {
+			return err
+		}
+		defer batchImporter.Rollback()
+
+		err = batchImporter.Insert(batch)
+		if err == nil {
+			err = batchImporter.Commit()
+		}
+		if err != nil {
+			app.rejectBatch(r, report, batchRows, err)
+			return nil
+		}
+
+		report.Inserted += len(batch)
+		return nil
+	}
+
+	for {
+		movie, err := rows.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		report.Rows++
+
+		if err != nil {
+			var re rowError
+			if errors.As(err, &re) {
+				report.addError(report.Rows, re.errs)
+				continue
+			}
+			return nil, err
+		}
+
+		v := validator.New()
+		data.ValidateMovie(v, movie, taxonomy)
+		if !v.Valid() {
+			report.addError(report.Rows, v.Errors)
+			continue
+		}
+
+		batch = append(batch, movie)
+		batchRows = append(batchRows, report.Rows)
+
+		if len(batch) >= importBatchSize {
+			err = flush()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = flush()
+	if err != nil {
+		return nil, err
+	}
+
+	if mode == importModeAtomic {
+		if report.Failed > 0 {
+			report.Inserted = 0
+			return report, nil
+		}
+
+		err = importer.Commit()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// rejectBatch logs the error with which the database rejected a batch, and
+// reports a generic error for each of the batch's rows.
+func (app *application) rejectBatch(r *http.Request, report *importReport, batchRows []int, err error) {
+	app.logError(r, fmt.Sprintf("import batch rejected: %v", err))
+
+	for _, row := range batchRows {
+		report.addError(row, map[string]string{"row": "could not be inserted"})
+	}
+}
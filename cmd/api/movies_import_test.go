@@ -0,0 +1,24 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+func TestNDJSONMovieReaderLineTooLong(t *testing.T) {
+	body := `{"title":"Heat","year":1995,"runtime":"170 mins","genres":["crime"]}` + "\n" +
+		`{"title":"` + strings.Repeat("x", maxBodyBytes) + `"}` + "\n"
+
+	nr := newNDJSONMovieReader(&application{}, strings.NewReader(body))
+
+	movie, err := nr.Next()
+	assert.IsNil(t, err)
+	assert.Equal(t, movie.Title, "Heat")
+
+	_, err = nr.Next()
+	assert.Equal(t, errors.Is(err, bufio.ErrTooLong), true)
+}
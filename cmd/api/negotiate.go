@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kvnloughead/greenlight/internal/codec"
+)
+
+// Media types that responses can be encoded in, in addition to JSON, CSV, and
+// NDJSON, and that request bodies can be decoded from.
+const (
+	mediaTypeXML     = "application/xml"
+	mediaTypeMsgpack = "application/msgpack"
+)
+
+// mediaTypeAliases maps alternative names of the supported media types to
+// their canonical names.
+var mediaTypeAliases = map[string]string{
+	"text/xml":                mediaTypeXML,
+	"application/x-msgpack":   mediaTypeMsgpack,
+	"application/vnd.msgpack": mediaTypeMsgpack,
+	"application/ndjson":      mediaTypeNDJSON,
+}
+
+// mediaRanges maps the wildcard media ranges of Accept headers to the
+// supported media types they match, in order of preference.
+var mediaRanges = map[string][]string{
+	"*/*":           {mediaTypeJSON, mediaTypeXML, mediaTypeMsgpack, mediaTypeCSV, mediaTypeNDJSON},
+	"application/*": {mediaTypeJSON, mediaTypeXML, mediaTypeMsgpack, mediaTypeNDJSON},
+	"text/*":        {mediaTypeCSV},
+}
+
+// responseMediaTypes are the media types that responses can be encoded in.
+var responseMediaTypes = []string{mediaTypeJSON, mediaTypeXML, mediaTypeMsgpack, mediaTypeCSV, mediaTypeNDJSON}
+
+// encoding describes how a response should be encoded. JSON responses are
+// indented unless compact is true. If problem is true, the client accepts
+// application/problem+json, so errors are sent as problem details.
+type encoding struct {
+	mediaType string
+	compact   bool
+	problem   bool
+}
+
+// etag returns the entity tag of the encoding's representation of a resource,
+// given the tag of its default representation, which is indented JSON. Other
+// representations have different bodies, so their tags have a variant for
+// the encoding appended, such as "3-xml" or "3-compact", which keeps them
+// distinct strong tags.
+func (enc encoding) etag(tag string) string {
+	variant := map[string]string{
+		mediaTypeXML:     "xml",
+		mediaTypeMsgpack: "msgpack",
+		mediaTypeCSV:     "csv",
+		mediaTypeNDJSON:  "ndjson",
+	}[enc.mediaType]
+	if enc.mediaType == mediaTypeJSON && enc.compact {
+		variant = "compact"
+	}
+
+	if variant == "" || !strings.HasSuffix(tag, `"`) {
+		return tag
+	}
+	return strings.TrimSuffix(tag, `"`) + "-" + variant + `"`
+}
+
+// defaultEncoding is used if the client doesn't send an Accept header, and for
+// responses that are sent before content negotiation, such as 406 responses.
+var defaultEncoding = encoding{mediaType: mediaTypeJSON}
+
+// negotiate chooses the encoding of a response from the value of an Accept
+// header. The supported media type with the highest quality value is chosen,
+// with ties going to the type listed first. Wildcards are resolved to JSON, or
+// to CSV for text/*. The "pretty" parameter of application/json chooses
+// between indented and compact JSON, and defaults to true.
+//
+// Types with a quality value of zero are refused, as RFC 9110 specifies, so
+// wildcards resolve to the next supported type instead. For example,
+// "application/json;q=0, */*" resolves to XML.
+//
+// Accepting application/problem+json doesn't affect the choice of media type,
+// but sets the encoding's problem field. If it is the only type accepted,
+// responses are JSON.
+//
+// It returns false if the header doesn't accept any of the supported types.
+func negotiate(accept string) (encoding, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return defaultEncoding, true
+	}
+
+	type mediaRange struct {
+		mediaType string
+		params    map[string]string
+		q         float64
+	}
+
+	var ranges []mediaRange
+	refused := make(map[string]bool)
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if alias, ok := mediaTypeAliases[mediaType]; ok {
+			mediaType = alias
+		}
+
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(s, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			refused[mediaType] = true
+			continue
+		}
+
+		ranges = append(ranges, mediaRange{mediaType, params, q})
+	}
+
+	var (
+		best     encoding
+		bestQ    float64
+		accepted bool
+		problem  bool
+	)
+
+	for _, r := range ranges {
+		if r.mediaType == mediaTypeProblemJSON {
+			problem = true
+			continue
+		}
+		if accepted && r.q <= bestQ {
+			continue
+		}
+
+		candidates, ok := mediaRanges[r.mediaType]
+		if !ok {
+			candidates = []string{r.mediaType}
+		}
+
+		mediaType := ""
+		for _, t := range candidates {
+			if slices.Contains(responseMediaTypes, t) && !refused[t] {
+				mediaType = t
+				break
+			}
+		}
+		if mediaType == "" {
+			continue
+		}
+
+		pretty, err := strconv.ParseBool(r.params["pretty"])
+		best = encoding{mediaType: mediaType, compact: err == nil && !pretty}
+		bestQ = r.q
+		accepted = true
+	}
+
+	if problem && !accepted && !refused[mediaTypeJSON] {
+		best, accepted = defaultEncoding, true
+	}
+	best.problem = problem
+
+	return best, accepted
+}
+
+var encodingContextKey = contextKey("encoding")
+
+// contextGetEncoding returns the encoding chosen for the response by the
+// negotiateContent middleware, or the default encoding if there isn't one.
+func (app *application) contextGetEncoding(r *http.Request) encoding {
+	enc, ok := r.Context().Value(encodingContextKey).(encoding)
+	if !ok {
+		return defaultEncoding
+	}
+	return enc
+}
+
+// The negotiateContent middleware chooses the encoding of the response from
+// the request's Accept header, and adds it to the request context for
+// app.writeResponse. If none of the accepted media types are supported, a 406
+// Not Acceptable response is sent before the request is handled, so that no
+// changes are made that the client can't be told about.
+func (app *application) negotiateContent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+
+		enc, ok := negotiate(r.Header.Get("Accept"))
+		if !ok {
+			app.notAcceptableResponse(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), encodingContextKey, enc)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// writeResponse encodes the data in the format chosen by content negotiation,
+// then prepares and sends the response. It is the same as app.writeJSON for
+// JSON responses, which are the default.
+//
+// The other formats are encoded from the data's JSON representation, so they
+// have the same field names. XML documents have a <response> root element.
+// CSV and NDJSON responses contain the records of a collection, or the single
+// resource of other responses. See codec.Rows for details.
+//
+// If the headers have an ETag, the variant for the encoding is added to it.
+// See encoding.etag.
+func (app *application) writeResponse(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	enc := app.contextGetEncoding(r)
+
+	if tag := headers.Get("ETag"); tag != "" {
+		headers.Set("ETag", enc.etag(tag))
+	}
+
+	if enc.mediaType == mediaTypeJSON && !enc.compact {
+		return app.writeJSON(w, status, data, headers)
+	}
+
+	var (
+		body []byte
+		err  error
+	)
+
+	if enc.mediaType == mediaTypeJSON {
+		body, err = json.Marshal(data)
+		body = append(body, '\n')
+	} else {
+		var doc any
+		doc, err = codec.Normalize(data)
+		if err != nil {
+			return err
+		}
+
+		switch enc.mediaType {
+		case mediaTypeXML:
+			body, err = codec.MarshalXML("response", doc)
+		case mediaTypeMsgpack:
+			body, err = codec.MarshalMsgpack(doc)
+		case mediaTypeCSV:
+			body, err = codec.MarshalCSV(doc)
+		case mediaTypeNDJSON:
+			body, err = codec.MarshalNDJSON(doc)
+		default:
+			err = fmt.Errorf("no encoder for media type %q", enc.mediaType)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for k, v := range headers {
+		w.Header()[k] = v
+	}
+
+	if headers.Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", enc.mediaType)
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+
+	return nil
+}
+
+// readBody reads the request body as JSON, or converts it to JSON from the
+// format given by its Content-Type header. XML and MessagePack bodies are
+// supported, as well as JSON.
+//
+// Bodies of other media types are read as JSON, as they were before other
+// formats were supported, so that existing clients that send another
+// Content-Type keep working. If the -strict-content-type flag is set, an
+// errUnsupportedMediaType error is returned for them instead.
+func (app *application) readBody(r *http.Request) (io.Reader, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil && r.Header.Get("Content-Type") != "" {
+		if app.config.strictContentType {
+			return nil, errUnsupportedMediaType
+		}
+		return r.Body, nil
+	}
+	if alias, ok := mediaTypeAliases[mediaType]; ok && !strings.Contains(mediaType, "*") {
+		mediaType = alias
+	}
+
+	var (
+		decode func([]byte) (any, error)
+		format string
+	)
+
+	switch mediaType {
+	case "", mediaTypeJSON:
+		return r.Body, nil
+	case mediaTypeXML:
+		decode, format = codec.UnmarshalXML, "XML"
+	case mediaTypeMsgpack:
+		decode, format = codec.UnmarshalMsgpack, "MessagePack"
+	default:
+		if app.config.strictContentType {
+			return nil, errUnsupportedMediaType
+		}
+		return r.Body, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, fmt.Errorf("body must not exceed %d bytes", maxBytesError.Limit)
+		}
+		return nil, err
+	}
+	if len(body) == 0 {
+		return nil, errors.New("request body must not be empty")
+	}
+
+	doc, err := decode(body)
+	if err != nil {
+		return nil, fmt.Errorf("body contains badly-formed %s", format)
+	}
+
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(js), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   encoding
+		wantOK bool
+	}{
+		{"No header", "", encoding{mediaType: mediaTypeJSON}, true},
+		{"JSON", "application/json", encoding{mediaType: mediaTypeJSON}, true},
+		{"Compact JSON", "application/json; pretty=false", encoding{mediaType: mediaTypeJSON, compact: true}, true},
+		{"Wildcard", "*/*", encoding{mediaType: mediaTypeJSON}, true},
+		{"Text wildcard", "text/*", encoding{mediaType: mediaTypeCSV}, true},
+		{"Alias", "text/xml", encoding{mediaType: mediaTypeXML}, true},
+		{"Quality", "application/json;q=0.5, application/msgpack", encoding{mediaType: mediaTypeMsgpack}, true},
+		{"First of equal quality", "text/csv, application/xml", encoding{mediaType: mediaTypeCSV}, true},
+		{"Unsupported types skipped", "text/html, application/x-ndjson;q=0.1", encoding{mediaType: mediaTypeNDJSON}, true},
+		{"Problem details", "application/problem+json", encoding{mediaType: mediaTypeJSON, problem: true}, true},
+		{"Problem details with XML", "application/xml, application/problem+json", encoding{mediaType: mediaTypeXML, problem: true}, true},
+		{"Refused problem details", "application/problem+json;q=0, application/json", encoding{mediaType: mediaTypeJSON}, true},
+		{"Refused type", "application/json;q=0", encoding{}, false},
+		{"Refused type with wildcard", "application/json;q=0, */*", encoding{mediaType: mediaTypeXML}, true},
+		{"Refused alias with wildcard", "text/xml;q=0, application/json;q=0, application/*", encoding{mediaType: mediaTypeMsgpack}, true},
+		{"Refused wildcard", "text/csv;q=0, text/*", encoding{}, false},
+		{"Unsupported", "image/png", encoding{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := negotiate(tt.accept)
+			assert.Equal(t, ok, tt.wantOK)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	app := &application{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		config: config{env: "testing"},
+	}
+
+	// The routes can only be built once per process, since they publish
+	// metrics, so the middleware wraps the handler directly.
+	handler := app.negotiateContent(http.HandlerFunc(app.healthcheck))
+
+	tests := []struct {
+		name        string
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"XML", "application/xml", http.StatusOK, mediaTypeXML, "<response><status>available</status>"},
+		{"CSV", "text/csv", http.StatusOK, mediaTypeCSV, "environment,version\ntesting,"},
+		{"Not acceptable", "image/png", http.StatusNotAcceptable, mediaTypeJSON, `"error"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/healthcheck", nil)
+			req.Header.Set("Accept", tt.accept)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, rr.Code, tt.status)
+			assert.Equal(t, rr.Header().Get("Content-Type"), tt.contentType)
+			assert.StringContains(t, rr.Body.String(), tt.body)
+		})
+	}
+}
+
+func TestEncodingETag(t *testing.T) {
+	tests := []struct {
+		name string
+		enc  encoding
+		want string
+	}{
+		{"JSON", encoding{mediaType: mediaTypeJSON}, `"3"`},
+		{"Compact JSON", encoding{mediaType: mediaTypeJSON, compact: true}, `"3-compact"`},
+		{"XML", encoding{mediaType: mediaTypeXML}, `"3-xml"`},
+		{"MessagePack", encoding{mediaType: mediaTypeMsgpack, problem: true}, `"3-msgpack"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.enc.etag(etag(3)), tt.want)
+		})
+	}
+}
+
+func TestReadBodyContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		strict      bool
+		wantErr     error
+	}{
+		{"JSON", "application/json", false, nil},
+		{"No Content-Type", "", true, nil},
+		{"Unknown type", "text/plain", false, nil},
+		{"Form", "application/x-www-form-urlencoded", false, nil},
+		{"Malformed", "text/", false, nil},
+		{"Unknown type, strict", "text/plain", true, errUnsupportedMediaType},
+		{"Malformed, strict", "text/", true, errUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{config: config{strictContentType: tt.strict}}
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/movies", strings.NewReader(`{"title":"Heat"}`))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			body, err := app.readBody(req)
+			assert.Equal(t, errors.Is(err, tt.wantErr), true)
+			if tt.wantErr == nil {
+				js, _ := io.ReadAll(body)
+				assert.Equal(t, string(js), `{"title":"Heat"}`)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+// listPeople handles GET requests to the /v1/people endpoint. People can be
+// filtered by the "name" query parameter, which matches the start of their
+// names, ignoring case. Results are sorted and paginated by page number, like
+// movies.
+func (app *application) listPeople(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Name = app.readQueryString(qs, "name", "")
+	input.Filters.Page = app.readQueryInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readQueryInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readQueryString(qs, "sort", "name")
+	input.Filters.SortSafelist = []string{"id", "name", "birth_year", "-id", "-name", "-birth_year"}
+
+	data.ValidateFilters(v, input.Filters)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	people, metadata, err := app.models.People.GetAll(input.Name, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	if link := pageLinkHeader(r, metadata, nil); link != "" {
+		headers.Set("Link", link)
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"people": people, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createPerson handles POST requests to the /v1/people endpoint. Request
+// bodies are validated by data.ValidatePerson.
+func (app *application) createPerson(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name      string `json:"name"`
+		BirthYear int32  `json:"birth_year"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	person := &data.Person{
+		Name:      input.Name,
+		BirthYear: input.BirthYear,
+	}
+
+	v := validator.New()
+	data.ValidatePerson(v, person)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.People.Insert(person)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/people/%d", person.ID))
+	headers.Set("ETag", etag(person.Version))
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"person": person}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showPerson handles GET requests to the /v1/people/:id endpoint. The response
+// includes the person's filmography, in a "credits" section. The ETag header
+// can be used with If-Match when updating the person. If-None-Match isn't
+// supported, because the filmography can change while the version doesn't.
+func (app *application) showPerson(w http.ResponseWriter, r *http.Request) {
+	person, ok := app.readPerson(w, r)
+	if !ok {
+		return
+	}
+
+	credits, err := app.models.Credits.GetForPerson(person.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(person.Version))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"person": person, "credits": credits}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updatePerson handles PATCH requests to the /v1/people/:id endpoint. Fields
+// that are omitted from the request body are left unchanged. A birth_year of
+// 0 clears the person's birth year.
+//
+// If the request has an If-Match header, it must match the ETag of the current
+// version of the person, or a 412 Precondition Failed is sent.
+func (app *application) updatePerson(w http.ResponseWriter, r *http.Request) {
+	person, ok := app.readPerson(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.preconditionsMet(w, r, person.Version) {
+		return
+	}
+
+	var input struct {
+		Name      *string `json:"name"`
+		BirthYear *int32  `json:"birth_year"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.Name != nil {
+		person.Name = *input.Name
+	}
+	if input.BirthYear != nil {
+		person.BirthYear = *input.BirthYear
+	}
+
+	v := validator.New()
+	data.ValidatePerson(v, person)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.People.Update(person)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(person.Version))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"person": person}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deletePerson handles DELETE requests to the /v1/people/:id endpoint. Unlike
+// movies, people are deleted permanently, along with their credits.
+//
+// If the request has an If-Match header, it must match the ETag of the current
+// version of the person, or a 412 Precondition Failed is sent. If the person
+// is updated between being fetched and being deleted, a 409 Conflict is sent,
+// or a 412 if the request was conditional.
+func (app *application) deletePerson(w http.ResponseWriter, r *http.Request) {
+	person, ok := app.readPerson(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.preconditionsMet(w, r, person.Version) {
+		return
+	}
+
+	err := app.models.People.Delete(person)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "person successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readPerson fetches the person with the ID in the request's URL. If there is
+// no such person, or the fetch fails, an error response is sent, and ok is
+// false.
+func (app *application) readPerson(w http.ResponseWriter, r *http.Request) (person *data.Person, ok bool) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	person, err = app.models.People.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return person, true
+}
+
+// listMovieCredits handles GET requests to the /v1/movies/:id/credits endpoint.
+// Credits are listed in billing order, with the names of the people credited.
+// Movies in the trash have no credits endpoint, like they have no details.
+func (app *application) listMovieCredits(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+
+	credits, err := app.models.Credits.GetForMovie(movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"credits": credits}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// replaceMovieCredits handles PUT requests to the /v1/movies/:id/credits
+// endpoint. The request body has a "credits" array, which replaces all of the
+// movie's credits. Credits are validated by data.ValidateCredits, and must
+// refer to existing people. If the movie is moved to the trash or purged
+// while the request is being handled, a 404 is sent.
+func (app *application) replaceMovieCredits(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Credits []struct {
+			PersonID     int64  `json:"person_id"`
+			Role         string `json:"role"`
+			Character    string `json:"character"`
+			BillingOrder int    `json:"billing_order"`
+		} `json:"credits"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	credits := make([]data.Credit, len(input.Credits))
+	for i, c := range input.Credits {
+		credits[i] = data.Credit{
+			PersonID:     c.PersonID,
+			Role:         c.Role,
+			Character:    c.Character,
+			BillingOrder: c.BillingOrder,
+		}
+	}
+
+	v := validator.New()
+	data.ValidateCredits(v, credits)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Credits.Replace(movie.ID, credits)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownPerson):
+			v.AddErrorCode("credits", validator.CodeNotFound, "must only refer to existing people")
+			app.failedValidationResponse(w, r, v)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	credits, err = app.models.Credits.GetForMovie(movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"credits": credits}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/i18n"
+)
+
+// mediaTypeProblemJSON is the media type of RFC 9457 problem details.
+const mediaTypeProblemJSON = "application/problem+json"
+
+// A problemType identifies a kind of error response. Its slug is appended to
+// the -problem-type-base flag to form the "type" member of problem details,
+// and its title is a short, human-readable summary that is the same for every
+// occurrence of the problem.
+type problemType struct {
+	slug  string
+	title string
+}
+
+// key returns the key of the problem's detail message in the i18n catalogues.
+// The key of its title has the suffix ".title".
+func (pt problemType) key() string {
+	return "problem." + pt.slug
+}
+
+// The problem types of the response helpers in errors.go.
+var (
+	problemServerError            = problemType{"server-error", "Internal server error"}
+	problemNotFound               = problemType{"not-found", "Resource not found"}
+	problemMethodNotAllowed       = problemType{"method-not-allowed", "Method not allowed"}
+	problemBadRequest             = problemType{"bad-request", "Malformed request"}
+	problemValidation             = problemType{"validation-failed", "Validation failed"}
+	problemUnsupportedMediaType   = problemType{"unsupported-media-type", "Unsupported media type"}
+	problemNotAcceptable          = problemType{"not-acceptable", "Not acceptable"}
+	problemBodyTooLarge           = problemType{"body-too-large", "Request body too large"}
+	problemEditConflict           = problemType{"edit-conflict", "Edit conflict"}
+	problemPreconditionFailed     = problemType{"precondition-failed", "Precondition failed"}
+	problemPreconditionRequired   = problemType{"precondition-required", "Precondition required"}
+	problemRateLimitExceeded      = problemType{"rate-limit-exceeded", "Rate limit exceeded"}
+	problemInvalidCredentials     = problemType{"invalid-credentials", "Invalid credentials"}
+	problemInvalidToken           = problemType{"invalid-token", "Invalid authentication token"}
+	problemAuthenticationRequired = problemType{"authentication-required", "Authentication required"}
+	problemActivationRequired     = problemType{"activation-required", "Activation required"}
+	problemPermissionRequired     = problemType{"permission-required", "Permission required"}
+	problemNotOwner               = problemType{"not-owner", "Not the owner"}
+)
+
+// wantProblem reports whether an error response should be sent as problem
+// details, rather than in an {"error": ...} envelope. Problem details are
+// sent if the -problem-details flag is set, or if the client accepts
+// application/problem+json.
+func (app *application) wantProblem(r *http.Request) bool {
+	return app.config.problems.enabled || app.contextGetEncoding(r).problem
+}
+
+// problemDetails returns the RFC 9457 problem details object of an error
+// response.
+//
+// If the -problem-type-base flag isn't set, the type is "about:blank" and the
+// title is the status text, as the RFC requires. The instance is the path of
+// the request, and the request ID is included as an extension member, so that
+// the response can be matched with the server's logs. Validation errors are
+// included in an "errors" extension member, in the format chosen by
+// app.failedValidationResponse. The title and detail are translated into the
+// request's locale, like the messages of other error responses.
+func (app *application) problemDetails(r *http.Request, status int, pt problemType, message any) envelope {
+	locale := app.contextGetLocale(r)
+
+	p := envelope{
+		"type":     "about:blank",
+		"title":    http.StatusText(status),
+		"status":   status,
+		"instance": r.URL.Path,
+	}
+
+	if base := app.config.problems.typeBase; base != "" {
+		p["type"] = base + pt.slug
+		p["title"], _ = i18n.Translate(locale, pt.key()+".title", pt.title, nil)
+	}
+
+	switch msg := message.(type) {
+	case string:
+		p["detail"] = msg
+	case error:
+		p["detail"] = msg.Error()
+	case map[string]string, map[string][]validator.FieldError:
+		p["detail"] = i18n.NewMessage(problemValidation.key(), "the request contains invalid fields").In(locale)
+		p["errors"] = msg
+	default:
+		p["detail"] = fmt.Sprintf("%v", msg)
+	}
+
+	if id := app.contextGetRequestID(r); id != "" {
+		p["request_id"] = id
+	}
+
+	return p
+}
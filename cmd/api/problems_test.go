@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+func TestProblemDetails(t *testing.T) {
+	app := &application{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	app.config.problems.typeBase = "https://api.example.com/problems/"
+
+	handler := app.requestID(app.negotiateContent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := validator.New()
+		v.CheckCode(false, "title", validator.CodeRequired, "must be provided")
+		app.failedValidationResponse(w, r, v)
+	})))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/movies?fields=id", nil)
+	req.Header.Set("Accept", "application/problem+json")
+	req.Header.Set("X-Request-ID", "abc-123")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusUnprocessableEntity)
+	assert.Equal(t, rr.Header().Get("Content-Type"), mediaTypeProblemJSON)
+	assert.Equal(t, rr.Header().Get("X-Request-ID"), "abc-123")
+
+	var got struct {
+		Type      string            `json:"type"`
+		Title     string            `json:"title"`
+		Status    int               `json:"status"`
+		Detail    string            `json:"detail"`
+		Instance  string            `json:"instance"`
+		RequestID string            `json:"request_id"`
+		Errors    map[string]string `json:"errors"`
+	}
+	err := json.NewDecoder(rr.Body).Decode(&got)
+	assert.IsNil(t, err)
+
+	assert.Equal(t, got.Type, "https://api.example.com/problems/validation-failed")
+	assert.Equal(t, got.Title, "Validation failed")
+	assert.Equal(t, got.Status, http.StatusUnprocessableEntity)
+	assert.Equal(t, got.Detail, "the request contains invalid fields")
+	assert.Equal(t, got.Instance, "/v1/movies")
+	assert.Equal(t, got.RequestID, "abc-123")
+	assert.Equal(t, got.Errors["title"], "must be provided")
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	app := &application{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	handler := app.requestID(app.negotiateContent(http.HandlerFunc(app.notFoundResponse)))
+
+	tests := []struct {
+		name        string
+		enabled     bool
+		contentType string
+		body        string
+	}{
+		{"Default", false, "application/json", `"error": "the requested resource cannot be found"`},
+		{"Problem details flag", true, mediaTypeProblemJSON, `"type": "about:blank"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app.config.problems.enabled = tt.enabled
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/movies/0", nil)
+			req.Header.Set("X-Request-ID", "bad id\n")
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, rr.Code, http.StatusNotFound)
+			assert.Equal(t, rr.Header().Get("Content-Type"), tt.contentType)
+			assert.StringContainsMatch(t, rr.Header().Get("X-Request-ID"), regexp.MustCompile("^[0-9a-f]{32}$"))
+			assert.StringContains(t, rr.Body.String(), tt.body)
+		})
+	}
+}
+
+func TestDetailedValidationErrors(t *testing.T) {
+	app := &application{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	handler := app.negotiateContent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := validator.New()
+		v.CheckCode(false, validator.Path("genres", 2), validator.CodeDuplicate, "must not contain duplicate values", "value", "drama")
+		app.failedValidationResponse(w, r, v)
+	}))
+
+	tests := []struct {
+		name    string
+		prefer  string
+		applied string
+		body    string
+	}{
+		{"Compatible", "", "", `{"error":{"genres":"must not contain duplicate values"}}`},
+		{"Detailed", "respond-async, errors=detailed", "errors=detailed",
+			`{"error":{"genres[2]":[{"code":"duplicate","message":"must not contain duplicate values","params":{"value":"drama"}}]}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/movies", nil)
+			req.Header.Set("Accept", "application/json; pretty=false")
+			req.Header.Set("Prefer", tt.prefer)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, rr.Code, http.StatusUnprocessableEntity)
+			assert.Equal(t, rr.Header().Get("Preference-Applied"), tt.applied)
+			assert.Equal(t, rr.Body.String(), tt.body+"\n")
+		})
+	}
+}
+
+func TestLocalizedErrors(t *testing.T) {
+	app := &application{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"Error helper", app.notFoundResponse, `{"error":"no se encuentra el recurso solicitado"}`},
+		{"Validation", func(w http.ResponseWriter, r *http.Request) {
+			v := validator.New()
+			v.CheckCode(false, "runtime", validator.CodeOutOfRange, "must be a positive integer", "min", 1)
+			v.Check(false, "email", "must be a valid email adress")
+			app.failedValidationResponse(w, r, v)
+		}, `{"error":{"email":"must be a valid email adress","runtime":"debe ser como mínimo 1"}}`},
+		{"Untranslated", func(w http.ResponseWriter, r *http.Request) {
+			app.errorResponse(w, r, http.StatusBadRequest, problemBadRequest, "body contains badly-formed JSON")
+		}, `{"error":"body contains badly-formed JSON"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := app.selectLocale(app.negotiateContent(tt.handler))
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+			req.Header.Set("Accept", "application/json; pretty=false")
+			req.Header.Set("Accept-Language", "es-ES, en;q=0.5")
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, rr.Header().Get("Content-Language"), "es")
+			assert.Equal(t, rr.Body.String(), tt.body+"\n")
+		})
+	}
+}
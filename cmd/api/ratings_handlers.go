@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+// rateMovie handles PUT requests to the /v1/movies/:id/rating endpoint. The
+// request body has a "rating" from 1 to 10, which sets the user's rating of
+// the movie, or replaces their previous rating. A 201 is sent if the user
+// hadn't rated the movie before, and a 200 otherwise.
+func (app *application) rateMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Rating int `json:"rating"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	data.ValidateRating(v, input.Rating)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	rating := &data.Rating{MovieID: id, Rating: input.Rating}
+
+	created, err := app.models.Ratings.Set(user.ID, rating)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	err = app.writeResponse(w, r, status, envelope{"rating": rating}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unrateMovie handles DELETE requests to the /v1/movies/:id/rating endpoint.
+// It removes the user's rating of the movie. A 404 is sent if the user hasn't
+// rated the movie.
+func (app *application) unrateMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Ratings.Delete(user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "rating successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+// recommendation is the representation of a recommended movie in a response.
+// The movie is restricted to the sparse fieldset that the client asked for,
+// if any, but the score is always included.
+type recommendation struct {
+	Movie movieResource `json:"movie"`
+	Score float64       `json:"score"`
+}
+
+// similarMovies handles GET requests to the /v1/movies/:id/similar endpoint.
+// Up to "limit" movies are returned, 10 by default, ranked by how many genres
+// they share with the movie, how close their release years are, and how many
+// users liked both of them. See data.RecommendationModel.Similar.
+func (app *application) similarMovies(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+
+	limit, ok := app.readRecommendationLimit(w, r)
+	if !ok {
+		return
+	}
+
+	recs, err := app.models.Recommendations.Similar(movie.ID, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movies": app.recommendationsResponse(r, recs)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listRecommendations handles GET requests to the /v1/users/me/recommendations
+// endpoint. Up to "limit" movies are returned, 10 by default, based on the
+// movies the authenticated user liked and the movies in their lists. Movies
+// the user has already rated, listed, or watched aren't recommended. See
+// data.RecommendationModel.ForUser.
+func (app *application) listRecommendations(w http.ResponseWriter, r *http.Request) {
+	limit, ok := app.readRecommendationLimit(w, r)
+	if !ok {
+		return
+	}
+
+	recs, err := app.models.Recommendations.ForUser(app.contextGetUser(r).ID, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movies": app.recommendationsResponse(r, recs)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readRecommendationLimit reads the "limit" query parameter, which must be
+// between 1 and 50. If it is invalid, a 422 is sent, and ok is false.
+func (app *application) readRecommendationLimit(w http.ResponseWriter, r *http.Request) (limit int, ok bool) {
+	v := validator.New()
+
+	limit = app.readQueryInt(r.URL.Query(), "limit", 10, v)
+
+	v.CheckCode(limit >= 1, "limit", validator.CodeOutOfRange, "must be at least 1", "min", 1)
+	v.CheckCode(limit <= 50, "limit", validator.CodeOutOfRange, "must be no more than 50", "max", 50)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return 0, false
+	}
+
+	return limit, true
+}
+
+// recommendationsResponse wraps recommended movies for a response, like
+// moviesResponse.
+func (app *application) recommendationsResponse(r *http.Request, recs []*data.Recommendation) []recommendation {
+	res := make([]recommendation, len(recs))
+	for i, rec := range recs {
+		res[i] = recommendation{Movie: app.movieResponse(r, rec.Movie), Score: rec.Score}
+	}
+	return res
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kvnloughead/greenlight/internal/assert"
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+func TestRecommendationsResponse(t *testing.T) {
+	app := &application{}
+	recs := []*data.Recommendation{
+		{Movie: &data.Movie{ID: 4, Title: "Heat", Year: 1995, Genres: []string{"crime"}}, Score: 0.75},
+	}
+
+	r := httptest.NewRequest("GET", "/v1/movies/3/similar?fields=title&links=true", nil)
+	js, err := json.Marshal(app.recommendationsResponse(r, recs))
+	assert.IsNil(t, err)
+
+	var got []map[string]any
+	assert.IsNil(t, json.Unmarshal(js, &got))
+	assert.Equal(t, len(got), 1)
+
+	movie := got[0]["movie"].(map[string]any)
+	_, hasYear := movie["year"]
+	_, hasLinks := movie["_links"]
+	assert.Equal(t, movie["title"], any("Heat"))
+	assert.Equal(t, hasYear, false)
+	assert.Equal(t, hasLinks, true)
+	assert.Equal(t, got[0]["score"], any(0.75))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+// listMovieReleases handles GET requests to the /v1/movies/:id/releases
+// endpoint. The movie's releases are listed, sorted by country and date.
+func (app *application) listMovieReleases(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+
+	releases, err := app.models.Releases.GetForMovie(movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"releases": releases}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// replaceMovieReleases handles PUT requests to the /v1/movies/:id/releases
+// endpoint. The request body has a "releases" array, which replaces all of the
+// movie's releases. Each release has a "country", a "type", a "release_date"
+// as "YYYY-MM-DD", and optionally a "certification". Countries and
+// certifications are uppercased, and then the releases are validated by
+// data.ValidateReleases. If the movie is moved to the trash or purged while
+// the request is being handled, a 404 is sent.
+func (app *application) replaceMovieReleases(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Releases []struct {
+			Country       string    `json:"country"`
+			Type          string    `json:"type"`
+			ReleaseDate   data.Date `json:"release_date"`
+			Certification string    `json:"certification"`
+		} `json:"releases"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	releases := make([]data.Release, len(input.Releases))
+	for i, rel := range input.Releases {
+		releases[i] = data.Release{
+			Country:       strings.ToUpper(strings.TrimSpace(rel.Country)),
+			Type:          strings.ToLower(strings.TrimSpace(rel.Type)),
+			Date:          rel.ReleaseDate,
+			Certification: strings.ToUpper(strings.TrimSpace(rel.Certification)),
+		}
+	}
+
+	v := validator.New()
+	data.ValidateReleases(v, releases)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Releases.Replace(movie.ID, releases)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	releases, err = app.models.Releases.GetForMovie(movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"releases": releases}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
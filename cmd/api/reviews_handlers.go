@@ -0,0 +1,477 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+// moderatedReview is the representation of a review in moderation responses.
+// Unlike public responses, it includes when the review was hidden, and its
+// unresolved reports.
+type moderatedReview struct {
+	*data.Review
+	HiddenAt    *time.Time          `json:"hidden_at"`
+	ReportCount int                 `json:"report_count"`
+	Reports     []data.ReviewReport `json:"reports"`
+}
+
+// listMovieReviews handles GET requests to the /v1/movies/:id/reviews
+// endpoint. Hidden reviews aren't listed. Reviews are sorted by "created_at"
+// or "updated_at", newest first by default, and paginated by page number,
+// like movies.
+func (app *application) listMovieReviews(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+
+	var filters data.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters.Page = app.readQueryInt(qs, "page", 1, v)
+	filters.PageSize = app.readQueryInt(qs, "page_size", 20, v)
+	filters.Sort = app.readQueryString(qs, "sort", "-created_at")
+	filters.SortSafelist = []string{"id", "created_at", "updated_at", "-id", "-created_at", "-updated_at"}
+
+	data.ValidateFilters(v, filters)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	reviews, metadata, err := app.models.Reviews.GetForMovie(movie.ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	if link := pageLinkHeader(r, metadata, nil); link != "" {
+		headers.Set("Link", link)
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"reviews": reviews, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createReview handles POST requests to the /v1/movies/:id/reviews endpoint.
+// The review's author is the authenticated user. Request bodies are
+// validated by data.ValidateReview.
+func (app *application) createReview(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Body    string `json:"body"`
+		Spoiler bool   `json:"spoiler"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	review := &data.Review{
+		MovieID: movie.ID,
+		Author:  data.ReviewAuthor{ID: user.ID, Name: user.Name},
+		Body:    input.Body,
+		Spoiler: input.Spoiler,
+	}
+
+	v := validator.New()
+	data.ValidateReview(v, review)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Reviews.Insert(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/reviews/%d", review.ID))
+	headers.Set("ETag", etag(review.Version))
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"review": review}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showReview handles GET requests to the /v1/reviews/:id endpoint. Hidden
+// reviews aren't found. Like movies, reviews have an ETag header, and
+// conditional requests are supported.
+func (app *application) showReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := app.readReview(w, r)
+	if !ok {
+		return
+	}
+
+	if app.notModified(w, r, etag(review.Version)) {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(review.Version))
+
+	err := app.writeResponse(w, r, http.StatusOK, envelope{"review": review}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateReview handles PATCH requests to the /v1/reviews/:id endpoint. Only
+// the review's author can update it. Fields that are omitted from the request
+// body are left unchanged.
+//
+// If the request has an If-Match header, it must match the ETag of the current
+// version of the review, or a 412 Precondition Failed is sent.
+func (app *application) updateReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := app.readOwnReview(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.preconditionsMet(w, r, review.Version) {
+		return
+	}
+
+	var input struct {
+		Body    *string `json:"body"`
+		Spoiler *bool   `json:"spoiler"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.Body != nil {
+		review.Body = *input.Body
+	}
+	if input.Spoiler != nil {
+		review.Spoiler = *input.Spoiler
+	}
+
+	v := validator.New()
+	data.ValidateReview(v, review)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Reviews.Update(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(review.Version))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"review": review}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteReview handles DELETE requests to the /v1/reviews/:id endpoint. Only
+// the review's author can delete it, and it is deleted permanently.
+//
+// If the request has an If-Match header, it must match the ETag of the current
+// version of the review, or a 412 Precondition Failed is sent. If the review
+// is edited between being fetched and being deleted, a 409 Conflict is sent,
+// or a 412 if the request was conditional.
+func (app *application) deleteReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := app.readOwnReview(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.preconditionsMet(w, r, review.Version) {
+		return
+	}
+
+	err := app.models.Reviews.Delete(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "review successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// reportReview handles POST requests to the /v1/reviews/:id/report endpoint.
+// The request body is an object, with an optional "reason". Reported reviews
+// are listed in the
+// moderation queue. Reporting a review again has no further effect until a
+// moderator resolves the reports, so a 202 is always sent.
+func (app *application) reportReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := app.readReview(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	data.ValidateReportReason(v, input.Reason)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Reviews.Report(review.ID, user.ID, input.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusAccepted, envelope{"message": "review reported to the moderators"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listModerationQueue handles GET requests to the /v1/moderation/reviews
+// endpoint. The "status" query parameter selects the "reported" reviews (the
+// default), which are visible and have unresolved reports, or the "hidden"
+// reviews. Reported reviews are sorted by their number of reports, most
+// first, by default. Each review includes its unresolved reports.
+func (app *application) listModerationQueue(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Status = app.readQueryString(qs, "status", "reported")
+	input.Filters.Page = app.readQueryInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readQueryInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readQueryString(qs, "sort", "-report_count")
+	input.Filters.SortSafelist = []string{"id", "created_at", "report_count", "-id", "-created_at", "-report_count"}
+
+	statuses := []string{"reported", "hidden"}
+	v.CheckCode(validator.PermittedValue(input.Status, statuses...), "status",
+		validator.CodeNotPermitted, "must be reported or hidden", "permitted", statuses)
+	data.ValidateFilters(v, input.Filters)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	reviews, metadata, err := app.models.Reviews.GetForModeration(input.Status == "hidden", input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	ids := make([]int64, len(reviews))
+	for i, review := range reviews {
+		ids[i] = review.ID
+	}
+
+	reports, err := app.models.Reviews.GetReports(ids)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	queue := make([]moderatedReview, len(reviews))
+	for i, review := range reviews {
+		queue[i] = newModeratedReview(review, reports[review.ID])
+	}
+
+	headers := make(http.Header)
+	if link := pageLinkHeader(r, metadata, nil); link != "" {
+		headers.Set("Link", link)
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"reviews": queue, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// hideReview handles POST requests to the /v1/moderation/reviews/:id/hide
+// endpoint. The review is hidden from everyone but moderators, and its
+// reports are resolved.
+func (app *application) hideReview(w http.ResponseWriter, r *http.Request) {
+	app.moderateReview(w, r, true)
+}
+
+// restoreReview handles POST requests to the
+// /v1/moderation/reviews/:id/restore endpoint. A hidden review is made
+// visible again, and the reports of a visible review are dismissed.
+func (app *application) restoreReview(w http.ResponseWriter, r *http.Request) {
+	app.moderateReview(w, r, false)
+}
+
+// moderateReview hides or restores the review with the ID in the request's
+// URL, and writes the moderated review to the response. It is shared by the
+// hide and restore handlers.
+func (app *application) moderateReview(w http.ResponseWriter, r *http.Request, hidden bool) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Reviews.SetHidden(id, hidden)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	review, err := app.models.Reviews.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"review": newModeratedReview(review, nil)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// newModeratedReview wraps a review and its unresolved reports for a
+// moderation response.
+func newModeratedReview(review *data.Review, reports []data.ReviewReport) moderatedReview {
+	if reports == nil {
+		reports = []data.ReviewReport{}
+	}
+	return moderatedReview{
+		Review:      review,
+		HiddenAt:    review.HiddenAt,
+		ReportCount: review.ReportCount,
+		Reports:     reports,
+	}
+}
+
+// readReview fetches the review with the ID in the request's URL. If there is
+// no such review, or it is hidden, or the fetch fails, an error response is
+// sent, and ok is false.
+func (app *application) readReview(w http.ResponseWriter, r *http.Request) (review *data.Review, ok bool) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	review, err = app.models.Reviews.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if review.HiddenAt != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return review, true
+}
+
+// readOwnReview is like readReview, but it also sends a 403 if the review
+// wasn't written by the authenticated user.
+func (app *application) readOwnReview(w http.ResponseWriter, r *http.Request) (review *data.Review, ok bool) {
+	review, ok = app.readReview(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if review.Author.ID != app.contextGetUser(r).ID {
+		app.notOwnerResponse(w, r)
+		return nil, false
+	}
+
+	return review, true
+}
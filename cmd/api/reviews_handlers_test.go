@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kvnloughead/greenlight/internal/assert"
+	"github.com/kvnloughead/greenlight/internal/data"
+)
+
+func TestReviewRepresentations(t *testing.T) {
+	hiddenAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	review := &data.Review{
+		ID:          7,
+		MovieID:     3,
+		Author:      data.ReviewAuthor{ID: 2, Name: "Alice"},
+		Body:        "A moving story.",
+		HiddenAt:    &hiddenAt,
+		ReportCount: 2,
+	}
+
+	t.Run("Public", func(t *testing.T) {
+		js, err := json.Marshal(review)
+		assert.IsNil(t, err)
+
+		var got map[string]any
+		assert.IsNil(t, json.Unmarshal(js, &got))
+
+		_, hasHiddenAt := got["hidden_at"]
+		_, hasReportCount := got["report_count"]
+		assert.Equal(t, hasHiddenAt, false)
+		assert.Equal(t, hasReportCount, false)
+		assert.Equal(t, got["author"].(map[string]any)["name"], any("Alice"))
+	})
+
+	t.Run("Moderation", func(t *testing.T) {
+		reports := []data.ReviewReport{{UserID: 5, Reason: "spoilers"}}
+		js, err := json.Marshal(newModeratedReview(review, reports))
+		assert.IsNil(t, err)
+
+		var got map[string]any
+		assert.IsNil(t, json.Unmarshal(js, &got))
+
+		assert.Equal(t, got["id"], any(float64(7)))
+		assert.Equal(t, got["hidden_at"], any("2024-03-01T12:00:00Z"))
+		assert.Equal(t, got["report_count"], any(float64(2)))
+		assert.Equal(t, len(got["reports"].([]any)), 1)
+	})
+
+	t.Run("Moderation without reports", func(t *testing.T) {
+		js, err := json.Marshal(newModeratedReview(review, nil))
+		assert.IsNil(t, err)
+		assert.StringContains(t, string(js), `"reports":[]`)
+	})
+}
@@ -23,25 +23,177 @@ import (
 //   - POST   /v1/movies								 Create a new movie.
 //     [permissions - movies:write]
 //
+//   - GET    /v1/movies/export					 Stream all movies as CSV, NDJSON, or JSON.
+//     [permissions - movies:read]
+//
+//   - POST   /v1/movies/import					 Import movies from CSV or NDJSON.
+//     [permissions - movies:write]
+//
+//   - GET    /v1/movies/suggest				 Suggest movie titles for type-ahead search.
+//     [permissions - movies:read]
+//
 //   - GET    /v1/movies/:id	  				 Show details of a specific movie.
 //     [permissions - movies:read]
 //
 //   - PATCH  /v1/movies/:id						 Update details of a specific movie.
+//     [permissions - movies:write]
+//
+//   - PUT    /v1/movies/:id						 Replace details of a specific movie.
+//     [permissions - movies:write]
+//
+//   - DELETE /v1/movies/:id	  				 Move a specific movie to the trash.
+//     [permissions - movies:write]
+//
+//   - GET    /v1/movies/trash					 Show details of movies in the trash.
+//     [permissions - movies:write]
+//
+//   - DELETE /v1/movies/trash					 Permanently delete all movies in the trash.
+//     [permissions - movies:purge]
+//
+//   - POST   /v1/movies/:id/restore		 Restore a specific movie from the trash.
+//     [permissions - movies:write]
+//
+//   - PUT    /v1/movies/:id/rating			 Set or change the user's rating of a movie.
+//     [permissions - movies:read]
+//
+//   - DELETE /v1/movies/:id/rating			 Remove the user's rating of a movie.
+//     [permissions - movies:read]
+//
+//   - GET    /v1/movies/:id/reviews		 Show the reviews of a specific movie.
+//     [permissions - movies:read]
+//
+//   - POST   /v1/movies/:id/reviews		 Review a specific movie.
+//     [permissions - movies:read]
+//
+//   - GET    /v1/movies/:id/similar		 Show movies similar to a specific movie.
+//     [permissions - movies:read]
+//
+//   - GET    /v1/movies/:id/translations	 Show the alternate titles of a specific movie.
+//     [permissions - movies:read]
+//
+//   - PUT    /v1/movies/:id/translations	 Replace the alternate titles of a specific movie.
+//     [permissions - movies:write]
+//
+//   - GET    /v1/movies/:id/credits		 Show the cast and crew of a specific movie.
+//     [permissions - movies:read]
+//
+//   - PUT    /v1/movies/:id/credits		 Replace the cast and crew of a specific movie.
+//     [permissions - movies:write]
+//
+//   - GET    /v1/movies/:id/releases		 Show the regional releases of a specific movie.
+//     [permissions - movies:read]
+//
+//   - PUT    /v1/movies/:id/releases		 Replace the regional releases of a specific movie.
+//     [permissions - movies:write]
+//
+//   - GET    /v1/reviews/:id						 Show a specific review.
+//     [permissions - movies:read]
+//
+//   - PATCH  /v1/reviews/:id						 Update the user's own review.
+//     [permissions - movies:read]
+//
+//   - DELETE /v1/reviews/:id						 Delete the user's own review.
+//     [permissions - movies:read]
+//
+//   - POST   /v1/reviews/:id/report		 Report a review to the moderators.
+//     [permissions - movies:read]
+//
+//   - GET    /v1/moderation/reviews		 Show reported or hidden reviews.
+//     [permissions - reviews:moderate]
+//
+//   - POST   /v1/moderation/reviews/:id/hide	 Hide a review and resolve its reports.
+//     [permissions - reviews:moderate]
+//
+//   - POST   /v1/moderation/reviews/:id/restore	 Restore a review and dismiss its reports.
+//     [permissions - reviews:moderate]
+//
+//   - GET    /v1/lists									 Show the user's lists, or another user's public lists.
 //     [permissions - movies:read]
 //
-//   - DELETE /v1/movies/:id	  				 Delete a specific movie.
+//   - POST   /v1/lists									 Create a new list.
 //     [permissions - movies:read]
 //
+//   - GET    /v1/lists/:id							 Show a specific list and its entries.
+//     [permissions - movies:read]
+//
+//   - PATCH  /v1/lists/:id							 Update the user's own list.
+//     [permissions - movies:read]
+//
+//   - DELETE /v1/lists/:id							 Delete the user's own list.
+//     [permissions - movies:read]
+//
+//   - POST   /v1/lists/:id/entries			 Add a movie to the user's own list.
+//     [permissions - movies:read]
+//
+//   - PATCH  /v1/lists/:id/entries/:movie_id	 Update the note of a movie in the user's own list.
+//     [permissions - movies:read]
+//
+//   - DELETE /v1/lists/:id/entries/:movie_id	 Remove a movie from the user's own list.
+//     [permissions - movies:read]
+//
+//   - PUT    /v1/lists/:id/order				 Reorder the movies in the user's own list.
+//     [permissions - movies:read]
+//
+//   - GET    /v1/genres								 Show the genre taxonomy, with movie counts.
+//     [permissions - movies:read]
+//
+//   - POST   /v1/genres								 Add a genre to the taxonomy.
+//     [permissions - genres:write]
+//
+//   - POST   /v1/genres/merge					 Merge one genre into another.
+//     [permissions - genres:write]
+//
+//   - GET    /v1/people								 Show details of a subset of people.
+//     [permissions - people:read]
+//
+//   - POST   /v1/people								 Create a new person.
+//     [permissions - people:write]
+//
+//   - GET    /v1/people/:id						 Show details and filmography of a specific person.
+//     [permissions - people:read]
+//
+//   - PATCH  /v1/people/:id						 Update details of a specific person.
+//     [permissions - people:write]
+//
+//   - DELETE /v1/people/:id						 Delete a specific person and their credits.
+//     [permissions - people:write]
+//
 //   - POST   /v1/users         				 Register a new user.
 //
 //   - PUT    /v1/users/activated     	 Activates a user.
 //
+//   - GET    /v1/users/me							 Show the authenticated user.
+//
+//   - GET    /v1/users/me/diary				 Show the user's diary of watched movies.
+//     [permissions - movies:read]
+//
+//   - POST   /v1/users/me/diary				 Log a watched movie in the user's diary.
+//     [permissions - movies:read]
+//
+//   - GET    /v1/users/me/diary/:id		 Show a specific entry in the user's diary.
+//     [permissions - movies:read]
+//
+//   - PATCH  /v1/users/me/diary/:id		 Update a specific entry in the user's diary.
+//     [permissions - movies:read]
+//
+//   - DELETE /v1/users/me/diary/:id		 Delete a specific entry in the user's diary.
+//     [permissions - movies:read]
+//
+//   - GET    /v1/users/me/stats				 Show the user's viewing statistics for a year.
+//     [permissions - movies:read]
+//
+//   - GET    /v1/users/me/recommendations	 Show movies recommended for the user.
+//     [permissions - movies:read]
+//
 //   - POST   /v1/tokens/activation   	 Generate a new activation token.
 //
 //   - POST   /v1/tokens/authentication  Generate an authentication token.
 //
 //   - GET    /debug/vars                Display application metrics.
 //
+// Routes that respond with movies or users accept a "fields" query parameter,
+// which is validated by the validateFields middleware.
+//
 // This function also sets up custom error handling for scenarios where no
 // route is matched (404 Not Found) and when a method is not allowed for a
 // given route (405 Method Not Allowed), using the custom error handlers
@@ -59,14 +211,89 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheck)
 
 	// The /movies endpoints require either movies:read or movies:write permission
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission(data.MoviesRead, app.listMovies))
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission(data.MoviesWrite, app.createMovie))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission(data.MoviesRead, app.showMovie))
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission(data.MoviesWrite, app.updateMovie))
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission(data.MoviesWrite, app.deleteMovie))
+	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission(data.MoviesRead, app.validateFields(data.MovieFields, app.listMovies)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission(data.MoviesWrite, app.validateFields(data.MovieFields, app.createMovie)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.staticSegments(
+		map[string]http.HandlerFunc{
+			"trash":   app.requirePermission(data.MoviesWrite, app.validateFields(data.MovieFields, app.listTrash)),
+			"export":  app.requirePermission(data.MoviesRead, app.exportMovies),
+			"suggest": app.requirePermission(data.MoviesRead, app.suggestMovies),
+		},
+		app.requirePermission(data.MoviesRead, app.validateFields(data.MovieDetailFields, app.showMovie)),
+	))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission(data.MoviesWrite, app.validateFields(data.MovieFields, app.updateMovie)))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id", app.requirePermission(data.MoviesWrite, app.validateFields(data.MovieFields, app.replaceMovie)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.staticSegments(
+		map[string]http.HandlerFunc{
+			"trash": app.requirePermission(data.MoviesPurge, app.purgeTrash),
+		},
+		app.requirePermission(data.MoviesWrite, app.deleteMovie),
+	))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id", app.staticSegments(
+		map[string]http.HandlerFunc{
+			"import": app.requirePermission(data.MoviesWrite, app.importMovies),
+		},
+		app.methodNotAllowedResponse,
+	))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.requirePermission(data.MoviesWrite, app.validateFields(data.MovieFields, app.restoreMovie)))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/rating", app.requirePermission(data.MoviesRead, app.rateMovie))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/rating", app.requirePermission(data.MoviesRead, app.unrateMovie))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.requirePermission(data.MoviesRead, app.listMovieReviews))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/reviews", app.requirePermission(data.MoviesRead, app.createReview))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/similar", app.requirePermission(data.MoviesRead, app.validateFields(data.MovieFields, app.similarMovies)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/translations", app.requirePermission(data.MoviesRead, app.listMovieTranslations))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/translations", app.requirePermission(data.MoviesWrite, app.replaceMovieTranslations))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/credits", app.requirePermission(data.MoviesRead, app.listMovieCredits))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/credits", app.requirePermission(data.MoviesWrite, app.replaceMovieCredits))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/releases", app.requirePermission(data.MoviesRead, app.listMovieReleases))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/releases", app.requirePermission(data.MoviesWrite, app.replaceMovieReleases))
+
+	// Any user who can read movies can review them, but only the author of a
+	// review can change it.
+	router.HandlerFunc(http.MethodGet, "/v1/reviews/:id", app.requirePermission(data.MoviesRead, app.showReview))
+	router.HandlerFunc(http.MethodPatch, "/v1/reviews/:id", app.requirePermission(data.MoviesRead, app.updateReview))
+	router.HandlerFunc(http.MethodDelete, "/v1/reviews/:id", app.requirePermission(data.MoviesRead, app.deleteReview))
+	router.HandlerFunc(http.MethodPost, "/v1/reviews/:id/report", app.requirePermission(data.MoviesRead, app.reportReview))
+
+	router.HandlerFunc(http.MethodGet, "/v1/moderation/reviews", app.requirePermission(data.ReviewsModerate, app.listModerationQueue))
+	router.HandlerFunc(http.MethodPost, "/v1/moderation/reviews/:id/hide", app.requirePermission(data.ReviewsModerate, app.hideReview))
+	router.HandlerFunc(http.MethodPost, "/v1/moderation/reviews/:id/restore", app.requirePermission(data.ReviewsModerate, app.restoreReview))
+
+	// Any user who can read movies can make lists of them, but only the owner
+	// of a list can change it.
+	router.HandlerFunc(http.MethodGet, "/v1/lists", app.requirePermission(data.MoviesRead, app.listLists))
+	router.HandlerFunc(http.MethodPost, "/v1/lists", app.requirePermission(data.MoviesRead, app.createList))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id", app.requirePermission(data.MoviesRead, app.showList))
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:id", app.requirePermission(data.MoviesRead, app.updateList))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id", app.requirePermission(data.MoviesRead, app.deleteList))
+	router.HandlerFunc(http.MethodPost, "/v1/lists/:id/entries", app.requirePermission(data.MoviesRead, app.addListEntry))
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:id/entries/:movie_id", app.requirePermission(data.MoviesRead, app.updateListEntry))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id/entries/:movie_id", app.requirePermission(data.MoviesRead, app.removeListEntry))
+	router.HandlerFunc(http.MethodPut, "/v1/lists/:id/order", app.requirePermission(data.MoviesRead, app.reorderList))
+
+	router.HandlerFunc(http.MethodGet, "/v1/genres", app.requirePermission(data.MoviesRead, app.listGenres))
+	router.HandlerFunc(http.MethodPost, "/v1/genres", app.requirePermission(data.GenresWrite, app.createGenre))
+	router.HandlerFunc(http.MethodPost, "/v1/genres/merge", app.requirePermission(data.GenresWrite, app.mergeGenres))
+
+	// The /people endpoints require either people:read or people:write permission
+	router.HandlerFunc(http.MethodGet, "/v1/people", app.requirePermission(data.PeopleRead, app.listPeople))
+	router.HandlerFunc(http.MethodPost, "/v1/people", app.requirePermission(data.PeopleWrite, app.createPerson))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id", app.requirePermission(data.PeopleRead, app.showPerson))
+	router.HandlerFunc(http.MethodPatch, "/v1/people/:id", app.requirePermission(data.PeopleWrite, app.updatePerson))
+	router.HandlerFunc(http.MethodDelete, "/v1/people/:id", app.requirePermission(data.PeopleWrite, app.deletePerson))
 
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUser)
-	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUser)
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.validateFields(data.UserFields, app.registerUser))
+	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.validateFields(data.UserFields, app.activateUser))
+
+	// The /users/me endpoints act on the authenticated user's own records.
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", app.requireActivatedUser(app.validateFields(data.UserFields, app.showCurrentUser)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/diary", app.requirePermission(data.MoviesRead, app.listDiaryEntries))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/diary", app.requirePermission(data.MoviesRead, app.createDiaryEntry))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/diary/:id", app.requirePermission(data.MoviesRead, app.showDiaryEntry))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/diary/:id", app.requirePermission(data.MoviesRead, app.updateDiaryEntry))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/diary/:id", app.requirePermission(data.MoviesRead, app.deleteDiaryEntry))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/stats", app.requirePermission(data.MoviesRead, app.showUserStats))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/recommendations", app.requirePermission(data.MoviesRead, app.validateFields(data.MovieFields, app.listRecommendations)))
 
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationToken)
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationToken)
@@ -74,6 +301,26 @@ func (app *application) routes() http.Handler {
 	// Expose application metrics as a JSON response to HTTP request.
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
-	middlewares := alice.New(app.logRequest, app.metrics, app.recoverPanic, app.enableCORS, app.rateLimit, app.authenticate)
+	middlewares := alice.New(app.requestID, app.logRequest, app.metrics, app.selectLocale, app.recoverPanic, app.enableCORS, app.negotiateContent, app.rateLimit, app.authenticate)
 	return middlewares.Then(router)
 }
+
+// The staticSegments helper works around httprouter's inability to register a
+// static path segment alongside a wildcard in the same position. For example,
+// GET /v1/movies/trash and GET /v1/movies/:id can't both be registered.
+//
+// The returned handler should be registered for the wildcard route. It reads
+// the "id" parameter and, if it matches one of the keys in the static map,
+// calls the corresponding handler. Otherwise, the fallback is called.
+func (app *application) staticSegments(static map[string]http.HandlerFunc, fallback http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if next, ok := static[params.ByName("id")]; ok {
+			next(w, r)
+			return
+		}
+
+		fallback(w, r)
+	}
+}
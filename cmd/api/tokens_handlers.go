@@ -29,15 +29,20 @@ func (app *application) createActivationToken(w http.ResponseWriter, r *http.Req
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
 		return
 	}
 
 	v := validator.New()
 	data.ValidateEmail(v, input.Email)
 	if !v.Valid() {
-		v.AddError("email", "no matching email found")
-		app.failedValidationResponse(w, r, v.Errors)
+		v.AddErrorCode("email", validator.CodeNotFound, "no matching email found")
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
@@ -53,8 +58,8 @@ func (app *application) createActivationToken(w http.ResponseWriter, r *http.Req
 	}
 
 	if user.Activated {
-		v.AddError("email", "user already activated")
-		app.failedValidationResponse(w, r, v.Errors)
+		v.AddErrorCode("email", validator.CodeConflict, "user already activated")
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
@@ -67,7 +72,7 @@ func (app *application) createActivationToken(w http.ResponseWriter, r *http.Req
 	app.background(func() {
 		data := struct{ Token *data.Token }{Token: token}
 
-		err = app.mailer.Send(user.Email, "token_activation.tmpl", data)
+		err = app.mailer.Send(user.Email, user.Locale, "token_activation.tmpl", data)
 		if err != nil {
 			app.logger.Error(err.Error())
 		}
@@ -75,7 +80,7 @@ func (app *application) createActivationToken(w http.ResponseWriter, r *http.Req
 
 	env := envelope{"message": "an email will be sent to you containing activation instructions"}
 
-	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	err = app.writeResponse(w, r, http.StatusAccepted, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -109,7 +114,12 @@ func (app *application) createAuthenticationToken(w http.ResponseWriter, r *http
 	}
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
 		return
 	}
 
@@ -118,7 +128,7 @@ func (app *application) createAuthenticationToken(w http.ResponseWriter, r *http
 	data.ValidateEmail(v, input.Email)
 	data.ValidatePasswordPlaintext(v, input.Password)
 	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
@@ -156,8 +166,9 @@ func (app *application) createAuthenticationToken(w http.ResponseWriter, r *http
 		return
 	}
 
-	err = app.writeJSON(
+	err = app.writeResponse(
 		w,
+		r,
 		http.StatusCreated,
 		envelope{"authentication_token": token},
 		nil,
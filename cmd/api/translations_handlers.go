@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/data"
+	"github.com/kvnloughead/greenlight/internal/i18n"
+)
+
+// listMovieTranslations handles GET requests to the
+// /v1/movies/:id/translations endpoint. The movie's alternate titles and
+// synopses are listed, sorted by language and region.
+func (app *application) listMovieTranslations(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+
+	translations, err := app.models.Translations.GetForMovie(movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"translations": translations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// replaceMovieTranslations handles PUT requests to the
+// /v1/movies/:id/translations endpoint. The request body has a "translations"
+// array, which replaces all of the movie's translations. Languages are
+// lowercased and regions are uppercased, and then they are validated by
+// data.ValidateTranslations.
+//
+// Since the movie's localized titles change, its version is incremented. If
+// the request has an If-Match header, it must match the ETag of the current
+// version of the movie, or a 412 Precondition Failed is sent. If the movie is
+// updated while the request is being handled, a 409 Conflict is sent, or a
+// 412 if the request was conditional.
+func (app *application) replaceMovieTranslations(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.preconditionsMet(w, r, movie.Version) {
+		return
+	}
+
+	var input struct {
+		Translations []struct {
+			Language string `json:"language"`
+			Region   string `json:"region"`
+			Title    string `json:"title"`
+			Synopsis string `json:"synopsis"`
+		} `json:"translations"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	translations := make([]data.MovieTranslation, len(input.Translations))
+	for i, t := range input.Translations {
+		translations[i] = data.MovieTranslation{
+			Language: strings.ToLower(strings.TrimSpace(t.Language)),
+			Region:   strings.ToUpper(strings.TrimSpace(t.Region)),
+			Title:    strings.TrimSpace(t.Title),
+			Synopsis: strings.TrimSpace(t.Synopsis),
+		}
+	}
+
+	v := validator.New()
+	data.ValidateTranslations(v, translations)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Translations.Replace(movie, translations)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(movie.Version))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"translations": translations}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// localizeMovie replaces the movie's title with its translation in the
+// language most preferred by the request's Accept-Language header. If the
+// movie has no translation in that language, the client's next choices are
+// tried in order. The original title is kept if none of them match, although
+// the language of the original title isn't known, so it may be one of the
+// client's choices.
+func (app *application) localizeMovie(r *http.Request, movie *data.Movie) error {
+	prefs := i18n.Preferences(r.Header.Get("Accept-Language"))
+	if len(prefs) == 0 {
+		return nil
+	}
+
+	translations, err := app.models.Translations.GetForMovie(movie.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, pref := range prefs {
+		if t, ok := data.BestTranslation(translations, pref); ok {
+			movie.Localize(t)
+			break
+		}
+	}
+
+	return nil
+}
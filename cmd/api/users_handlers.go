@@ -13,11 +13,12 @@ import (
 // body is decoded by the app.readJSON helper. See that function for details
 // about error handling.
 //
-// The request body must contain a name, email, and password. Request bodies
-// are validated by data.ValidateUser. A failedValidationResponse error is sent
-// if one or more fields fails validation, or if the email is a duplicate. A
-// hash is generated from the plaintext password via bcrypt and stored in the
-// database.
+// The request body must contain a name, email, and password, and may contain
+// the user's preferred locale, which defaults to the locale chosen from the
+// Accept-Language header. Request bodies are validated by data.ValidateUser.
+// A failedValidationResponse error is sent if one or more fields fails
+// validation, or if the email is a duplicate. A hash is generated from the
+// plaintext password via bcrypt and stored in the database.
 //
 // On successful registration, a token is generated securely and encrypted with
 // SHA-256. This token is sent to the user in a a welcome email via app.mailer,
@@ -26,14 +27,20 @@ func (app *application) registerUser(w http.ResponseWriter, r *http.Request) {
 	// Struct to store the data from the responses body. The struct's fields must
 	// be exported to use it with json.NewDecoder.
 	var input struct {
-		Name     string `json:"name"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Name     string  `json:"name"`
+		Email    string  `json:"email"`
+		Password string  `json:"password"`
+		Locale   *string `json:"locale"`
 	}
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
 		return
 	}
 
@@ -43,6 +50,13 @@ func (app *application) registerUser(w http.ResponseWriter, r *http.Request) {
 		Name:      input.Name,
 		Email:     input.Email,
 		Activated: false,
+		Locale:    app.contextGetLocale(r),
+	}
+
+	// The user's preferred locale, which their emails are sent in, defaults to
+	// the locale of the request.
+	if input.Locale != nil {
+		user.Locale = *input.Locale
 	}
 
 	err = user.Password.Set(input.Password)
@@ -56,7 +70,7 @@ func (app *application) registerUser(w http.ResponseWriter, r *http.Request) {
 	data.ValidateUser(v, user)
 
 	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
@@ -65,8 +79,8 @@ func (app *application) registerUser(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
-			v.AddError("email", "a user with this email address already exists")
-			app.failedValidationResponse(w, r, v.Errors)
+			v.AddErrorCode("email", validator.CodeConflict, "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -80,8 +94,14 @@ func (app *application) registerUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Grant user the "movies:read" permission.
-	err = app.models.Permissions.AddForUser(user.ID, data.MoviesRead)
+	// Grant user the "movies:read" and "people:read" permissions.
+	err = app.models.Permissions.AddForUser(user.ID, data.MoviesRead, data.PeopleRead)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Lists.InsertWatchlist(user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -96,14 +116,14 @@ func (app *application) registerUser(w http.ResponseWriter, r *http.Request) {
 			Token: token,
 			User:  user,
 		}
-		err = app.mailer.Send(user.Email, "user_welcome.tmpl", data)
+		err = app.mailer.Send(user.Email, user.Locale, "user_welcome.tmpl", data)
 		if err != nil {
 			app.logger.Error(err.Error())
 		}
 	})
 
 	// Write JSON response.
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
+	err = app.writeResponse(w, r, http.StatusAccepted, envelope{"user": app.userResponse(r, user)}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -118,14 +138,19 @@ func (app *application) activateUser(w http.ResponseWriter, r *http.Request) {
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		switch {
+		case errors.Is(err, errUnsupportedMediaType):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
 		return
 	}
 
 	v := validator.New()
 	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
 	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
@@ -138,8 +163,8 @@ func (app *application) activateUser(w http.ResponseWriter, r *http.Request) {
 		switch {
 		// If user can't be found, the token must be invalid or expired.
 		case errors.Is(err, data.ErrRecordNotFound):
-			v.AddError("token", "invalid or expired token")
-			app.failedValidationResponse(w, r, v.Errors)
+			v.AddErrorCode("token", validator.CodeNotFound, "invalid or expired token")
+			app.failedValidationResponse(w, r, v)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -174,10 +199,20 @@ func (app *application) activateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	env := envelope{"message": "user successfully activated", "user": user}
-	err = app.writeJSON(w, http.StatusOK, env, nil)
+	env := envelope{"message": "user successfully activated", "user": app.userResponse(r, user)}
+	err = app.writeResponse(w, r, http.StatusOK, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 }
+
+// showCurrentUser handles GET requests to the /v1/users/me endpoint. It
+// responds with the authenticated user, which is the target of the self link
+// in user representations.
+func (app *application) showCurrentUser(w http.ResponseWriter, r *http.Request) {
+	err := app.writeResponse(w, r, http.StatusOK, envelope{"user": app.userResponse(r, app.contextGetUser(r))}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
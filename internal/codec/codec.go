@@ -0,0 +1,137 @@
+// Package codec encodes and decodes API documents in formats other than JSON:
+// MessagePack, XML, CSV, and NDJSON.
+//
+// Documents are converted through a generic representation of JSON values, so
+// the other formats follow the JSON representation of a resource exactly,
+// including its field names and custom marshalers. A generic value is one of
+// nil, bool, json.Number, string, []any, or Object.
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupportedValue is returned when a value can't be represented in the
+// target format.
+var ErrUnsupportedValue = errors.New("unsupported value")
+
+// maxDepth is the maximum nesting depth of decoded arrays and objects.
+const maxDepth = 100
+
+// Member is a named member of an Object.
+type Member struct {
+	Key   string
+	Value any
+}
+
+// Object is a JSON object whose members are kept in their original order.
+type Object []Member
+
+// Get returns the value of the first member with the key, and whether there
+// is such a member.
+func (o Object) Get(key string) (any, bool) {
+	for _, m := range o {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return nil, false
+}
+
+// MarshalJSON encodes the object as a JSON object, in member order.
+func (o Object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(m.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Normalize converts v into a generic value, by way of its JSON encoding.
+func Normalize(v any) (any, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return FromJSON(js)
+}
+
+// FromJSON decodes a single JSON document into a generic value. Numbers are
+// decoded as json.Number, so that they aren't rounded.
+func FromJSON(js []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	v, err := decodeValue(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	if dec.More() {
+		return nil, errors.New("codec: unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+// decodeValue decodes the next JSON value from the decoder.
+func decodeValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			obj := Object{}
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key, _ := keyTok.(string)
+				value, err := decodeValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				obj = append(obj, Member{Key: key, Value: value})
+			}
+			_, err = dec.Token() // The closing brace.
+			return obj, err
+		case '[':
+			arr := []any{}
+			for dec.More() {
+				value, err := decodeValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, value)
+			}
+			_, err = dec.Token() // The closing bracket.
+			return arr, err
+		}
+		return nil, fmt.Errorf("codec: unexpected delimiter %q", t)
+	default:
+		// nil, bool, json.Number, or string.
+		return t, nil
+	}
+}
@@ -0,0 +1,151 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+const movieList = `{"movies":[{"id":1,"title":"Moana","year":2016,"genres":["animation","adventure"],"rating":7.6,"_links":{"self":{"href":"/v1/movies/1"}}},{"id":2,"title":"1917","year":2019,"genres":[],"deleted":null,"released":true}],"metadata":{"page_size":20}}`
+
+// roundTrip decodes a JSON document, encodes and decodes it with the codec
+// functions, and returns the result as JSON.
+func roundTrip(t *testing.T, js string, encode func(any) ([]byte, error), decode func([]byte) (any, error)) string {
+	t.Helper()
+
+	doc, err := FromJSON([]byte(js))
+	assert.IsNil(t, err)
+
+	encoded, err := encode(doc)
+	assert.IsNil(t, err)
+
+	decoded, err := decode(encoded)
+	assert.IsNil(t, err)
+
+	out, err := json.Marshal(decoded)
+	assert.IsNil(t, err)
+	return string(out)
+}
+
+func TestFromJSONKeepsOrder(t *testing.T) {
+	doc, err := FromJSON([]byte(`{"b":1,"a":{"d":true,"c":null}}`))
+	assert.IsNil(t, err)
+
+	js, err := json.Marshal(doc)
+	assert.IsNil(t, err)
+	assert.Equal(t, string(js), `{"b":1,"a":{"d":true,"c":null}}`)
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	tests := []string{
+		movieList,
+		`[0,127,128,-1,-32,-33,255,65536,-2147483649,9223372036854775807,18446744073709551615,1.5,-0.25]`,
+		`"` + strings.Repeat("str8 ", 10) + `"`,
+		`"` + strings.Repeat("str16 ", 50) + `"`,
+	}
+
+	for _, js := range tests {
+		assert.Equal(t, roundTrip(t, js, MarshalMsgpack, UnmarshalMsgpack), js)
+	}
+}
+
+func TestMsgpackEncoding(t *testing.T) {
+	doc, err := FromJSON([]byte(`{"a":[1,-1,true,null]}`))
+	assert.IsNil(t, err)
+
+	b, err := MarshalMsgpack(doc)
+	assert.IsNil(t, err)
+	assert.Equal(t, string(b), "\x81\xa1a\x94\x01\xff\xc3\xc0")
+}
+
+func TestMsgpackMalformed(t *testing.T) {
+	tests := map[string]string{
+		"Truncated string":  "\xa5abc",
+		"Truncated array":   "\x93\x01",
+		"Non-string key":    "\x81\x01\x02",
+		"Trailing data":     "\x01\x02",
+		"Unsupported type":  "\xc1",
+		"Huge array header": "\xdd\xff\xff\xff\xff",
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := UnmarshalMsgpack([]byte(data))
+			assert.Equal(t, errors.Is(err, ErrMalformedMsgpack), true)
+		})
+	}
+}
+
+func TestXMLRoundTrip(t *testing.T) {
+	marshal := func(v any) ([]byte, error) { return MarshalXML("response", v) }
+	assert.Equal(t, roundTrip(t, movieList, marshal, UnmarshalXML), movieList)
+}
+
+func TestXMLEncoding(t *testing.T) {
+	doc, err := FromJSON([]byte(`{"title":"1917","year":2019,"genres":["war"],"a b":null}`))
+	assert.IsNil(t, err)
+
+	b, err := MarshalXML("movie", doc)
+	assert.IsNil(t, err)
+	assert.Equal(t, string(b), `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<movie><title type="string">1917</title><year>2019</year><genres type="array"><item>war</item></genres><member name="a b" type="null"></member></movie>`+"\n")
+}
+
+func TestUnmarshalXMLInfersTypes(t *testing.T) {
+	doc, err := UnmarshalXML([]byte(`
+		<movie>
+			<title>Moana</title>
+			<year>2016</year>
+			<runtime>107 mins</runtime>
+			<genres><item>animation</item></genres>
+		</movie>`))
+	assert.IsNil(t, err)
+
+	js, err := json.Marshal(doc)
+	assert.IsNil(t, err)
+	assert.Equal(t, string(js), `{"title":"Moana","year":2016,"runtime":"107 mins","genres":["animation"]}`)
+}
+
+func TestUnmarshalXMLMalformed(t *testing.T) {
+	for _, data := range []string{"", "<movie>", "<movie></movie><movie></movie>", `<year type="number">abc</year>`} {
+		_, err := UnmarshalXML([]byte(data))
+		assert.Equal(t, errors.Is(err, ErrMalformedXML), true)
+	}
+}
+
+func TestMarshalCSV(t *testing.T) {
+	doc, err := FromJSON([]byte(movieList))
+	assert.IsNil(t, err)
+
+	b, err := MarshalCSV(doc)
+	assert.IsNil(t, err)
+	assert.Equal(t, string(b), "id,title,year,genres,rating,_links,deleted,released\n"+
+		`1,Moana,2016,"animation,adventure",7.6,"{""self"":{""href"":""/v1/movies/1""}}",,`+"\n"+
+		"2,1917,2019,,,,,true\n")
+}
+
+func TestRows(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"Collection", `{"metadata":{},"movies":[{"id":1},{"id":2}]}`, `[{"id":1},{"id":2}]`},
+		{"Single resource", `{"message":"ok","movie":{"id":1}}`, `[{"id":1}]`},
+		{"Plain object", `{"message":"ok"}`, `[{"message":"ok"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := FromJSON([]byte(tt.doc))
+			assert.IsNil(t, err)
+
+			js, err := json.Marshal(Rows(doc))
+			assert.IsNil(t, err)
+			assert.Equal(t, string(js), tt.want)
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package codec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ErrMalformedMsgpack is returned if MessagePack data can't be decoded.
+var ErrMalformedMsgpack = errors.New("malformed MessagePack")
+
+// MarshalMsgpack encodes a generic value as MessagePack. Numbers are encoded
+// as integers if they are whole and fit in 64 bits, and as float64 otherwise.
+func MarshalMsgpack(v any) ([]byte, error) {
+	return appendMsgpack(nil, v)
+}
+
+func appendMsgpack(b []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case json.Number:
+		return appendMsgpackNumber(b, v)
+	case string:
+		return appendMsgpackString(b, v), nil
+	case []any:
+		b = appendMsgpackHeader(b, len(v), 0x90, 0xdc)
+		for _, elem := range v {
+			var err error
+			b, err = appendMsgpack(b, elem)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case Object:
+		b = appendMsgpackHeader(b, len(v), 0x80, 0xde)
+		for _, m := range v {
+			b = appendMsgpackString(b, m.Key)
+			var err error
+			b, err = appendMsgpack(b, m.Value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedValue, v)
+	}
+}
+
+func appendMsgpackNumber(b []byte, n json.Number) ([]byte, error) {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		switch {
+		case i >= 0 && i <= 0x7f:
+			return append(b, byte(i)), nil
+		case i < 0 && i >= -32:
+			return append(b, byte(int8(i))), nil
+		default:
+			b = append(b, 0xd3)
+			return binary.BigEndian.AppendUint64(b, uint64(i)), nil
+		}
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		b = append(b, 0xcf)
+		return binary.BigEndian.AppendUint64(b, u), nil
+	}
+
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: number %q", ErrUnsupportedValue, n)
+	}
+	b = append(b, 0xcb)
+	return binary.BigEndian.AppendUint64(b, math.Float64bits(f)), nil
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n <= 31:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xda)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 0xdb)
+		b = binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+	return append(b, s...)
+}
+
+// appendMsgpackHeader appends the header of an array or map with n elements.
+// fix is the prefix of the fixed-size format, and prefix16 the prefix of the
+// 16-bit format, which is followed by the 32-bit format.
+func appendMsgpackHeader(b []byte, n int, fix, prefix16 byte) []byte {
+	switch {
+	case n <= 15:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, prefix16)
+		return binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, prefix16+1)
+		return binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+}
+
+// UnmarshalMsgpack decodes a single MessagePack value into a generic value.
+// Map keys must be strings. Binary data is decoded as a string, and extension
+// types aren't supported.
+func UnmarshalMsgpack(data []byte) (any, error) {
+	d := msgpackDecoder{data: data}
+
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(d.data) {
+		return nil, fmt.Errorf("%w: unexpected data after value", ErrMalformedMsgpack)
+	}
+	return v, nil
+}
+
+type msgpackDecoder struct {
+	data []byte
+	off  int
+}
+
+// next returns the next n bytes of the data.
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.off < n {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrMalformedMsgpack)
+	}
+	b := d.data[d.off : d.off+n]
+	d.off += n
+	return b, nil
+}
+
+// uint reads a big-endian unsigned integer of n bytes.
+func (d *msgpackDecoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+func (d *msgpackDecoder) value(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: nested too deeply", ErrMalformedMsgpack)
+	}
+
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+
+	// sized reads a length of n bytes, then the value that it prefixes.
+	sized := func(n int, read func(length int) (any, error)) (any, error) {
+		length, err := d.uint(n)
+		if err != nil {
+			return nil, err
+		}
+		return read(int(length))
+	}
+
+	switch {
+	case c <= 0x7f:
+		return json.Number(strconv.Itoa(int(c))), nil
+	case c >= 0xe0:
+		return json.Number(strconv.Itoa(int(int8(c)))), nil
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	case c&0xf0 == 0x90:
+		return d.array(int(c&0x0f), depth)
+	case c&0xf0 == 0x80:
+		return d.object(int(c&0x0f), depth)
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xd9:
+		return sized(1, d.str)
+	case 0xc5, 0xda:
+		return sized(2, d.str)
+	case 0xc6, 0xdb:
+		return sized(4, d.str)
+	case 0xca:
+		u, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return floatNumber(float64(math.Float32frombits(uint32(u))))
+	case 0xcb:
+		u, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return floatNumber(math.Float64frombits(u))
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(strconv.FormatUint(u, 10)), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n := 1 << (c - 0xd0)
+		u, err := d.uint(n)
+		if err != nil {
+			return nil, err
+		}
+		// Sign-extend the integer from n bytes.
+		shift := 64 - 8*n
+		return json.Number(strconv.FormatInt(int64(u<<shift)>>shift, 10)), nil
+	case 0xdc:
+		return sized(2, func(n int) (any, error) { return d.array(n, depth) })
+	case 0xdd:
+		return sized(4, func(n int) (any, error) { return d.array(n, depth) })
+	case 0xde:
+		return sized(2, func(n int) (any, error) { return d.object(n, depth) })
+	case 0xdf:
+		return sized(4, func(n int) (any, error) { return d.object(n, depth) })
+	}
+
+	return nil, fmt.Errorf("%w: unsupported type 0x%02x", ErrMalformedMsgpack, c)
+}
+
+func (d *msgpackDecoder) str(n int) (any, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) array(n int, depth int) (any, error) {
+	// Every element takes at least one byte, so a longer array is malformed.
+	if n > len(d.data)-d.off {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrMalformedMsgpack)
+	}
+
+	arr := make([]any, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+	}
+	return arr, nil
+}
+
+func (d *msgpackDecoder) object(n int, depth int) (any, error) {
+	if 2*n > len(d.data)-d.off {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrMalformedMsgpack)
+	}
+
+	obj := make(Object, 0, n)
+	for i := 0; i < n; i++ {
+		k, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: map keys must be strings", ErrMalformedMsgpack)
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		obj = append(obj, Member{Key: key, Value: v})
+	}
+	return obj, nil
+}
+
+// floatNumber converts a float to a json.Number. NaN and infinities can't be
+// represented in JSON, so they are rejected.
+func floatNumber(f float64) (any, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("%w: non-finite number", ErrMalformedMsgpack)
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+}
@@ -0,0 +1,145 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+)
+
+// Rows returns the records that a document should be written as in a
+// tabular format, such as CSV or NDJSON.
+//
+//   - If the document is an object with an array member, such as the
+//     "movies" member of a list response, its elements are the records.
+//   - Otherwise, if it has an object member, such as the "movie" member of a
+//     single resource, that object is the only record.
+//   - Otherwise, the document itself is the only record.
+//
+// Other members, such as pagination metadata, are left out.
+func Rows(doc any) []any {
+	obj, ok := doc.(Object)
+	if !ok {
+		if arr, ok := doc.([]any); ok {
+			return arr
+		}
+		return []any{doc}
+	}
+
+	for _, m := range obj {
+		if arr, ok := m.Value.([]any); ok {
+			return arr
+		}
+	}
+	for _, m := range obj {
+		if _, ok := m.Value.(Object); ok {
+			return []any{m.Value}
+		}
+	}
+	return []any{doc}
+}
+
+// MarshalCSV encodes a generic document as CSV, with a header row. The
+// records are chosen by Rows, and the columns are the union of their members,
+// in the order they first appear. Records that aren't objects are written in a
+// single "value" column.
+//
+// Arrays of strings and numbers are joined with commas, in the format used by
+// movie imports. Other nested values are written as JSON.
+func MarshalCSV(doc any) ([]byte, error) {
+	rows := Rows(doc)
+
+	var columns []string
+	seen := map[string]bool{}
+	for _, row := range rows {
+		obj, ok := row.(Object)
+		if !ok {
+			obj = Object{{Key: "value", Value: row}}
+		}
+		for _, m := range obj {
+			if !seen[m.Key] {
+				seen[m.Key] = true
+				columns = append(columns, m.Key)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	err := w.Write(columns)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		obj, ok := row.(Object)
+		if !ok {
+			obj = Object{{Key: "value", Value: row}}
+		}
+		for i, column := range columns {
+			value, _ := obj.Get(column)
+			record[i], err = csvCell(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = w.Write(record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// csvCell returns the text of a CSV cell for a generic value.
+func csvCell(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return string(v), nil
+	case bool:
+		if v {
+			return "true", nil
+		}
+		return "false", nil
+	case []any:
+		parts := make([]string, len(v))
+		for i, elem := range v {
+			switch elem := elem.(type) {
+			case string:
+				parts[i] = elem
+			case json.Number:
+				parts[i] = string(elem)
+			default:
+				js, err := json.Marshal(v)
+				return string(js), err
+			}
+		}
+		return strings.Join(parts, ","), nil
+	default:
+		js, err := json.Marshal(v)
+		return string(js), err
+	}
+}
+
+// MarshalNDJSON encodes a generic document as newline-delimited JSON, with
+// one line for each of the records chosen by Rows.
+func MarshalNDJSON(doc any) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, row := range Rows(doc) {
+		js, err := json.Marshal(row)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(js)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
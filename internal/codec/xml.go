@@ -0,0 +1,296 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// ErrMalformedXML is returned if XML data can't be decoded.
+var ErrMalformedXML = errors.New("malformed XML")
+
+// XML documents represent generic values with the following conventions.
+//
+//   - An object is an element with a child element for each member. Members
+//     whose names aren't valid XML names are encoded as <member name="...">.
+//   - An array is an element with type="array", with an <item> child element
+//     for each element of the array.
+//   - Strings, numbers, and booleans are the text of an element. Numbers and
+//     booleans are recognized by their text, so strings that look like them
+//     are marked with type="string".
+//   - null is an empty element with type="null".
+//
+// When decoding, the type attribute is optional. Elements without one are
+// treated as arrays if all of their children are <item> elements, as objects
+// if they have other children, and otherwise by their text.
+const (
+	xmlItem   = "item"
+	xmlMember = "member"
+)
+
+// MarshalXML encodes a generic value as an XML document with the root
+// element name.
+func MarshalXML(root string, v any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	err := encodeXML(enc, xmlStart(root), v)
+	if err != nil {
+		return nil, err
+	}
+	err = enc.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// xmlStart returns the start element for a member name.
+func xmlStart(name string) xml.StartElement {
+	if isXMLName(name) {
+		return xml.StartElement{Name: xml.Name{Local: name}}
+	}
+	return xml.StartElement{
+		Name: xml.Name{Local: xmlMember},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: name}},
+	}
+}
+
+// withType returns the start element with a type attribute.
+func withType(start xml.StartElement, typ string) xml.StartElement {
+	start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "type"}, Value: typ})
+	return start
+}
+
+func encodeXML(enc *xml.Encoder, start xml.StartElement, v any) error {
+	var text string
+
+	switch v := v.(type) {
+	case nil:
+		start = withType(start, "null")
+	case bool:
+		text = fmt.Sprint(v)
+	case json.Number:
+		text = string(v)
+	case string:
+		if _, ok := scalarFromText(strings.TrimSpace(v)); ok {
+			start = withType(start, "string")
+		}
+		text = v
+	case []any:
+		start = withType(start, "array")
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, elem := range v {
+			if err := encodeXML(enc, xml.StartElement{Name: xml.Name{Local: xmlItem}}, elem); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case Object:
+		if len(v) == 0 {
+			start = withType(start, "object")
+		}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, m := range v {
+			if err := encodeXML(enc, xmlStart(m.Key), m.Value); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedValue, v)
+	}
+
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if text != "" {
+		if err := enc.EncodeToken(xml.CharData(text)); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// scalarFromText returns the number or boolean that an element's text
+// represents, if any.
+func scalarFromText(s string) (any, bool) {
+	switch s {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+
+	if s != "" && json.Valid([]byte(s)) && (s[0] == '-' || (s[0] >= '0' && s[0] <= '9')) {
+		return json.Number(s), true
+	}
+	return nil, false
+}
+
+// isXMLName returns true if the name can be used as an element name as is.
+func isXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r), r == '_':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// UnmarshalXML decodes an XML document into a generic value. The name of the
+// root element is ignored.
+func UnmarshalXML(data []byte) (any, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("%w: no root element", ErrMalformedXML)
+			}
+			return nil, fmt.Errorf("%w: %v", ErrMalformedXML, err)
+		}
+
+		if start, ok := tok.(xml.StartElement); ok {
+			v, err := decodeXMLElement(dec, start, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			// Only comments and whitespace may follow the root element.
+			for {
+				tok, err := dec.Token()
+				if errors.Is(err, io.EOF) {
+					return v, nil
+				}
+				if err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrMalformedXML, err)
+				}
+				switch t := tok.(type) {
+				case xml.Comment, xml.ProcInst:
+				case xml.CharData:
+					if len(bytes.TrimSpace(t)) > 0 {
+						return nil, fmt.Errorf("%w: unexpected data after root element", ErrMalformedXML)
+					}
+				default:
+					return nil, fmt.Errorf("%w: unexpected data after root element", ErrMalformedXML)
+				}
+			}
+		}
+	}
+}
+
+// xmlChild is a decoded child element.
+type xmlChild struct {
+	name  string
+	value any
+}
+
+func decodeXMLElement(dec *xml.Decoder, start xml.StartElement, depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: nested too deeply", ErrMalformedXML)
+	}
+
+	var typ string
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "type" {
+			typ = attr.Value
+		}
+	}
+
+	var (
+		text     strings.Builder
+		children []xmlChild
+	)
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformedXML, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			if name == xmlMember {
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "name" {
+						name = attr.Value
+					}
+				}
+			}
+			value, err := decodeXMLElement(dec, t, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, xmlChild{name: name, value: value})
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			return xmlValue(typ, text.String(), children)
+		}
+	}
+}
+
+// xmlValue builds the generic value of an element from its type attribute,
+// text, and children.
+func xmlValue(typ, text string, children []xmlChild) (any, error) {
+	allItems := len(children) > 0
+	for _, c := range children {
+		if c.name != xmlItem {
+			allItems = false
+		}
+	}
+
+	switch {
+	case typ == "null":
+		return nil, nil
+	case typ == "array" || (typ == "" && allItems):
+		arr := make([]any, 0, len(children))
+		for _, c := range children {
+			arr = append(arr, c.value)
+		}
+		return arr, nil
+	case typ == "object" || (typ == "" && len(children) > 0):
+		obj := make(Object, 0, len(children))
+		for _, c := range children {
+			obj = append(obj, Member{Key: c.name, Value: c.value})
+		}
+		return obj, nil
+	case typ == "string":
+		return text, nil
+	case typ == "number" || typ == "boolean":
+		v, ok := scalarFromText(strings.TrimSpace(text))
+		_, isBool := v.(bool)
+		if !ok || isBool != (typ == "boolean") {
+			return nil, fmt.Errorf("%w: %q is not a %s", ErrMalformedXML, text, typ)
+		}
+		return v, nil
+	case typ == "":
+		if v, ok := scalarFromText(strings.TrimSpace(text)); ok {
+			return v, nil
+		}
+		return text, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrMalformedXML, typ)
+	}
+}
@@ -0,0 +1,201 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/lib/pq"
+)
+
+// ErrUnknownPerson is returned by CreditModel.Replace if a credit refers to a
+// person that doesn't exist.
+var ErrUnknownPerson = errors.New("unknown person")
+
+// CreditRoles are the roles that a person can be credited with.
+var CreditRoles = []string{"director", "actor", "writer"}
+
+// maxCredits is the maximum number of credits per movie.
+const maxCredits = 500
+
+// Credit is a person's credit on a movie. Character is only set for actors.
+// Credits are listed in billing order, which is shared by all roles. Name is
+// the person's name, which is set when credits are read.
+type Credit struct {
+	PersonID     int64  `json:"person_id"`
+	Name         string `json:"name,omitempty"`
+	Role         string `json:"role"`
+	Character    string `json:"character,omitempty"`
+	BillingOrder int    `json:"billing_order"`
+}
+
+// PersonCredit is a credit in a person's filmography, with the movie it is
+// for.
+type PersonCredit struct {
+	MovieID   int64  `json:"movie_id"`
+	Title     string `json:"title"`
+	Year      int32  `json:"year"`
+	Role      string `json:"role"`
+	Character string `json:"character,omitempty"`
+}
+
+// CreditModel struct wraps an sql.DB connection pool and implements
+// operations on the movie_credits table.
+type CreditModel struct {
+	DB *sql.DB
+}
+
+// ValidateCredits validates the credits of a movie. Errors are reported at the
+// path of the credit, such as "credits[2].role".
+//
+//   - There must be no more than maxCredits credits.
+//   - Each credit must have a person ID and a permitted role.
+//   - Only actors can have a character, which must be less than 500 bytes.
+//   - The billing order must not be negative.
+//   - A person can't have the same role and character twice.
+func ValidateCredits(v *validator.Validator, credits []Credit) {
+	v.CheckCode(len(credits) <= maxCredits, "credits", validator.CodeTooLong,
+		"must not contain more than 500 credits", "max", maxCredits)
+
+	type creditKey struct {
+		personID        int64
+		role, character string
+	}
+	seen := make(map[creditKey]bool, len(credits))
+
+	for i, c := range credits {
+		v.CheckCode(c.PersonID != 0, validator.Path("credits", i, "person_id"), validator.CodeRequired, "must be provided")
+		v.CheckCode(c.PersonID >= 0, validator.Path("credits", i, "person_id"), validator.CodeOutOfRange, "must be a positive integer", "min", 1)
+
+		v.CheckCode(c.Role != "", validator.Path("credits", i, "role"), validator.CodeRequired, "must be provided")
+		v.CheckCode(validator.PermittedValue(c.Role, CreditRoles...), validator.Path("credits", i, "role"),
+			validator.CodeNotPermitted, "must be director, actor, or writer", "permitted", CreditRoles)
+
+		v.CheckCode(c.Character == "" || c.Role == "actor", validator.Path("credits", i, "character"), validator.CodeNotPermitted,
+			"must only be provided for actors")
+		v.CheckCode(len(c.Character) < 500, validator.Path("credits", i, "character"), validator.CodeTooLong,
+			"must be less than 500 bytes", "max", 499)
+
+		v.CheckCode(c.BillingOrder >= 0, validator.Path("credits", i, "billing_order"), validator.CodeOutOfRange,
+			"must not be negative", "min", 0)
+
+		key := creditKey{c.PersonID, c.Role, c.Character}
+		v.CheckCode(!seen[key], validator.Path("credits", i), validator.CodeDuplicate,
+			"must not repeat a person's role and character")
+		seen[key] = true
+	}
+}
+
+// GetForMovie returns the credits of a movie, in billing order, with the names
+// of the people credited.
+func (m CreditModel) GetForMovie(movieID int64) ([]Credit, error) {
+	query := `
+		SELECT movie_credits.person_id, people.name, movie_credits.role,
+			movie_credits.character, movie_credits.billing_order
+		FROM movie_credits
+		INNER JOIN people ON people.id = movie_credits.person_id
+		WHERE movie_credits.movie_id = $1
+		ORDER BY movie_credits.billing_order ASC, people.name ASC, movie_credits.person_id ASC`
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []Credit{}
+	for rows.Next() {
+		var c Credit
+		err = rows.Scan(&c.PersonID, &c.Name, &c.Role, &c.Character, &c.BillingOrder)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, c)
+	}
+
+	return credits, rows.Err()
+}
+
+// GetForPerson returns a person's filmography, newest movies first. Movies in
+// the trash are excluded.
+func (m CreditModel) GetForPerson(personID int64) ([]PersonCredit, error) {
+	query := `
+		SELECT movies.id, movies.title, movies.year, movie_credits.role, movie_credits.character
+		FROM movie_credits
+		INNER JOIN movies ON movies.id = movie_credits.movie_id
+		WHERE movie_credits.person_id = $1 AND movies.deleted_at IS NULL
+		ORDER BY movies.year DESC, movies.title ASC, movies.id ASC, movie_credits.billing_order ASC`
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, personID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []PersonCredit{}
+	for rows.Next() {
+		var c PersonCredit
+		err = rows.Scan(&c.MovieID, &c.Title, &c.Year, &c.Role, &c.Character)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, c)
+	}
+
+	return credits, rows.Err()
+}
+
+// Replace replaces the credits of a movie, in a single transaction. The movie
+// is locked first, so that concurrent replacements are serialized. If the
+// movie doesn't exist, or is in the trash, an ErrRecordNotFound error is
+// returned. If a credit refers to a person that doesn't exist, no changes are
+// made, and an ErrUnknownPerson error is returned.
+func (m CreditModel) Replace(movieID int64, credits []Credit) error {
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction does nothing.
+	defer tx.Rollback()
+
+	err = lockMovie(ctx, tx, movieID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM movie_credits WHERE movie_id = $1`, movieID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO movie_credits (movie_id, person_id, role, character, billing_order)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	for _, c := range credits {
+		_, err = tx.ExecContext(ctx, query, movieID, c.PersonID, c.Role, c.Character, c.BillingOrder)
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) {
+				switch pqErr.Constraint {
+				case "movie_credits_person_id_fkey":
+					return ErrUnknownPerson
+				case "movie_credits_movie_id_fkey":
+					return ErrRecordNotFound
+				}
+			}
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
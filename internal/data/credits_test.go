@@ -0,0 +1,70 @@
+package data
+
+import (
+	"testing"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+func TestValidateCredits(t *testing.T) {
+	tests := []struct {
+		name     string
+		credits  []Credit
+		wantCode map[string]string
+	}{
+		{
+			name: "Valid",
+			credits: []Credit{
+				{PersonID: 1, Role: "director"},
+				{PersonID: 2, Role: "actor", Character: "Moana", BillingOrder: 1},
+				{PersonID: 2, Role: "actor", Character: "Narrator", BillingOrder: 2},
+			},
+			wantCode: map[string]string{},
+		},
+		{
+			name:    "Missing person and role",
+			credits: []Credit{{}},
+			wantCode: map[string]string{
+				"credits[0].person_id": validator.CodeRequired,
+				"credits[0].role":      validator.CodeRequired,
+			},
+		},
+		{
+			name: "Invalid fields",
+			credits: []Credit{
+				{PersonID: -1, Role: "producer", Character: "Maui", BillingOrder: -1},
+			},
+			wantCode: map[string]string{
+				"credits[0].person_id":     validator.CodeOutOfRange,
+				"credits[0].role":          validator.CodeNotPermitted,
+				"credits[0].character":     validator.CodeNotPermitted,
+				"credits[0].billing_order": validator.CodeOutOfRange,
+			},
+		},
+		{
+			name: "Duplicate",
+			credits: []Credit{
+				{PersonID: 1, Role: "writer"},
+				{PersonID: 1, Role: "writer", BillingOrder: 1},
+			},
+			wantCode: map[string]string{
+				"credits[1]": validator.CodeDuplicate,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateCredits(v, tt.credits)
+
+			assert.Equal(t, len(v.Details), len(tt.wantCode))
+			for path, code := range tt.wantCode {
+				errs := v.Details[path]
+				assert.Equal(t, len(errs), 1)
+				assert.Equal(t, errs[0].Code, code)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package data
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidDateFormat is returned when an input date is not of the format
+// "YYYY-MM-DD".
+var ErrInvalidDateFormat = errors.New("invalid date format")
+
+// dateLayout is the layout of a Date in JSON, query strings, and SQL.
+const dateLayout = "2006-01-02"
+
+// Date is a calendar date, without a time or time zone, such as the day a
+// movie was watched.
+//
+// It satisfies the json.Marshaler and json.Unmarshaler interfaces, marshalling
+// to and from "YYYY-MM-DD", and it can be scanned from and written to SQL date
+// columns.
+type Date struct {
+	time.Time
+}
+
+// ParseDate parses a date of the format "YYYY-MM-DD". If it doesn't parse,
+// an ErrInvalidDateFormat is returned.
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return Date{}, ErrInvalidDateFormat
+	}
+	return Date{t}, nil
+}
+
+// String returns the date as "YYYY-MM-DD".
+func (d Date) String() string {
+	return d.Format(dateLayout)
+}
+
+// MarshalJSON marshals a date into JSON as "YYYY-MM-DD".
+func (d Date) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+// UnmarshalJSON converts a JSON value of the form "YYYY-MM-DD" into a Date.
+// An ErrInvalidDateFormat is returned if the value isn't a string, or doesn't
+// parse.
+func (d *Date) UnmarshalJSON(jsonVal []byte) error {
+	s, err := strconv.Unquote(string(jsonVal))
+	if err != nil {
+		return ErrInvalidDateFormat
+	}
+
+	*d, err = ParseDate(s)
+	return err
+}
+
+// Scan implements the sql.Scanner interface, for scanning date columns.
+func (d *Date) Scan(src any) error {
+	t, ok := src.(time.Time)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into Date", src)
+	}
+	*d = Date{time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)}
+	return nil
+}
+
+// Value implements the driver.Valuer interface, for writing date columns.
+func (d Date) Value() (driver.Value, error) {
+	return d.String(), nil
+}
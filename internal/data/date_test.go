@@ -0,0 +1,51 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+func TestDateJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    string
+		wantErr error
+	}{
+		{"Valid", `"2024-02-29"`, "2024-02-29", nil},
+		{"Not a date", `"2023-02-29"`, "", ErrInvalidDateFormat},
+		{"Wrong format", `"29/02/2024"`, "", ErrInvalidDateFormat},
+		{"Not a string", `20240229`, "", ErrInvalidDateFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Date
+			err := json.Unmarshal([]byte(tt.json), &d)
+			assert.Equal(t, errors.Is(err, tt.wantErr), true)
+			if tt.wantErr != nil {
+				return
+			}
+
+			assert.Equal(t, d.String(), tt.want)
+
+			b, err := json.Marshal(d)
+			assert.IsNil(t, err)
+			assert.Equal(t, string(b), tt.json)
+		})
+	}
+}
+
+func TestDateScan(t *testing.T) {
+	var d Date
+	err := d.Scan(time.Date(2024, 2, 29, 23, 0, 0, 0, time.FixedZone("", -5*60*60)))
+	assert.IsNil(t, err)
+	assert.Equal(t, d.String(), "2024-02-29")
+
+	err = d.Scan("2024-02-29")
+	assert.Equal(t, err != nil, true)
+}
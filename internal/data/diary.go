@@ -0,0 +1,326 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+)
+
+// DiaryEntry is a record of a user watching a movie on a particular day. The
+// optional Rating is the user's rating of that viewing, which doesn't change
+// their rating of the movie, or its aggregates. Title and Year are those of
+// the movie.
+type DiaryEntry struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	MovieID   int64     `json:"movie_id"`
+	Title     string    `json:"title"`
+	Year      int32     `json:"year"`
+	WatchedOn Date      `json:"watched_on"`
+	Rewatch   bool      `json:"rewatch"`
+	Rating    *int      `json:"rating,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int32     `json:"version"`
+}
+
+// DiaryFilter holds the conditions that diary entries are filtered by. Zero
+// values are ignored.
+//
+//   - Year: the year the movies were watched in.
+//   - MovieID: the ID of the movie that was watched.
+type DiaryFilter struct {
+	Year    int
+	MovieID int64
+}
+
+// DiaryStats are the statistics of a user's diary for a year. Entries is the
+// number of diary entries, Movies is the number of distinct movies, and
+// Runtime is their total runtime, counting rewatches. Genres and Decades
+// count the entries by the genres and decades of their movies, most watched
+// first, like the facets of a movie list. Movies in the trash aren't counted.
+type DiaryStats struct {
+	Year      int           `json:"year"`
+	Entries   int           `json:"entries"`
+	Movies    int           `json:"movies"`
+	Rewatches int           `json:"rewatches"`
+	Runtime   Runtime       `json:"runtime"`
+	Genres    []GenreCount  `json:"genres"`
+	Decades   []DecadeCount `json:"decades"`
+}
+
+// DiaryModel struct wraps an sql.DB connection pool and implements operations
+// on the diary_entries table. Every operation is scoped to a single user.
+type DiaryModel struct {
+	DB *sql.DB
+}
+
+// ValidateDiaryEntry validates the fields of a DiaryEntry struct.
+//
+//   - MovieID is required.
+//   - WatchedOn is required, and must be between 1888 and the present. A day
+//     of leeway is allowed, for users ahead of UTC.
+//   - Rating is optional, but must be between 1 and 10 if provided.
+func ValidateDiaryEntry(v *validator.Validator, e *DiaryEntry) {
+	v.CheckCode(e.MovieID != 0, "movie_id", validator.CodeRequired, "must be provided")
+
+	v.CheckCode(!e.WatchedOn.IsZero(), "watched_on", validator.CodeRequired, "must be provided")
+	v.CheckCode(e.WatchedOn.Year() >= 1888, "watched_on", validator.CodeOutOfRange, "must be after 1888", "min", 1888)
+	v.CheckCode(e.WatchedOn.Before(time.Now().AddDate(0, 0, 1)), "watched_on", validator.CodeOutOfRange, "must not be in the future")
+
+	if e.Rating != nil {
+		v.CheckCode(*e.Rating >= 1, "rating", validator.CodeOutOfRange, "must be at least 1", "min", 1)
+		v.CheckCode(*e.Rating <= 10, "rating", validator.CodeOutOfRange, "must be no more than 10", "max", 10)
+	}
+}
+
+// ValidateDiaryFilter checks that the year of a DiaryFilter, if provided, is
+// between 1888 and the present.
+func ValidateDiaryFilter(v *validator.Validator, f DiaryFilter) {
+	if f.Year != 0 {
+		thisYear := time.Now().Year()
+		v.CheckCode(f.Year >= 1888, "year", validator.CodeOutOfRange, "must be after 1888", "min", 1888)
+		v.CheckCode(f.Year <= thisYear, "year", validator.CodeOutOfRange, "must not be in the future", "max", thisYear)
+	}
+}
+
+// diaryColumns are the columns of a DiaryEntry, with its movie's title and
+// year, which are selected from diaryTables. Entries with movies in the trash
+// are left out.
+const (
+	diaryColumns = `diary_entries.id, diary_entries.user_id, diary_entries.movie_id, movies.title, movies.year,
+		diary_entries.watched_on, diary_entries.rewatch, diary_entries.rating, diary_entries.created_at, diary_entries.version`
+	diaryTables = `diary_entries JOIN movies ON movies.id = diary_entries.movie_id AND movies.deleted_at IS NULL`
+)
+
+// dests returns the destinations to scan diaryColumns into.
+func (e *DiaryEntry) dests() []any {
+	return []any{
+		&e.ID,
+		&e.UserID,
+		&e.MovieID,
+		&e.Title,
+		&e.Year,
+		&e.WatchedOn,
+		&e.Rewatch,
+		&e.Rating,
+		&e.CreatedAt,
+		&e.Version,
+	}
+}
+
+// Insert adds a new record to the diary_entries table. The entry's UserID and
+// MovieID must be set. The id, created_at, and version are generated
+// automatically.
+func (m DiaryModel) Insert(entry *DiaryEntry) error {
+	query := `
+		INSERT INTO diary_entries (user_id, movie_id, watched_on, rewatch, rating)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, version`
+
+	args := []any{entry.UserID, entry.MovieID, entry.WatchedOn, entry.Rewatch, entry.Rating}
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt, &entry.Version)
+}
+
+// Get retrieves one of a user's diary entries by its ID. If there is no
+// matching record, or it belongs to another user, or its movie is in the
+// trash, an ErrRecordNotFound error is returned.
+func (m DiaryModel) Get(userID, id int64) (*DiaryEntry, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + diaryColumns + `
+		FROM ` + diaryTables + `
+		WHERE diary_entries.id = $1 AND diary_entries.user_id = $2`
+
+	var entry DiaryEntry
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(entry.dests()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &entry, nil
+}
+
+// GetAllForUser retrieves a page of a user's diary entries that match the
+// DiaryFilter, sorted and paginated by the Filters.
+func (m DiaryModel) GetAllForUser(userID int64, df DiaryFilter, filters Filters) ([]*DiaryEntry, Metadata, error) {
+	args := queryArgs{}
+	where := fmt.Sprintf("diary_entries.user_id = %s", args.add(userID))
+	if df.Year != 0 {
+		where += fmt.Sprintf(" AND date_part('year', diary_entries.watched_on) = %s", args.add(df.Year))
+	}
+	if df.MovieID != 0 {
+		where += fmt.Sprintf(" AND diary_entries.movie_id = %s", args.add(df.MovieID))
+	}
+
+	// The sort column is qualified, since the movies table has some of the same
+	// columns.
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM %s
+		WHERE %s
+		ORDER BY diary_entries.%s %s, diary_entries.id ASC
+		LIMIT %s OFFSET %s`,
+		diaryColumns, diaryTables, where, filters.sortColumn(), filters.sortDirection(),
+		args.add(filters.limit()), args.add(filters.offset()))
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*DiaryEntry{}
+
+	for rows.Next() {
+		var entry DiaryEntry
+		err = rows.Scan(append([]any{&totalRecords}, entry.dests()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return entries, metadata, nil
+}
+
+// Update updates the date, rewatch flag, and rating of a user's diary entry,
+// and increments its version. If the version doesn't match, or the entry was
+// deleted, an ErrEditConflict error is returned.
+func (m DiaryModel) Update(entry *DiaryEntry) error {
+	query := `
+		UPDATE diary_entries
+		SET watched_on = $1, rewatch = $2, rating = $3, version = version + 1
+		WHERE id = $4 AND user_id = $5 AND version = $6
+		RETURNING version`
+
+	args := []any{entry.WatchedOn, entry.Rewatch, entry.Rating, entry.ID, entry.UserID, entry.Version}
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete permanently deletes one of a user's diary entries. If there is no
+// matching record, or it belongs to another user, an ErrRecordNotFound error
+// is returned.
+func (m DiaryModel) Delete(userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM diary_entries WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Stats computes the statistics of a user's diary for a year. The genre and
+// decade breakdowns are aggregated into JSON arrays by the database, so that
+// every statistic is computed in a single query.
+func (m DiaryModel) Stats(userID int64, year int) (*DiaryStats, error) {
+	query := `
+		WITH watched AS (
+			SELECT diary_entries.movie_id, diary_entries.rewatch, movies.runtime, movies.year, movies.genres
+			FROM ` + diaryTables + `
+			WHERE diary_entries.user_id = $1
+				AND diary_entries.watched_on >= make_date($2::int, 1, 1)
+				AND diary_entries.watched_on < make_date($2::int + 1, 1, 1)
+		)
+		SELECT
+			(SELECT count(*) FROM watched),
+			(SELECT count(DISTINCT movie_id) FROM watched),
+			(SELECT count(*) FROM watched WHERE rewatch),
+			(SELECT COALESCE(sum(runtime), 0) FROM watched),
+			(SELECT COALESCE(json_agg(g ORDER BY g.count DESC, g.genre), '[]')
+			 FROM (
+				SELECT u.genre, count(*) AS count
+				FROM watched CROSS JOIN LATERAL unnest(watched.genres) AS u(genre)
+				GROUP BY u.genre
+			 ) g),
+			(SELECT COALESCE(json_agg(d ORDER BY d.count DESC, d.decade), '[]')
+			 FROM (
+				SELECT watched.year / 10 * 10 AS decade, count(*) AS count
+				FROM watched
+				WHERE watched.year > 0
+				GROUP BY 1
+			 ) d)`
+
+	stats := DiaryStats{Year: year}
+	var genres, decades []byte
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, year).Scan(
+		&stats.Entries, &stats.Movies, &stats.Rewatches, &stats.Runtime, &genres, &decades)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(genres, &stats.Genres)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(decades, &stats.Decades)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
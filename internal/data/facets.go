@@ -0,0 +1,158 @@
+package data
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// RuntimeBucket is a range of runtimes that movies are counted in by Facets.
+// A Max of zero means that the range is unbounded.
+type RuntimeBucket struct {
+	Label string `json:"label"`
+	Min   int32  `json:"min"`
+	Max   int32  `json:"max,omitempty"`
+}
+
+// RuntimeBuckets are the runtime ranges counted by Facets, in ascending
+// order. Together they cover every runtime, without overlapping. Their bounds
+// can be used as the runtime_min and runtime_max filters of a movie list.
+var RuntimeBuckets = []RuntimeBucket{
+	{Label: "under 90 mins", Min: 1, Max: 89},
+	{Label: "90-119 mins", Min: 90, Max: 119},
+	{Label: "120-149 mins", Min: 120, Max: 149},
+	{Label: "150+ mins", Min: 150},
+}
+
+// GenreCount is the number of movies with a genre.
+type GenreCount struct {
+	Genre string `json:"genre"`
+	Count int64  `json:"count"`
+}
+
+// DecadeCount is the number of movies released in a decade. Decade is the
+// first year of the decade, for example 1990 for the 1990s.
+type DecadeCount struct {
+	Decade int32 `json:"decade"`
+	Count  int64 `json:"count"`
+}
+
+// RuntimeBucketCount is the number of movies with a runtime in the bucket.
+type RuntimeBucketCount struct {
+	RuntimeBucket
+	Count int64 `json:"count"`
+}
+
+// MovieFacets are counts of the movies that match a filter, broken down by
+// genre, decade, and runtime. They are meant for building filter controls.
+type MovieFacets struct {
+	Genres   []GenreCount         `json:"genres"`
+	Decades  []DecadeCount        `json:"decades"`
+	Runtimes []RuntimeBucketCount `json:"runtimes"`
+}
+
+// runtimeBucketExpression returns a SQL expression for the index of the
+// runtime bucket that a movie belongs to in RuntimeBuckets.
+func runtimeBucketExpression() string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	for i, bucket := range RuntimeBuckets[:len(RuntimeBuckets)-1] {
+		fmt.Fprintf(&b, " WHEN runtime <= %d THEN %d", bucket.Max, i)
+	}
+	fmt.Fprintf(&b, " ELSE %d END", len(RuntimeBuckets)-1)
+	return b.String()
+}
+
+// Facets counts the movies that match the filter by genre, decade, and
+// runtime bucket. The counts cover every matching movie, not just a page of
+// them. Genres are ordered by descending count, and decades chronologically.
+// Every runtime bucket is included, even if its count is zero.
+//
+// The counts are computed in a single query, which reads the matching movies
+// once and groups them three ways.
+func (m MovieModel) Facets(filter MovieFilter) (*MovieFacets, error) {
+	args := queryArgs{}
+	query := fmt.Sprintf(`
+		WITH matched AS (
+			SELECT year, runtime, genres
+			FROM movies
+			WHERE %s
+		)
+		SELECT 'genre', genre, count(*)
+		FROM matched, unnest(genres) AS genre
+		GROUP BY genre
+		UNION ALL
+		SELECT 'decade', (year / 10 * 10)::text, count(*)
+		FROM matched
+		GROUP BY year / 10 * 10
+		UNION ALL
+		SELECT 'runtime', (%s)::text, count(*)
+		FROM matched
+		GROUP BY 2`,
+		filter.where(&args), runtimeBucketExpression())
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := &MovieFacets{
+		Genres:   []GenreCount{},
+		Decades:  []DecadeCount{},
+		Runtimes: make([]RuntimeBucketCount, len(RuntimeBuckets)),
+	}
+	for i, bucket := range RuntimeBuckets {
+		facets.Runtimes[i].RuntimeBucket = bucket
+	}
+
+	for rows.Next() {
+		var (
+			facet, value string
+			count        int64
+		)
+		err = rows.Scan(&facet, &value, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		switch facet {
+		case "genre":
+			facets.Genres = append(facets.Genres, GenreCount{Genre: value, Count: count})
+		case "decade":
+			decade, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			facets.Decades = append(facets.Decades, DecadeCount{Decade: int32(decade), Count: count})
+		case "runtime":
+			i, err := strconv.Atoi(value)
+			if err != nil || i < 0 || i >= len(facets.Runtimes) {
+				return nil, fmt.Errorf("unexpected runtime bucket %q", value)
+			}
+			facets.Runtimes[i].Count = count
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(facets.Genres, func(a, b GenreCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Genre, b.Genre)
+	})
+	slices.SortFunc(facets.Decades, func(a, b DecadeCount) int {
+		return cmp.Compare(a.Decade, b.Decade)
+	})
+
+	return facets, nil
+}
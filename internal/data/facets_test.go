@@ -0,0 +1,19 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+func TestRuntimeBucketExpression(t *testing.T) {
+	assert.Equal(t, runtimeBucketExpression(),
+		"CASE WHEN runtime <= 89 THEN 0 WHEN runtime <= 119 THEN 1 WHEN runtime <= 149 THEN 2 ELSE 3 END")
+}
+
+func TestRuntimeBucketsAreContiguous(t *testing.T) {
+	for i := 1; i < len(RuntimeBuckets); i++ {
+		assert.Equal(t, RuntimeBuckets[i].Min, RuntimeBuckets[i-1].Max+1)
+	}
+	assert.Equal(t, RuntimeBuckets[len(RuntimeBuckets)-1].Max, int32(0))
+}
@@ -1,21 +1,43 @@
 package data
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"strings"
 
 	validator "github.com/kvnloughead/greenlight/internal"
 )
 
-// Metadata is a struct that contains pagination data.
+// ErrInvalidCursor is returned by DecodeCursor if a cursor can't be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Metadata is a struct that contains pagination data. With cursor pagination,
+// only PageSize, the cursors, and (if requested) TotalRecords are set.
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
 }
 
+// calculateMetadata returns the pagination metadata for offset pagination. If
+// totalRecords is negative, the total is unknown, and the last page is
+// omitted.
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords < 0 {
+		return Metadata{
+			CurrentPage: page,
+			PageSize:    pageSize,
+			FirstPage:   1,
+		}
+	}
+
 	if totalRecords == 0 {
 		return Metadata{}
 	}
@@ -30,11 +52,90 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 	}
 }
 
+// Filters contains the sorting and pagination parameters of a list request.
+//
+// If Cursor is nil, offset pagination is used, and Page selects the page. If
+// Cursor is non-nil, keyset pagination is used, and Page is ignored. Keyset
+// pagination doesn't slow down on deep pages, since it doesn't need to scan
+// and discard the rows of earlier pages.
+//
+// IncludeTotal determines whether the total number of matching records is
+// counted, which requires a scan of every matching record.
+//
+// Fields are the fields of the records to select. If it is empty, every field
+// is selected. Unknown fields are ignored, so they should be validated against
+// a safelist first.
 type Filters struct {
 	Page         int
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	Cursor       *Cursor
+	IncludeTotal bool
+	Fields       []string
+}
+
+// A Cursor is an opaque pointer into a sorted list of records, used for keyset
+// pagination. It contains the value of the sort key and the ID of the record
+// at the edge of a page. IDs are used as a tiebreaker, so that the sort order
+// is total.
+//
+// A forward cursor selects the records after the edge, and a backward cursor
+// selects the records before it. The zero Cursor selects the first page.
+type Cursor struct {
+	Sort     string `json:"s,omitempty"`
+	Value    any    `json:"v,omitempty"`
+	ID       int64  `json:"i,omitempty"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// IsStart returns true if the cursor selects the first page.
+func (c *Cursor) IsStart() bool {
+	return c.ID == 0
+}
+
+// Encode returns the cursor as an opaque, URL-safe string.
+func (c Cursor) Encode() string {
+	js, err := json.Marshal(c)
+	if err != nil {
+		// Cursor values are always strings or numbers read from the database, so
+		// this can only happen if there is an issue with our app's logic.
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// DecodeCursor decodes a cursor that was encoded by Cursor.Encode. The empty
+// string decodes to the zero Cursor, which selects the first page. An
+// ErrInvalidCursor error is returned if the string isn't a valid cursor.
+func DecodeCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return &Cursor{}, nil
+	}
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	// Numbers are decoded as json.Number, so that IDs and other integer sort
+	// values are passed to postgresql unchanged.
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	var c Cursor
+	err = dec.Decode(&c)
+	if err != nil || c.ID < 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	switch c.Value.(type) {
+	case nil, string, json.Number:
+	default:
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
 }
 
 // sortColumn returns the column to sort by from the filter's Sort field.
@@ -70,12 +171,56 @@ func (f *Filters) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
+// keyset returns the SQL condition and ORDER BY clause used for keyset
+// pagination, where column is the expression being sorted by. The cursor's
+// values are appended to args.
+//
+// Records are ordered by the sort column in the requested direction, and then
+// by ID in ascending order. Backward cursors reverse the order, so that the
+// records closest to the cursor come first, and the caller must reverse the
+// resulting records.
+func (f *Filters) keyset(column string, args *queryArgs) (condition, orderBy string) {
+	asc := f.sortDirection() == "ASC"
+	if f.Cursor.Backward {
+		asc = !asc
+	}
+
+	direction, comparison := "DESC", "<"
+	if asc {
+		direction, comparison = "ASC", ">"
+	}
+
+	idDirection, idComparison := "ASC", ">"
+	if f.Cursor.Backward {
+		idDirection, idComparison = "DESC", "<"
+	}
+
+	orderBy = fmt.Sprintf("%s %s, id %s", column, direction, idDirection)
+
+	if f.Cursor.IsStart() {
+		return "TRUE", orderBy
+	}
+
+	value, id := args.add(f.Cursor.Value), args.add(f.Cursor.ID)
+	condition = fmt.Sprintf("(%s %s %s OR (%s = %s AND id %s %s))",
+		column, comparison, value, column, value, idComparison, id)
+
+	return condition, orderBy
+}
+
+// ValidateFilters checks the pagination and sorting parameters. If a cursor is
+// provided, it must have been created for the same sort key.
 func ValidateFilters(v *validator.Validator, f Filters) {
 
-	v.Check(f.Page >= 1, "page", "must be at least 1")
-	v.Check(f.Page <= 10_000_000, "page", "must be no more than least 10,000,000")
-	v.Check(f.PageSize >= 1, "page_size", "must be at least 1")
-	v.Check(f.PageSize <= 100, "page_size", "must be no more than 100")
+	v.CheckCode(f.Page >= 1, "page", validator.CodeOutOfRange, "must be at least 1", "min", 1)
+	v.CheckCode(f.Page <= 10_000_000, "page", validator.CodeOutOfRange, "must be no more than least 10,000,000", "max", 10_000_000)
+	v.CheckCode(f.PageSize >= 1, "page_size", validator.CodeOutOfRange, "must be at least 1", "min", 1)
+	v.CheckCode(f.PageSize <= 100, "page_size", validator.CodeOutOfRange, "must be no more than 100", "max", 100)
 
-	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sorting key")
+	v.CheckCode(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort",
+		validator.CodeNotPermitted, "invalid sorting key", "permitted", f.SortSafelist)
+
+	if f.Cursor != nil {
+		v.CheckCode(f.Cursor.IsStart() || f.Cursor.Sort == f.Sort, "cursor", validator.CodeConflict, "does not match the sorting key")
+	}
 }
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor Cursor
+		value  any
+	}{
+		{"String value", Cursor{Sort: "-title", Value: "Moana", ID: 7}, "Moana"},
+		{"Integer value", Cursor{Sort: "year", Value: int32(1999), ID: 3, Backward: true}, json.Number("1999")},
+		// Runtimes are read from the database as integers, rather than taken from
+		// Movie.Runtime, which would be encoded as "<runtime> mins".
+		{"Runtime value", Cursor{Sort: "runtime", Value: int64(170), ID: 5}, json.Number("170")},
+		{"Start", Cursor{}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := DecodeCursor(tt.cursor.Encode())
+			assert.IsNil(t, err)
+			assert.Equal(t, c.Sort, tt.cursor.Sort)
+			assert.Equal(t, c.ID, tt.cursor.ID)
+			assert.Equal(t, c.Backward, tt.cursor.Backward)
+			assert.Equal(t, c.Value, tt.value)
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	for _, s := range []string{"not base64!", "bm90IGpzb24", "eyJ2Ijp7fX0"} {
+		_, err := DecodeCursor(s)
+		assert.Equal(t, errors.Is(err, ErrInvalidCursor), true)
+	}
+}
+
+func TestFiltersKeyset(t *testing.T) {
+	tests := []struct {
+		name          string
+		sort          string
+		cursor        Cursor
+		wantCondition string
+		wantOrderBy   string
+	}{
+		{
+			name:          "Start",
+			sort:          "title",
+			cursor:        Cursor{},
+			wantCondition: "TRUE",
+			wantOrderBy:   "title ASC, id ASC",
+		},
+		{
+			name:          "Ascending",
+			sort:          "title",
+			cursor:        Cursor{Sort: "title", Value: "Moana", ID: 7},
+			wantCondition: "(title > $1 OR (title = $1 AND id > $2))",
+			wantOrderBy:   "title ASC, id ASC",
+		},
+		{
+			name:          "Descending",
+			sort:          "-year",
+			cursor:        Cursor{Sort: "-year", Value: 1999, ID: 7},
+			wantCondition: "(year < $1 OR (year = $1 AND id > $2))",
+			wantOrderBy:   "year DESC, id ASC",
+		},
+		{
+			name:          "Runtime",
+			sort:          "runtime",
+			cursor:        Cursor{Sort: "runtime", Value: json.Number("170"), ID: 5},
+			wantCondition: "(runtime > $1 OR (runtime = $1 AND id > $2))",
+			wantOrderBy:   "runtime ASC, id ASC",
+		},
+		{
+			name:          "Backward",
+			sort:          "-year",
+			cursor:        Cursor{Sort: "-year", Value: 1999, ID: 7, Backward: true},
+			wantCondition: "(year > $1 OR (year = $1 AND id < $2))",
+			wantOrderBy:   "year ASC, id DESC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filters{Sort: tt.sort, SortSafelist: []string{tt.sort}, Cursor: &tt.cursor}
+			args := queryArgs{}
+
+			condition, orderBy := f.keyset(f.sortColumn(), &args)
+			assert.Equal(t, condition, tt.wantCondition)
+			assert.Equal(t, orderBy, tt.wantOrderBy)
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/lib/pq"
+)
+
+// ErrDuplicateGenre is returned by GenreModel.Insert if a genre already
+// exists with the same slug.
+var ErrDuplicateGenre = errors.New("duplicate genre")
+
+// SlugRX matches a genre slug, which is lowercase words and numbers separated
+// by single hyphens, such as "science-fiction".
+var SlugRX = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// slugSeparatorRX matches the runs of characters that are replaced by a hyphen
+// in a slug.
+var slugSeparatorRX = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Genre is a struct representing a genre in the taxonomy. Movies refer to
+// genres by their slugs. Aliases are other lowercase spellings of the genre,
+// which are mapped to its slug when movies are written. MovieCount is the
+// number of movies in the genre, not counting those in the trash.
+type Genre struct {
+	Slug       string    `json:"slug"`
+	CreatedAt  time.Time `json:"-"`
+	Name       string    `json:"name"`
+	Aliases    []string  `json:"aliases"`
+	MovieCount int       `json:"movie_count"`
+	Version    int32     `json:"version"`
+}
+
+// GenreModel struct wraps an sql.DB connection pool and implements
+// operations on the genres table.
+type GenreModel struct {
+	DB *sql.DB
+}
+
+// GenreTaxonomy maps the lowercase slugs, names, and aliases of the genres in
+// the taxonomy to their slugs.
+type GenreTaxonomy map[string]string
+
+// Slugify returns the slug of a genre's name. For example, the slug of
+// "Science Fiction" is "science-fiction".
+func Slugify(name string) string {
+	return strings.Trim(slugSeparatorRX.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// Resolve returns the slug of the genre that a name refers to, ignoring case.
+// The name can be a genre's slug, name, or one of its aliases, or have the
+// same slug as one of them. If no genre matches, ok is false.
+func (t GenreTaxonomy) Resolve(name string) (slug string, ok bool) {
+	if slug, ok = t[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return slug, true
+	}
+	slug, ok = t[Slugify(name)]
+	return slug, ok
+}
+
+// ValidateGenre validates the fields of a Genre struct.
+//
+//   - Slug is required, and must be lowercase words and numbers separated by
+//     hyphens, less than 100 bytes.
+//   - Name is required, and must be less than 100 bytes.
+//   - There must be no more than 20 aliases, which must be lowercase, unique,
+//     and non-empty.
+func ValidateGenre(v *validator.Validator, g *Genre) {
+	v.CheckCode(g.Slug != "", "slug", validator.CodeRequired, "must be provided")
+	v.CheckCode(validator.Matches(g.Slug, SlugRX), "slug", validator.CodeInvalidFormat,
+		"must contain only lowercase letters, numbers, and single hyphens")
+	v.CheckCode(len(g.Slug) < 100, "slug", validator.CodeTooLong, "must be less than 100 bytes", "max", 99)
+
+	v.CheckCode(g.Name != "", "name", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(g.Name) < 100, "name", validator.CodeTooLong, "must be less than 100 bytes", "max", 99)
+
+	v.CheckCode(len(g.Aliases) <= 20, "aliases", validator.CodeTooLong, "must be no more than 20 aliases", "max", 20)
+	for i, alias := range g.Aliases {
+		v.CheckCode(alias != "", validator.Path("aliases", i), validator.CodeRequired, "must be provided")
+		v.CheckCode(alias == strings.ToLower(alias), validator.Path("aliases", i), validator.CodeInvalidFormat, "must be lowercase")
+		v.CheckCode(len(alias) < 100, validator.Path("aliases", i), validator.CodeTooLong, "must be less than 100 bytes", "max", 99)
+	}
+	for _, i := range validator.Duplicates(g.Aliases) {
+		v.AddErrorCode(validator.Path("aliases", i), validator.CodeDuplicate, "must not contain duplicate values", "value", g.Aliases[i])
+	}
+}
+
+// Taxonomy returns the GenreTaxonomy of all genres.
+func (m GenreModel) Taxonomy() (GenreTaxonomy, error) {
+	query := `SELECT slug, name, aliases FROM genres`
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taxonomy := GenreTaxonomy{}
+
+	for rows.Next() {
+		var slug, name string
+		var aliases []string
+		err = rows.Scan(&slug, &name, pq.Array(&aliases))
+		if err != nil {
+			return nil, err
+		}
+
+		taxonomy[slug] = slug
+		taxonomy[strings.ToLower(name)] = slug
+		for _, alias := range aliases {
+			taxonomy[alias] = slug
+		}
+	}
+
+	return taxonomy, rows.Err()
+}
+
+// Insert adds a new record to the genres table. The created_at and version
+// fields are generated automatically. If a genre already exists with the same
+// slug, an ErrDuplicateGenre error is returned.
+func (m GenreModel) Insert(genre *Genre) error {
+	query := `
+		INSERT INTO genres (slug, name, aliases)
+		VALUES ($1, $2, $3)
+		RETURNING created_at, version`
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, genre.Slug, genre.Name, pq.Array(genre.Aliases)).Scan(
+		&genre.CreatedAt, &genre.Version)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Constraint == "genres_pkey" {
+			return ErrDuplicateGenre
+		}
+		return err
+	}
+
+	return nil
+}
+
+// genreSelect selects the columns of a Genre, with the number of movies in
+// the genre that aren't in the trash.
+const genreSelect = `
+	SELECT genres.slug, genres.created_at, genres.name, genres.aliases, count(movies.id), genres.version
+	FROM genres
+	LEFT JOIN movies ON movies.genres @> ARRAY[genres.slug] AND movies.deleted_at IS NULL`
+
+// Get retrieves the genre with a slug, and its movie count. If there is no
+// matching record, an ErrRecordNotFound error is returned.
+func (m GenreModel) Get(slug string) (*Genre, error) {
+	query := genreSelect + `
+		WHERE genres.slug = $1
+		GROUP BY genres.slug`
+
+	var genre Genre
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, slug).Scan(
+		&genre.Slug,
+		&genre.CreatedAt,
+		&genre.Name,
+		pq.Array(&genre.Aliases),
+		&genre.MovieCount,
+		&genre.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &genre, nil
+}
+
+// GetAll retrieves every genre, with its movie count, sorted by name.
+func (m GenreModel) GetAll() ([]*Genre, error) {
+	query := genreSelect + `
+		GROUP BY genres.slug
+		ORDER BY genres.name, genres.slug`
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		var genre Genre
+		err = rows.Scan(
+			&genre.Slug,
+			&genre.CreatedAt,
+			&genre.Name,
+			pq.Array(&genre.Aliases),
+			&genre.MovieCount,
+			&genre.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, &genre)
+	}
+
+	return genres, rows.Err()
+}
+
+// Merge merges the genre with the slug source into the genre with the slug
+// target, in a single transaction. Movies in the source genre, including
+// those in the trash, are moved to the target genre, and their versions are
+// incremented. The source's slug, name, and aliases become aliases of the
+// target, and the source is deleted.
+//
+// The number of movies that were changed is returned. If either genre doesn't
+// exist, no changes are made, and an ErrRecordNotFound error is returned.
+func (m GenreModel) Merge(source, target string) (int64, error) {
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	// Rolling back a committed transaction does nothing.
+	defer tx.Rollback()
+
+	// Lock both genres, so that they can't change until the merge is done.
+	var name string
+	var aliases []string
+	err = tx.QueryRowContext(ctx, `SELECT name, aliases FROM genres WHERE slug = $1 FOR UPDATE`, source).Scan(
+		&name, pq.Array(&aliases))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT true FROM genres WHERE slug = $1 FOR UPDATE`, target).Scan(&exists)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	// Replace the source with the target, keeping the first of them if a movie
+	// already had both.
+	query := `
+		UPDATE movies SET
+			genres = ARRAY(
+				SELECT genre
+				FROM unnest(array_replace(genres, $1, $2)) WITH ORDINALITY AS t(genre, n)
+				GROUP BY genre
+				ORDER BY min(n)
+			),
+			version = version + 1
+		WHERE genres @> ARRAY[$1::text]`
+
+	result, err := tx.ExecContext(ctx, query, source, target)
+	if err != nil {
+		return 0, err
+	}
+
+	moviesUpdated, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM genres WHERE slug = $1`, source)
+	if err != nil {
+		return 0, err
+	}
+
+	query = `
+		UPDATE genres SET
+			aliases = ARRAY(
+				SELECT DISTINCT alias
+				FROM unnest(aliases || $2::text[]) AS alias
+				WHERE alias <> slug AND alias <> lower(name)
+				ORDER BY alias
+			),
+			version = version + 1
+		WHERE slug = $1`
+
+	aliases = append(aliases, source, strings.ToLower(name))
+	_, err = tx.ExecContext(ctx, query, target, pq.Array(aliases))
+	if err != nil {
+		return 0, err
+	}
+
+	return moviesUpdated, tx.Commit()
+}
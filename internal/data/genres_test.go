@@ -0,0 +1,130 @@
+package data
+
+import (
+	"testing"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Science Fiction", "science-fiction"},
+		{"Sci-Fi", "sci-fi"},
+		{"  Film-Noir!  ", "film-noir"},
+		{"Rock & Roll", "rock-roll"},
+		{"!!!", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Slugify(tt.name), tt.want)
+		})
+	}
+}
+
+func TestGenreTaxonomyResolve(t *testing.T) {
+	taxonomy := GenreTaxonomy{
+		"science-fiction": "science-fiction",
+		"science fiction": "science-fiction",
+		"sci-fi":          "science-fiction",
+		"drama":           "drama",
+	}
+
+	tests := []struct {
+		name     string
+		genre    string
+		wantSlug string
+		wantOK   bool
+	}{
+		{"Slug", "science-fiction", "science-fiction", true},
+		{"Name", "Science Fiction", "science-fiction", true},
+		{"Alias", "SCI-FI", "science-fiction", true},
+		{"Same slug", "Science  Fiction!", "science-fiction", true},
+		{"Unknown", "Western", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slug, ok := taxonomy.Resolve(tt.genre)
+			assert.Equal(t, slug, tt.wantSlug)
+			assert.Equal(t, ok, tt.wantOK)
+		})
+	}
+}
+
+func TestMovieFilterResolveGenres(t *testing.T) {
+	taxonomy := GenreTaxonomy{
+		"science-fiction": "science-fiction",
+		"science fiction": "science-fiction",
+		"sci-fi":          "science-fiction",
+		"drama":           "drama",
+	}
+
+	filter := MovieFilter{Genres: []string{"Sci-Fi", "Science  Fiction!", "DRAMA", " Western "}}
+	filter.ResolveGenres(taxonomy)
+
+	want := []string{"science-fiction", "science-fiction", "drama", "western"}
+	assert.Equal(t, len(filter.Genres), len(want))
+	for i := range want {
+		assert.Equal(t, filter.Genres[i], want[i])
+	}
+}
+
+func TestValidateMovieGenres(t *testing.T) {
+	taxonomy := GenreTaxonomy{
+		"science-fiction": "science-fiction",
+		"sci-fi":          "science-fiction",
+		"drama":           "drama",
+	}
+
+	tests := []struct {
+		name       string
+		genres     []string
+		wantGenres []string
+		wantCode   map[string]string
+	}{
+		{
+			name:       "Aliases are mapped",
+			genres:     []string{"Sci-Fi", "Drama"},
+			wantGenres: []string{"science-fiction", "drama"},
+			wantCode:   map[string]string{},
+		},
+		{
+			name:       "Unknown genre",
+			genres:     []string{"drama", "Western"},
+			wantGenres: []string{"drama", "Western"},
+			wantCode:   map[string]string{"genres[1]": validator.CodeNotFound},
+		},
+		{
+			name:       "Duplicate after mapping",
+			genres:     []string{"sci-fi", "science-fiction"},
+			wantGenres: []string{"science-fiction", "science-fiction"},
+			wantCode:   map[string]string{"genres[1]": validator.CodeDuplicate},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			movie := &Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: tt.genres}
+
+			v := validator.New()
+			ValidateMovie(v, movie, taxonomy)
+
+			assert.Equal(t, len(movie.Genres), len(tt.wantGenres))
+			for i := range tt.wantGenres {
+				assert.Equal(t, movie.Genres[i], tt.wantGenres[i])
+			}
+
+			assert.Equal(t, len(v.Details), len(tt.wantCode))
+			for path, code := range tt.wantCode {
+				errs := v.Details[path]
+				assert.Equal(t, len(errs), 1)
+				assert.Equal(t, errs[0].Code, code)
+			}
+		})
+	}
+}
@@ -0,0 +1,540 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrDuplicateEntry is returned by ListModel.AddEntry if the movie is
+	// already in the list.
+	ErrDuplicateEntry = errors.New("duplicate list entry")
+
+	// ErrListFull is returned by ListModel.AddEntry if the list already has
+	// the maximum number of movies.
+	ErrListFull = errors.New("list is full")
+
+	// ErrOrderMismatch is returned by ListModel.Reorder if the new order
+	// doesn't contain every movie in the list exactly once.
+	ErrOrderMismatch = errors.New("order doesn't match list entries")
+)
+
+// ListPrivacies are the permitted values of List.Privacy. Private lists are
+// only visible to their owners, unlisted lists are visible to anyone with
+// their ID, and public lists are also listed on their owners' profiles.
+var ListPrivacies = []string{"private", "unlisted", "public"}
+
+// maxListEntries is the maximum number of movies in a list.
+const maxListEntries = 1000
+
+// List is a struct representing a user's list of movies. Watchlist is true
+// for the user's default list, which can't be deleted. EntryCount is the
+// number of movies in the list, not counting those in the trash. Entries are
+// only set when a single list is read.
+type List struct {
+	ID         int64       `json:"id"`
+	UserID     int64       `json:"user_id"`
+	Name       string      `json:"name"`
+	Privacy    string      `json:"privacy"`
+	Watchlist  bool        `json:"watchlist"`
+	EntryCount int         `json:"entry_count"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+	Version    int32       `json:"version"`
+	Entries    []ListEntry `json:"entries,omitempty"`
+}
+
+// ListEntry is a movie in a list, with its position and an optional note.
+// Entries are ordered by position, which needn't be contiguous.
+type ListEntry struct {
+	MovieID  int64     `json:"movie_id"`
+	Title    string    `json:"title"`
+	Year     int32     `json:"year"`
+	Position int       `json:"position"`
+	Note     string    `json:"note,omitempty"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+// VisibleTo returns true if the list can be seen by the user with the given
+// ID. Only private lists are hidden from users other than their owner.
+func (l *List) VisibleTo(userID int64) bool {
+	return l.UserID == userID || l.Privacy != "private"
+}
+
+// ListModel struct wraps an sql.DB connection pool and implements operations
+// on the lists and list_entries tables.
+type ListModel struct {
+	DB *sql.DB
+}
+
+// ValidateList validates the fields of a List struct. The name is required,
+// and must be less than 100 bytes. The privacy must be one of ListPrivacies.
+func ValidateList(v *validator.Validator, l *List) {
+	v.CheckCode(l.Name != "", "name", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(l.Name) < 100, "name", validator.CodeTooLong, "must be less than 100 bytes", "max", 99)
+
+	v.CheckCode(validator.PermittedValue(l.Privacy, ListPrivacies...), "privacy",
+		validator.CodeNotPermitted, "must be private, unlisted, or public", "permitted", ListPrivacies)
+}
+
+// ValidateListNote checks that the note of a list entry, which is optional,
+// is less than 1,000 bytes.
+func ValidateListNote(v *validator.Validator, note string) {
+	v.CheckCode(len(note) < 1_000, "note", validator.CodeTooLong, "must be less than 1,000 bytes", "max", 999)
+}
+
+// ValidateListOrder checks the new order of a list's movies. It must not be
+// empty, or contain duplicates. Whether it contains every movie in the list
+// is checked by ListModel.Reorder.
+func ValidateListOrder(v *validator.Validator, movieIDs []int64) {
+	v.CheckCode(movieIDs != nil, "movie_ids", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(movieIDs) <= maxListEntries, "movie_ids", validator.CodeTooLong,
+		"must not contain more than 1,000 movies", "max", maxListEntries)
+	for _, i := range validator.Duplicates(movieIDs) {
+		v.AddErrorCode(validator.Path("movie_ids", i), validator.CodeDuplicate, "must not contain duplicate values", "value", movieIDs[i])
+	}
+}
+
+// Insert adds a new list to the lists table. The list's UserID must be set.
+// The id, timestamps, and version are generated automatically.
+func (m ListModel) Insert(list *List) error {
+	query := `
+		INSERT INTO lists (user_id, name, privacy, watchlist)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at, version`
+
+	args := []any{list.UserID, list.Name, list.Privacy, list.Watchlist}
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&list.ID, &list.CreatedAt, &list.UpdatedAt, &list.Version)
+}
+
+// InsertWatchlist creates a user's watchlist, which is a private list named
+// "Watchlist".
+func (m ListModel) InsertWatchlist(userID int64) error {
+	return m.Insert(&List{UserID: userID, Name: "Watchlist", Privacy: "private", Watchlist: true})
+}
+
+// listColumns are the columns of a List, with its entry count.
+const listColumns = `
+	lists.id, lists.user_id, lists.name, lists.privacy, lists.watchlist,
+	(SELECT count(*) FROM list_entries
+	 JOIN movies ON movies.id = list_entries.movie_id
+	 WHERE list_entries.list_id = lists.id AND movies.deleted_at IS NULL),
+	lists.created_at, lists.updated_at, lists.version`
+
+// dests returns the destinations to scan listColumns into.
+func (l *List) dests() []any {
+	return []any{
+		&l.ID,
+		&l.UserID,
+		&l.Name,
+		&l.Privacy,
+		&l.Watchlist,
+		&l.EntryCount,
+		&l.CreatedAt,
+		&l.UpdatedAt,
+		&l.Version,
+	}
+}
+
+// Get retrieves a specific list by its ID, without its entries. If there is
+// no matching record, an ErrRecordNotFound error is returned.
+func (m ListModel) Get(id int64) (*List, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + listColumns + `
+		FROM lists
+		WHERE lists.id = $1`
+
+	var list List
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(list.dests()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &list, nil
+}
+
+// GetEntries retrieves the entries of a list in order, with the titles and
+// years of their movies. Movies in the trash are left out.
+func (m ListModel) GetEntries(listID int64) ([]ListEntry, error) {
+	query := `
+		SELECT movies.id, movies.title, movies.year, list_entries.position, list_entries.note, list_entries.added_at
+		FROM list_entries
+		JOIN movies ON movies.id = list_entries.movie_id
+		WHERE list_entries.list_id = $1 AND movies.deleted_at IS NULL
+		ORDER BY list_entries.position, list_entries.added_at, movies.id`
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []ListEntry{}
+
+	for rows.Next() {
+		var e ListEntry
+		err = rows.Scan(&e.MovieID, &e.Title, &e.Year, &e.Position, &e.Note, &e.AddedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetAllForUser retrieves a page of a user's lists, without their entries,
+// sorted and paginated by the Filters. If publicOnly is true, only public
+// lists are returned.
+func (m ListModel) GetAllForUser(userID int64, publicOnly bool, filters Filters) ([]*List, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM lists
+		WHERE lists.user_id = $1 AND (NOT $2 OR lists.privacy = 'public')
+		ORDER BY lists.%s %s, lists.id ASC
+		LIMIT $3 OFFSET $4`, listColumns, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, publicOnly, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	lists := []*List{}
+
+	for rows.Next() {
+		var list List
+		err = rows.Scan(append([]any{&totalRecords}, list.dests()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		lists = append(lists, &list)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return lists, metadata, nil
+}
+
+// Update updates the name and privacy of a list. Its updated_at time is set,
+// and its version is incremented. If the version doesn't match, or the list
+// was deleted, an ErrEditConflict error is returned.
+func (m ListModel) Update(list *List) error {
+	query := `
+		UPDATE lists
+		SET name = $1, privacy = $2, updated_at = NOW(), version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING updated_at, version`
+
+	args := []any{list.Name, list.Privacy, list.ID, list.Version}
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&list.UpdatedAt, &list.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete permanently deletes a list and its entries. Watchlists aren't
+// deleted. The list is only deleted if its version still matches
+// list.Version, so that changes made since it was fetched aren't silently
+// thrown away. If there is no matching list that isn't a watchlist, an
+// ErrEditConflict error is returned.
+func (m ListModel) Delete(list *List) error {
+	if list.ID < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM lists WHERE id = $1 AND version = $2 AND NOT watchlist`,
+		list.ID, list.Version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// AddEntry adds a movie to the end of a list. The entry's Position and
+// AddedAt are set. If the movie is already in the list, an ErrDuplicateEntry
+// error is returned, and if the list has 1,000 movies, an ErrListFull error is
+// returned. Like EntryCount, the limit doesn't count movies in the trash. If
+// the movie no longer exists, an ErrRecordNotFound error is returned. The
+// list's UpdatedAt and Version are set. If the list was changed or deleted
+// since it was fetched, an ErrEditConflict error is returned.
+func (m ListModel) AddEntry(list *List, entry *ListEntry) error {
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction does nothing.
+	defer tx.Rollback()
+
+	err = touchList(ctx, tx, list)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, `
+		SELECT count(*) FROM list_entries
+		JOIN movies ON movies.id = list_entries.movie_id
+		WHERE list_entries.list_id = $1 AND movies.deleted_at IS NULL`,
+		list.ID).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count >= maxListEntries {
+		return ErrListFull
+	}
+
+	query := `
+		INSERT INTO list_entries (list_id, movie_id, position, note)
+		SELECT $1, $2, COALESCE(max(position) + 1, 0), $3
+		FROM list_entries
+		WHERE list_id = $1
+		RETURNING position, added_at`
+
+	err = tx.QueryRowContext(ctx, query, list.ID, entry.MovieID, entry.Note).Scan(&entry.Position, &entry.AddedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			switch pqErr.Constraint {
+			case "list_entries_pkey":
+				return ErrDuplicateEntry
+			case "list_entries_movie_id_fkey":
+				return ErrRecordNotFound
+			}
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateEntry updates the note of a movie in a list. The rest of the entry,
+// including its movie's title and year, is set. If the movie isn't in the
+// list, or is in the trash, an ErrRecordNotFound error is returned. The list's
+// UpdatedAt and Version are set. If the list was changed or deleted since it
+// was fetched, an ErrEditConflict error is returned.
+func (m ListModel) UpdateEntry(list *List, entry *ListEntry) error {
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction does nothing.
+	defer tx.Rollback()
+
+	err = touchList(ctx, tx, list)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE list_entries SET note = $3
+		FROM movies
+		WHERE list_entries.list_id = $1 AND list_entries.movie_id = $2
+			AND movies.id = list_entries.movie_id AND movies.deleted_at IS NULL
+		RETURNING movies.title, movies.year, list_entries.position, list_entries.added_at`
+
+	err = tx.QueryRowContext(ctx, query, list.ID, entry.MovieID, entry.Note).Scan(
+		&entry.Title, &entry.Year, &entry.Position, &entry.AddedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RemoveEntry removes a movie from a list. If the movie isn't in the list, an
+// ErrRecordNotFound error is returned. The list's UpdatedAt and Version are
+// set. If the list was changed or deleted since it was fetched, an
+// ErrEditConflict error is returned.
+func (m ListModel) RemoveEntry(list *List, movieID int64) error {
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction does nothing.
+	defer tx.Rollback()
+
+	err = touchList(ctx, tx, list)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM list_entries WHERE list_id = $1 AND movie_id = $2`, list.ID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
+// Reorder sets the order of the movies in a list. movieIDs must contain every
+// movie in the list that isn't in the trash exactly once, or an
+// ErrOrderMismatch error is returned. Movies in the trash keep their
+// positions. The list's UpdatedAt and Version are set. If the list was changed
+// or deleted since it was fetched, an ErrEditConflict error is returned.
+func (m ListModel) Reorder(list *List, movieIDs []int64) error {
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction does nothing.
+	defer tx.Rollback()
+
+	err = touchList(ctx, tx, list)
+	if err != nil {
+		return err
+	}
+
+	var current []int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(array_agg(list_entries.movie_id), '{}')
+		FROM list_entries
+		JOIN movies ON movies.id = list_entries.movie_id
+		WHERE list_entries.list_id = $1 AND movies.deleted_at IS NULL`,
+		list.ID).Scan(pq.Array(&current))
+	if err != nil {
+		return err
+	}
+
+	if !sameMembers(current, movieIDs) {
+		return ErrOrderMismatch
+	}
+
+	query := `
+		UPDATE list_entries SET position = t.n - 1
+		FROM unnest($2::bigint[]) WITH ORDINALITY AS t(movie_id, n)
+		WHERE list_entries.list_id = $1 AND list_entries.movie_id = t.movie_id`
+
+	_, err = tx.ExecContext(ctx, query, list.ID, pq.Array(movieIDs))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// touchList sets a list's updated_at time and increments its version, since
+// its entries are about to change, and sets its UpdatedAt and Version. The
+// list's row stays locked until the end of the transaction, so changes to its
+// entries are serialized. If the list's version doesn't match list.Version,
+// or the list was deleted, an ErrEditConflict error is returned.
+func touchList(ctx context.Context, tx *sql.Tx, list *List) error {
+	err := tx.QueryRowContext(ctx, `
+		UPDATE lists SET updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND version = $2
+		RETURNING updated_at, version`,
+		list.ID, list.Version).Scan(&list.UpdatedAt, &list.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sameMembers returns true if a and b contain the same values, in any order.
+// Neither may contain duplicates.
+func sameMembers(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sorted := slices.Clone(b)
+	slices.Sort(sorted)
+	for _, v := range a {
+		if _, found := slices.BinarySearch(sorted, v); !found {
+			return false
+		}
+	}
+	return true
+}
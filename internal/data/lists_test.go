@@ -0,0 +1,106 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+func TestValidateList(t *testing.T) {
+	tests := []struct {
+		name     string
+		list     List
+		wantKey  string
+		wantCode string
+	}{
+		{"Valid", List{Name: "Favourites", Privacy: "public"}, "", ""},
+		{"Missing name", List{Privacy: "private"}, "name", validator.CodeRequired},
+		{"Long name", List{Name: strings.Repeat("a", 100), Privacy: "private"}, "name", validator.CodeTooLong},
+		{"Unknown privacy", List{Name: "Favourites", Privacy: "secret"}, "privacy", validator.CodeNotPermitted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateList(v, &tt.list)
+
+			if tt.wantCode == "" {
+				assert.Equal(t, v.Valid(), true)
+				return
+			}
+			assert.Equal(t, len(v.Details[tt.wantKey]), 1)
+			assert.Equal(t, v.Details[tt.wantKey][0].Code, tt.wantCode)
+		})
+	}
+}
+
+func TestValidateListOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		movieIDs []int64
+		wantKey  string
+		wantCode string
+	}{
+		{"Valid", []int64{3, 1, 2}, "", ""},
+		{"Empty list", []int64{}, "", ""},
+		{"Missing", nil, "movie_ids", validator.CodeRequired},
+		{"Duplicate", []int64{3, 1, 3}, "movie_ids[2]", validator.CodeDuplicate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateListOrder(v, tt.movieIDs)
+
+			if tt.wantCode == "" {
+				assert.Equal(t, v.Valid(), true)
+				return
+			}
+			assert.Equal(t, len(v.Details[tt.wantKey]), 1)
+			assert.Equal(t, v.Details[tt.wantKey][0].Code, tt.wantCode)
+		})
+	}
+}
+
+func TestSameMembers(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []int64
+		want bool
+	}{
+		{"Same order", []int64{1, 2, 3}, []int64{1, 2, 3}, true},
+		{"Different order", []int64{1, 2, 3}, []int64{3, 1, 2}, true},
+		{"Both empty", []int64{}, nil, true},
+		{"Missing member", []int64{1, 2, 3}, []int64{1, 2}, false},
+		{"Extra member", []int64{1, 2}, []int64{1, 2, 3}, false},
+		{"Different member", []int64{1, 2, 3}, []int64{1, 2, 4}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, sameMembers(tt.a, tt.b), tt.want)
+		})
+	}
+}
+
+func TestListVisibleTo(t *testing.T) {
+	tests := []struct {
+		privacy string
+		userID  int64
+		want    bool
+	}{
+		{"private", 1, true},
+		{"private", 2, false},
+		{"unlisted", 2, true},
+		{"public", 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.privacy, func(t *testing.T) {
+			list := List{UserID: 1, Privacy: tt.privacy}
+			assert.Equal(t, list.VisibleTo(tt.userID), tt.want)
+		})
+	}
+}
@@ -18,18 +18,38 @@ var (
 
 // Models is a struct that wraps all of our models.
 type Models struct {
-	Movies      MovieModel
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
+	Movies          MovieModel
+	People          PersonModel
+	Credits         CreditModel
+	Translations    TranslationModel
+	Releases        ReleaseModel
+	Genres          GenreModel
+	Ratings         RatingModel
+	Reviews         ReviewModel
+	Lists           ListModel
+	Diary           DiaryModel
+	Recommendations RecommendationModel
+	Users           UserModel
+	Tokens          TokenModel
+	Permissions     PermissionModel
 }
 
 // NewModels returns an empty instance of our Model struct.
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
+		Movies:          MovieModel{DB: db},
+		People:          PersonModel{DB: db},
+		Credits:         CreditModel{DB: db},
+		Translations:    TranslationModel{DB: db},
+		Releases:        ReleaseModel{DB: db},
+		Genres:          GenreModel{DB: db},
+		Ratings:         RatingModel{DB: db},
+		Reviews:         ReviewModel{DB: db},
+		Lists:           ListModel{DB: db},
+		Diary:           DiaryModel{DB: db},
+		Recommendations: RecommendationModel{DB: db},
+		Users:           UserModel{DB: db},
+		Tokens:          TokenModel{DB: db},
+		Permissions:     PermissionModel{DB: db},
 	}
 }
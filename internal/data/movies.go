@@ -1,9 +1,14 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"html"
+	"math"
+	"slices"
+	"strings"
 	"time"
 
 	validator "github.com/kvnloughead/greenlight/internal"
@@ -19,6 +24,135 @@ type Movie struct {
 	Runtime   Runtime   `json:"runtime,omitempty"`
 	Genres    []string  `json:"genres,omitempty"`
 	Version   int32     `json:"version"`
+
+	// DeletedAt is nil unless the movie has been moved to the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	// TitleHighlight is the title with the parts that match a title search
+	// wrapped in <mark> tags. It is HTML, so the rest of the title is escaped.
+	// It is only set by GetAll, if requested.
+	TitleHighlight string `json:"title_highlight,omitempty"`
+
+	// Rating is the aggregate of users' ratings of the movie. It isn't covered
+	// by the movie's version, since ratings don't change the movie itself.
+	Rating *MovieRating `json:"rating,omitempty"`
+
+	// OriginalTitle, Language, and Synopsis are only set if the movie was
+	// localized by Localize. Title is then the translated title, and Language
+	// is the tag of the translation, such as "es-MX".
+	OriginalTitle string `json:"original_title,omitempty"`
+	Language      string `json:"language,omitempty"`
+	Synopsis      string `json:"synopsis,omitempty"`
+}
+
+// Localize replaces the movie's title with a translation's, keeping the
+// original title in OriginalTitle, and sets its Language and Synopsis.
+func (m *Movie) Localize(t MovieTranslation) {
+	m.OriginalTitle = m.Title
+	m.Title = t.Title
+	m.Language = t.Tag()
+	m.Synopsis = t.Synopsis
+}
+
+// MovieRating is the aggregate of users' ratings of a movie, from 1 to 10.
+// Average is zero if there are no ratings. Score is a Bayesian estimate of
+// the movie's rating, which starts at the mean rating of the movies that
+// aren't in the trash, and moves towards the movie's average as it gets more
+// ratings, so that a few high ratings don't put a movie above a well-liked
+// one with many.
+type MovieRating struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+	Score   float64 `json:"score"`
+}
+
+// ratingPriorWeight is the number of ratings at the mean rating that a
+// movie's Bayesian score starts with.
+const ratingPriorWeight = 10
+
+// ratingScore is the SQL expression for a movie's Bayesian score. It is cast
+// to float8, so that its values survive a round trip through a pagination
+// cursor unchanged.
+var ratingScore = fmt.Sprintf(`((movies.rating_sum + %d * (
+		SELECT COALESCE(rating_stats.rating_sum::float8 / NULLIF(rating_stats.rating_count, 0), 0)
+		FROM rating_stats
+	)) / (movies.rating_count + %d))::float8`, ratingPriorWeight, ratingPriorWeight)
+
+// rating returns the movie's Rating, creating it if it is nil, so that it can
+// be scanned into.
+func (m *Movie) rating() *MovieRating {
+	if m.Rating == nil {
+		m.Rating = &MovieRating{}
+	}
+	return m.Rating
+}
+
+// MovieFields are the fields of a Movie that can be selected with a sparse
+// fieldset.
+var MovieFields = []string{"id", "title", "year", "runtime", "genres", "version", "deleted_at", "rating"}
+
+// MovieDetailFields are the fields that can be selected when a single movie
+// is shown. The synopsis is only set when a movie is localized, which isn't
+// done for lists of movies.
+var MovieDetailFields = append(slices.Clone(MovieFields), "synopsis")
+
+// movieColumns are the columns of the movies table, in the order they are
+// selected, with the fields they are returned in and the destinations they
+// are scanned into. The created_at column is only selected with every field,
+// since it isn't part of a movie's JSON representation. The rating field is
+// computed from several columns.
+var movieColumns = []struct {
+	field, column string
+	dest          func(m *Movie) any
+}{
+	{"id", "id", func(m *Movie) any { return &m.ID }},
+	{"", "created_at", func(m *Movie) any { return &m.CreatedAt }},
+	{"title", "title", func(m *Movie) any { return &m.Title }},
+	{"year", "year", func(m *Movie) any { return &m.Year }},
+	{"runtime", "runtime", func(m *Movie) any { return &m.Runtime }},
+	{"genres", "genres", func(m *Movie) any { return pq.Array(&m.Genres) }},
+	{"version", "version", func(m *Movie) any { return &m.Version }},
+	{"deleted_at", "deleted_at", func(m *Movie) any { return &m.DeletedAt }},
+	{"rating", "movies.rating_count", func(m *Movie) any { return &m.rating().Count }},
+	{"rating", "round(COALESCE(movies.rating_sum::numeric / NULLIF(movies.rating_count, 0), 0), 2)::float8",
+		func(m *Movie) any { return &m.rating().Average }},
+	{"rating", "round(" + ratingScore + "::numeric, 2)::float8", func(m *Movie) any { return &m.rating().Score }},
+}
+
+// movieProjection returns the columns to select for a sparse fieldset, and a
+// function that returns the destinations to scan them into. If fields is
+// empty, every column is selected. The id column is always selected, since
+// pagination cursors and links are built from it.
+//
+// The deleted_at column is only selected if withDeleted is true, in which
+// case it is always selected, since links depend on it too.
+func movieProjection(fields []string, withDeleted bool) (string, func(m *Movie) []any) {
+	var (
+		columns []string
+		dests   []func(m *Movie) any
+	)
+
+	for _, c := range movieColumns {
+		required := c.column == "id" || c.column == "deleted_at"
+		if c.column == "deleted_at" && !withDeleted {
+			continue
+		}
+		if len(fields) > 0 && !required && !slices.Contains(fields, c.field) {
+			continue
+		}
+		columns = append(columns, c.column)
+		dests = append(dests, c.dest)
+	}
+
+	scan := func(m *Movie) []any {
+		dst := make([]any, len(dests))
+		for i, dest := range dests {
+			dst[i] = dest(m)
+		}
+		return dst
+	}
+
+	return strings.Join(columns, ", "), scan
 }
 
 // MovieModel struct wraps an sql.DB connection pool and implements
@@ -27,37 +161,308 @@ type MovieModel struct {
 	DB *sql.DB
 }
 
+// MovieFilter contains the criteria that movies can be filtered by. The zero
+// value matches every movie that isn't in the trash.
+//
+//   - Title: if provided, matches on the movie's title, or any of its
+//     alternate titles, according to SearchMode.
+//   - SearchMode: "fulltext" (the default) matches titles containing the
+//     words of the search, "fuzzy" matches titles that are similar to the
+//     search, tolerating typos and partial words, and "prefix" matches titles
+//     that begin with the search.
+//   - Highlight: if true, and Title is provided, the movies returned by GetAll
+//     have their TitleHighlight set. It doesn't affect which movies match.
+//   - Genres: if provided, movies are matched against the genres according to
+//     GenresMode. Genres can be given by slug, name, or alias, and must be
+//     resolved to their slugs with ResolveGenres before the filter is used.
+//   - GenresMode: "all" (the default) matches movies with every genre, "any"
+//     matches movies with at least one of them, and "none" matches movies
+//     with none of them.
+//   - YearMin, YearMax, RuntimeMin, RuntimeMax: if non-zero, the inclusive
+//     bounds of the movie's year and runtime.
+//   - Person: if non-zero, matches movies that the person with this ID is
+//     credited on, in the role PersonRole if it is provided.
+//   - ReleasedIn, ReleasedAfter, ReleasedBefore, CertificationMax: if
+//     provided, match movies with a release that is in the country
+//     ReleasedIn, whose date is within the inclusive bounds, and whose
+//     certification is no more restrictive than CertificationMax. A single
+//     release must meet all of them. Without ReleasedIn, CertificationMax
+//     applies in every country whose system includes it.
+type MovieFilter struct {
+	Title      string
+	SearchMode string
+	Highlight  bool
+	Genres     []string
+	GenresMode string
+	YearMin    int
+	YearMax    int
+	RuntimeMin int
+	RuntimeMax int
+	Person     int
+	PersonRole string
+
+	ReleasedIn       string
+	ReleasedAfter    Date
+	ReleasedBefore   Date
+	CertificationMax string
+}
+
+// ResolveGenres replaces the filter's genres with their slugs in the
+// taxonomy, following the same rules as ValidateMovie, so that a genre matches
+// the movies it would be saved on. Unknown genres are kept, lowercased, so that
+// they match no movies.
+func (f *MovieFilter) ResolveGenres(taxonomy GenreTaxonomy) {
+	for i, genre := range f.Genres {
+		if slug, ok := taxonomy.Resolve(genre); ok {
+			f.Genres[i] = slug
+		} else {
+			f.Genres[i] = strings.ToLower(strings.TrimSpace(genre))
+		}
+	}
+}
+
+// GenresModes are the permitted values of MovieFilter.GenresMode.
+var GenresModes = []string{"all", "any", "none"}
+
+// SearchModes are the permitted values of MovieFilter.SearchMode.
+var SearchModes = []string{"fulltext", "fuzzy", "prefix"}
+
+// likeEscaper escapes the wildcard characters of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// queryArgs is a slice of arguments for a SQL query that is built up
+// dynamically.
+type queryArgs []any
+
+// add appends a value to the arguments and returns its placeholder.
+func (a *queryArgs) add(value any) string {
+	*a = append(*a, value)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// where returns the conditions of a SQL WHERE clause, without the WHERE
+// keyword, that match the movies that meet the filter's criteria. The values
+// the conditions refer to are appended to args.
+func (f MovieFilter) where(args *queryArgs) string {
+	conditions := []string{"deleted_at IS NULL"}
+
+	if f.Title != "" {
+		// Movies match if either their own title or one of their alternate
+		// titles does. Alternate titles use the 'simple' text search
+		// configuration, since they aren't in English.
+		var own, alternate string
+		switch f.SearchMode {
+		case "fuzzy":
+			// The % and <% operators are provided by the pg_trgm extension, and
+			// match titles whose trigrams are similar to those of the search,
+			// respectively as a whole or to some part of the title.
+			title := args.add(f.Title)
+			own = fmt.Sprintf("title %% %s OR %s <%% title", title, title)
+			alternate = fmt.Sprintf("movie_translations.title %% %s OR %s <%% movie_translations.title", title, title)
+		case "prefix":
+			pattern := args.add(likeEscaper.Replace(f.Title) + "%")
+			own = fmt.Sprintf("title ILIKE %s", pattern)
+			alternate = fmt.Sprintf("movie_translations.title ILIKE %s", pattern)
+		default:
+			title := args.add(f.Title)
+			own = fmt.Sprintf("to_tsvector('english', title) @@ plainto_tsquery('english', %s)", title)
+			alternate = fmt.Sprintf(
+				"to_tsvector('simple', movie_translations.title) @@ plainto_tsquery('simple', %s)", title)
+		}
+		conditions = append(conditions, fmt.Sprintf(
+			"(%s OR EXISTS (SELECT 1 FROM movie_translations WHERE movie_translations.movie_id = movies.id AND (%s)))",
+			own, alternate))
+	}
+
+	if len(f.Genres) > 0 {
+		// Genres should have been resolved to their slugs by ResolveGenres.
+		genres := fmt.Sprintf("%s::text[]", args.add(pq.Array(f.Genres)))
+
+		switch f.GenresMode {
+		case "any":
+			conditions = append(conditions, fmt.Sprintf("genres && %s", genres))
+		case "none":
+			conditions = append(conditions, fmt.Sprintf("NOT genres && %s", genres))
+		default:
+			conditions = append(conditions, fmt.Sprintf("genres @> %s", genres))
+		}
+	}
+
+	// Zero-valued bounds are omitted.
+	bounds := []struct {
+		condition string
+		value     int
+	}{
+		{"year >= %s", f.YearMin},
+		{"year <= %s", f.YearMax},
+		{"runtime >= %s", f.RuntimeMin},
+		{"runtime <= %s", f.RuntimeMax},
+	}
+	for _, bound := range bounds {
+		if bound.value != 0 {
+			conditions = append(conditions, fmt.Sprintf(bound.condition, args.add(bound.value)))
+		}
+	}
+
+	if f.Person != 0 {
+		credited := fmt.Sprintf("movie_credits.movie_id = movies.id AND movie_credits.person_id = %s", args.add(f.Person))
+		if f.PersonRole != "" {
+			credited += fmt.Sprintf(" AND movie_credits.role = %s", args.add(f.PersonRole))
+		}
+		conditions = append(conditions, fmt.Sprintf("EXISTS (SELECT 1 FROM movie_credits WHERE %s)", credited))
+	}
+
+	if released := f.releaseCondition(args); released != "" {
+		conditions = append(conditions, released)
+	}
+
+	return strings.Join(conditions, " AND ")
+}
+
+// sortExpression returns the SQL expression for a sort column. Most columns
+// sort by themselves, and the "rating" column sorts by the movie's Bayesian
+// score. The "relevance" column sorts by how closely titles match the title
+// search, with the most relevant movies first in ascending order. Relevance
+// is measured by ts_rank for fulltext searches, and by trigram similarity for
+// fuzzy and prefix searches. A movie's relevance is that of its own title or
+// of its most relevant alternate title, whichever is greater.
+//
+// Relevance is negated so that ascending order puts the most relevant movies
+// first, and it is cast to float8 so that its values survive a round trip
+// through a pagination cursor unchanged.
+//
+// A movie's score depends on the mean of every rating, so any rating can
+// change the scores of every movie. Keyset pagination by rating is therefore
+// only as stable as the ratings: if they change between requests, a cursor's
+// score no longer falls in the same place, and movies near the boundary can
+// be skipped or repeated.
+func (f MovieFilter) sortExpression(column string, args *queryArgs) string {
+	if column == "rating" {
+		return ratingScore
+	}
+	if column != "relevance" {
+		return column
+	}
+
+	title := args.add(f.Title)
+
+	// GREATEST ignores nulls, so movies without alternate titles are ranked by
+	// their own titles.
+	switch f.SearchMode {
+	case "fuzzy", "prefix":
+		return fmt.Sprintf(`-GREATEST(
+			similarity(title, %[1]s), word_similarity(%[1]s, title),
+			(SELECT max(GREATEST(similarity(movie_translations.title, %[1]s), word_similarity(%[1]s, movie_translations.title)))
+			 FROM movie_translations WHERE movie_translations.movie_id = movies.id))::float8`, title)
+	default:
+		return fmt.Sprintf(`-GREATEST(
+			ts_rank(to_tsvector('english', title), plainto_tsquery('english', %[1]s)),
+			(SELECT max(ts_rank(to_tsvector('simple', movie_translations.title), plainto_tsquery('simple', %[1]s)))
+			 FROM movie_translations WHERE movie_translations.movie_id = movies.id))::float8`, title)
+	}
+}
+
+// The database marks the matching parts of highlighted titles with these
+// control characters, rather than with <mark> tags, so that the rest of the
+// title can be HTML-escaped by markHighlight before the tags are added.
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// highlightOptions are the ts_headline options for title highlights. Titles
+// are short, so the whole title is returned rather than a fragment.
+const highlightOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", HighlightAll=true"
+
+// highlightMarker replaces the start and stop characters of a highlight from
+// the database with <mark> tags.
+var highlightMarker = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+// markHighlight turns a highlight from the database into HTML. The title is
+// escaped, and then its marked parts are wrapped in <mark> tags, so the only
+// markup in the result is the tags that were added. An empty highlight stays
+// empty.
+func markHighlight(s string) string {
+	return highlightMarker.Replace(html.EscapeString(s))
+}
+
+// headline returns the SQL expression for a movie's TitleHighlight, before it
+// is passed to markHighlight. If no highlight was requested, it is an empty
+// string.
+//
+// Fulltext and fuzzy searches are highlighted by ts_headline, which marks the
+// words of the title that match words of the search. Fuzzy matches that don't
+// share a whole word with the search are left unmarked, as are movies that
+// only matched by an alternate title. Prefix searches mark the start of the
+// title that matched. Movies that only matched a prefix search by an
+// alternate title have no highlight, since their own title doesn't start with
+// the search.
+func (f MovieFilter) headline(args *queryArgs) string {
+	if !f.Highlight || f.Title == "" {
+		return "''"
+	}
+
+	switch f.SearchMode {
+	case "prefix":
+		pattern := args.add(likeEscaper.Replace(f.Title) + "%")
+		title := args.add(f.Title)
+		return fmt.Sprintf(
+			"CASE WHEN title ILIKE %s THEN %s || left(title, char_length(%s::text)) || %s || substr(title, char_length(%s::text) + 1) ELSE '' END",
+			pattern, args.add(highlightStart), title, args.add(highlightStop), title)
+	default:
+		title := args.add(f.Title)
+		return fmt.Sprintf("ts_headline('english', title, plainto_tsquery('english', %s), %s)",
+			title, args.add(highlightOptions))
+	}
+}
+
 // GetAll retrieves a slice of movies from the database. The slice can be
-// filtered, sorted, and paginated via several optional query parameters.
+// filtered by the MovieFilter, and sorted and paginated by the Filters.
 //
-//   - title: if provided, fuzzy matches on the movie's title.
-//   - genres: if provided, only movies that have each of the provided genres
-//     are included.
 //   - sort: the key to sort by. Prepend with '-' for descending order. Defaults
 //     to ID, ascending.
 //   - page_size: the number of records to show per "page".
-//   - page: the page number to return.
+//   - page: the page number to return, if offset pagination is used.
+//   - cursor: the cursor to start from, if keyset pagination is used.
 //
-// Pagination metadata is returned in the response, unless no records are found.
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+// Movies in the trash are excluded. If the Filters have Fields, only those
+// fields of the movies are selected. Pagination metadata is returned in the
+// response, unless no records are found.
+func (m MovieModel) GetAll(filter MovieFilter, filters Filters) ([]*Movie, Metadata, error) {
+	if filters.Cursor != nil {
+		return m.getAllKeyset(filter, filters)
+	}
+
+	args := queryArgs{}
+	where := filter.where(&args)
+	sort := filter.sortExpression(filters.sortColumn(), &args)
+	headline := filter.headline(&args)
+	columns, scan := movieProjection(filters.Fields, false)
+
+	// The window function is only included if the total is requested, since it
+	// requires every matching row to be scanned.
+	total := "-1"
+	if filters.IncludeTotal {
+		total = "count(*) OVER()"
+	}
+
 	// We are using fmt.Sprintf to interpolate column names, since it is not
 	// possible to do that with postgresql placeholders.
 	query := fmt.Sprintf(`
 		SELECT 
-			count(*) OVER(),
-			id, created_at, title, year, runtime, genres, version
+			%s,
+			%s, %s
 		FROM movies
-		WHERE (to_tsvector('english', title)
-					 @@ plainto_tsquery('english', $1) OR $1 = '')
-		AND (genres @> $2 OR $2 = '{}')
+		WHERE %s
 		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+		LIMIT %s OFFSET %s`,
+		total, columns, headline, where, sort, filters.sortDirection(),
+		args.add(filters.limit()), args.add(filters.offset()))
 
 	ctx, cancel := CreateTimeoutContext(QueryTimeout)
 	defer cancel()
 
 	// Retrieve matching rows from database.
-	args := []any{title, pq.Array(genres), filters.limit(), filters.offset()}
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
@@ -65,26 +470,22 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 	defer rows.Close() // Defer closing after handling errors.
 
 	// totalRecords will receive the number of records returned by the query
-	// (i.e., the value of count(*) OVER()).
+	// (i.e., the value of count(*) OVER()), or -1 if it isn't counted.
 	totalRecords := 0
+	if !filters.IncludeTotal {
+		totalRecords = -1
+	}
 	movies := []*Movie{}
 
 	// Iterate through rows, reading each record in an entry in a Movie slice.
 	for rows.Next() {
 		var m Movie
-		err = rows.Scan(
-			&totalRecords,
-			&m.ID,
-			&m.CreatedAt,
-			&m.Title,
-			&m.Year,
-			&m.Runtime,
-			pq.Array(&m.Genres),
-			&m.Version,
-		)
+		dst := append([]any{&totalRecords}, scan(&m)...)
+		err = rows.Scan(append(dst, &m.TitleHighlight)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
+		m.TitleHighlight = markHighlight(m.TitleHighlight)
 		movies = append(movies, &m)
 	}
 
@@ -98,6 +499,261 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 	return movies, metadata, nil
 }
 
+// getAllKeyset implements GetAll for keyset pagination. One more row than
+// the page size is fetched, to find out whether there is another page in the
+// direction of travel. The total is counted in a separate query, if it is
+// requested.
+//
+// The value of the sort expression is selected along with each movie, so
+// that the cursors for the adjacent pages can be built from it.
+func (m MovieModel) getAllKeyset(filter MovieFilter, filters Filters) ([]*Movie, Metadata, error) {
+	args := queryArgs{}
+	where := filter.where(&args)
+	sort := filter.sortExpression(filters.sortColumn(), &args)
+	keyset, orderBy := filters.keyset(sort, &args)
+	headline := filter.headline(&args)
+	columns, scan := movieProjection(filters.Fields, false)
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s, %s
+		FROM movies
+		WHERE %s AND %s
+		ORDER BY %s
+		LIMIT %s`,
+		sort, columns, headline, where, keyset, orderBy, args.add(filters.limit()+1))
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+	sortValues := []any{}
+
+	for rows.Next() {
+		var m Movie
+		var sortValue any
+		dst := append([]any{&sortValue}, scan(&m)...)
+		err = rows.Scan(append(dst, &m.TitleHighlight)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		m.TitleHighlight = markHighlight(m.TitleHighlight)
+		movies = append(movies, &m)
+		sortValues = append(sortValues, sortValue)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	// If the extra row was found, there is another page beyond this one.
+	more := len(movies) > filters.limit()
+	if more {
+		movies = movies[:filters.limit()]
+		sortValues = sortValues[:filters.limit()]
+	}
+
+	// Backward pages are fetched in reverse order.
+	if filters.Cursor.Backward {
+		slices.Reverse(movies)
+		slices.Reverse(sortValues)
+	}
+
+	metadata := Metadata{PageSize: filters.PageSize}
+
+	if len(movies) > 0 {
+		first, last := movies[0], movies[len(movies)-1]
+		firstValue, lastValue := sortValues[0], sortValues[len(sortValues)-1]
+
+		// Moving forward, there is a next page if the extra row was found, and a
+		// previous page unless we started at the beginning. Moving backward, it
+		// is the other way around.
+		hasNext, hasPrev := more, !filters.Cursor.IsStart()
+		if filters.Cursor.Backward {
+			hasNext, hasPrev = true, more
+		}
+
+		if hasNext {
+			metadata.NextCursor = Cursor{Sort: filters.Sort, Value: lastValue, ID: last.ID}.Encode()
+		}
+		if hasPrev {
+			metadata.PrevCursor = Cursor{Sort: filters.Sort, Value: firstValue, ID: first.ID, Backward: true}.Encode()
+		}
+	}
+
+	if filters.IncludeTotal {
+		countArgs := queryArgs{}
+		query := fmt.Sprintf(`SELECT count(*) FROM movies WHERE %s`, filter.where(&countArgs))
+
+		err = m.DB.QueryRowContext(ctx, query, countArgs...).Scan(&metadata.TotalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	return movies, metadata, nil
+}
+
+// exportBatchSize is the number of rows fetched from the export cursor at a
+// time.
+const exportBatchSize = 500
+
+// Export calls fn for every movie that matches the filter, in ID order. The
+// movies are read through a server-side cursor in batches of exportBatchSize,
+// so memory use doesn't grow with the size of the catalogue.
+//
+// The cursor lives in a read-only transaction, which is abandoned if the
+// export takes longer than the timeout. If fn returns an error, the export
+// stops and the error is returned.
+func (m MovieModel) Export(filter MovieFilter, timeout time.Duration, fn func(*Movie) error) error {
+	ctx, cancel := CreateTimeoutContext(timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	// The transaction only holds the cursor, so it is always rolled back.
+	defer tx.Rollback()
+
+	args := queryArgs{}
+	query := fmt.Sprintf(`
+		DECLARE movies_export NO SCROLL CURSOR FOR
+		SELECT id, created_at, title, year, runtime, genres, version
+		FROM movies
+		WHERE %s
+		ORDER BY id ASC`, filter.where(&args))
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM movies_export", exportBatchSize)
+
+	for {
+		rows, err := tx.QueryContext(ctx, fetch)
+		if err != nil {
+			return err
+		}
+
+		fetched := 0
+		for rows.Next() {
+			var movie Movie
+			err = rows.Scan(
+				&movie.ID,
+				&movie.CreatedAt,
+				&movie.Title,
+				&movie.Year,
+				&movie.Runtime,
+				pq.Array(&movie.Genres),
+				&movie.Version,
+			)
+			if err == nil {
+				err = fn(&movie)
+			}
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			fetched++
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		// A short batch means the cursor is exhausted.
+		if fetched < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// MovieSuggestion is the small representation of a movie that is returned by
+// the title autocomplete endpoint.
+type MovieSuggestion struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+// SuggestTimeout is the timeout for autocomplete queries. Suggestions are
+// only useful if they arrive while the user is typing, so it is much shorter
+// than QueryTimeout.
+const SuggestTimeout = 250 * time.Millisecond
+
+// Suggest returns up to limit movies whose titles begin with the prefix,
+// ignoring case, in alphabetical order of their titles. Movies in the trash
+// are excluded. The query is served by the movies_title_prefix_idx index.
+func (m MovieModel) Suggest(prefix string, limit int) ([]MovieSuggestion, error) {
+	query := `
+		SELECT id, title
+		FROM movies
+		WHERE deleted_at IS NULL AND lower(title) LIKE lower($1)
+		ORDER BY lower(title) ASC, id ASC
+		LIMIT $2`
+
+	ctx, cancel := CreateTimeoutContext(SuggestTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, likeEscaper.Replace(prefix)+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []MovieSuggestion{}
+	for rows.Next() {
+		var s MovieSuggestion
+		err = rows.Scan(&s.ID, &s.Title)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+
+	return suggestions, rows.Err()
+}
+
+// Titles returns the ID and title of every movie that isn't in the trash. It
+// is used to load the in-memory autocomplete index.
+func (m MovieModel) Titles() ([]MovieSuggestion, error) {
+	query := `
+		SELECT id, title
+		FROM movies
+		WHERE deleted_at IS NULL
+		ORDER BY id ASC`
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := []MovieSuggestion{}
+	for rows.Next() {
+		var s MovieSuggestion
+		err = rows.Scan(&s.ID, &s.Title)
+		if err != nil {
+			return nil, err
+		}
+		titles = append(titles, s)
+	}
+
+	return titles, rows.Err()
+}
+
 // Insert adds a new record to the movie table. It accepts a pointer to a
 // Movie struct and runs an INSERT query. The id, created_at, and version fields
 // are generated automatically.
@@ -123,31 +779,25 @@ func (m MovieModel) Insert(movie *Movie) error {
 
 // Get retrieves a a specific record in the movies table by its ID. If the ID
 // argument is less then 1, or if there is no movie with a matching ID in the
-// database, and ErrRecordNotFound is returned. If a movie is found, a pointer
+// database, and ErrRecordNotFound is returned. Movies in the trash are treated
+// as not found. If a movie is found, a pointer
 // to the corresponding Movie struct is returned.
 func (m MovieModel) Get(id int64) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `
-		SELECT id, created_at, title, year, runtime, genres, version
-		FROM movies WHERE ID = $1`
+	columns, scan := movieProjection(nil, false)
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM movies WHERE ID = $1 AND deleted_at IS NULL`, columns)
 
 	var movie Movie
 
 	ctx, cancel := CreateTimeoutContext(QueryTimeout)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&movie.ID,
-		&movie.CreatedAt,
-		&movie.Title,
-		&movie.Year,
-		&movie.Runtime,
-		pq.Array(&movie.Genres),
-		&movie.Version,
-	)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(scan(&movie)...)
 
 	if err != nil {
 		switch {
@@ -172,7 +822,7 @@ func (m MovieModel) Update(movie *Movie) error {
 	query := `
 		UPDATE movies
 		SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-		WHERE id = $5 AND version = $6
+		WHERE id = $5 AND version = $6 AND deleted_at IS NULL
 		RETURNING version`
 
 	args := []any{
@@ -202,36 +852,341 @@ func (m MovieModel) Update(movie *Movie) error {
 	return nil
 }
 
-// Delete deletes a specific record from the movies table. Returns an
-// ErrNoRecordFound error if no record is found.
-func (m MovieModel) Delete(id int64) error {
-	if id < 1 {
+// Delete moves a specific record in the movies table to the trash by setting
+// its deleted_at field. The movie is only moved if its version still matches
+// movie.Version, so that an update made since the movie was fetched isn't
+// silently thrown away. The record's version is incremented, so that pending
+// updates to the movie result in an edit conflict. The movie's ratings are
+// removed from the rating stats, so that movies in the trash don't affect the
+// mean rating, and are added back by Restore. Returns an ErrEditConflict error
+// if no matching record is found.
+func (m MovieModel) Delete(movie *Movie) error {
+	if movie.ID < 1 {
 		return ErrRecordNotFound
 	}
 
-	query := `DELETE FROM movies WHERE id = $1`
+	query := `
+		WITH trashed AS (
+			UPDATE movies
+			SET deleted_at = NOW(), version = version + 1
+			WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+			RETURNING rating_count, rating_sum
+		), stats AS (
+			UPDATE rating_stats SET
+				rating_count = rating_stats.rating_count - (SELECT COALESCE(sum(rating_count), 0) FROM trashed),
+				rating_sum = rating_stats.rating_sum - (SELECT COALESCE(sum(rating_sum), 0) FROM trashed)
+		)
+		SELECT count(*) FROM trashed`
 
 	ctx, cancel := CreateTimeoutContext(QueryTimeout)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	var trashed int
+	err := m.DB.QueryRowContext(ctx, query, movie.ID, movie.Version).Scan(&trashed)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
+	// If no rows are affected, then the movie has been updated or deleted since
+	// it was fetched, which is an edit conflict.
+	if trashed == 0 {
+		return ErrEditConflict
 	}
 
-	// If no rows are effected, then there was no record found.
-	if rowsAffected == 0 {
+	return nil
+}
+
+// lockMovie locks the row of a movie that isn't in the trash, until the end
+// of the transaction. Changes to a movie's ratings, credits, and releases are
+// serialized by this lock, so that they can't race to insert the same rows, or
+// to update the movie's aggregates, and the movie can't be purged while they
+// are made. If there is no matching movie, an ErrRecordNotFound error is
+// returned.
+func lockMovie(ctx context.Context, tx *sql.Tx, movieID int64) error {
+	if movieID < 1 {
 		return ErrRecordNotFound
 	}
 
+	var exists bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT true FROM movies WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`,
+		movieID).Scan(&exists)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
 	return nil
 }
 
+// movieConflict returns the error for a conditional update of a movie that
+// matched no rows. If the movie still exists, and isn't in the trash, it must
+// have been updated since it was fetched, so an ErrEditConflict error is
+// returned. Otherwise, an ErrRecordNotFound error is returned.
+func movieConflict(ctx context.Context, tx *sql.Tx, movieID int64) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM movies WHERE id = $1 AND deleted_at IS NULL)`,
+		movieID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrEditConflict
+	}
+	return ErrRecordNotFound
+}
+
+// GetAllDeleted retrieves a paginated slice of the movies that are currently
+// in the trash. Sorting and pagination work the same way as in GetAll.
+func (m MovieModel) GetAllDeleted(filters Filters) ([]*Movie, Metadata, error) {
+	columns, scan := movieProjection(filters.Fields, true)
+
+	query := fmt.Sprintf(`
+		SELECT
+			count(*) OVER(),
+			%s
+		FROM movies
+		WHERE deleted_at IS NOT NULL
+		ORDER BY %s %s, id ASC
+		LIMIT $1 OFFSET $2`, columns, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var m Movie
+		err = rows.Scan(append([]any{&totalRecords}, scan(&m)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movies = append(movies, &m)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return movies, metadata, nil
+}
+
+// Restore moves a movie out of the trash and returns the restored record. Its
+// version is incremented, and its ratings are added back to the rating stats.
+// An ErrRecordNotFound error is returned if there is no movie with a matching
+// ID in the trash.
+func (m MovieModel) Restore(id int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	columns, scan := movieProjection(nil, false)
+	// The restored row is aliased as movies, so that the projection's columns
+	// refer to it.
+	query := fmt.Sprintf(`
+		WITH restored AS (
+			UPDATE movies
+			SET deleted_at = NULL, version = version + 1
+			WHERE id = $1 AND deleted_at IS NOT NULL
+			RETURNING *
+		), stats AS (
+			UPDATE rating_stats SET
+				rating_count = rating_stats.rating_count + (SELECT COALESCE(sum(rating_count), 0) FROM restored),
+				rating_sum = rating_stats.rating_sum + (SELECT COALESCE(sum(rating_sum), 0) FROM restored)
+		)
+		SELECT %s FROM restored AS movies`, columns)
+
+	var movie Movie
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(scan(&movie)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &movie, nil
+}
+
+// Purge permanently deletes every movie that was moved to the trash before
+// the given time, and returns the number of movies deleted. The ratings of
+// the deleted movies were already removed from the rating stats by Delete.
+func (m MovieModel) Purge(before time.Time) (int64, error) {
+	query := `
+		DELETE FROM movies
+		WHERE deleted_at IS NOT NULL AND deleted_at < $1`
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// A MovieImporter bulk inserts movies inside a single transaction, using the
+// postgresql COPY protocol. Movies inserted by an importer aren't visible to
+// other queries until Commit is called, and are discarded by Rollback.
+type MovieImporter struct {
+	tx     *sql.Tx
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewImporter begins a transaction for bulk inserting movies. The transaction
+// is rolled back if it isn't committed within the timeout. Either Commit or
+// Rollback must be called to release its resources.
+func (m MovieModel) NewImporter(timeout time.Duration) (*MovieImporter, error) {
+	ctx, cancel := CreateTimeoutContext(timeout)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &MovieImporter{tx: tx, ctx: ctx, cancel: cancel}, nil
+}
+
+// Insert copies a batch of movies into the movies table with pq.CopyIn. The
+// id, created_at, and version fields are generated automatically, but unlike
+// MovieModel.Insert, they aren't assigned to the movies.
+//
+// If an error occurs, the transaction is aborted, and no further batches can
+// be inserted.
+func (mi *MovieImporter) Insert(movies []*Movie) error {
+	stmt, err := mi.tx.PrepareContext(mi.ctx,
+		pq.CopyIn("movies", "title", "year", "runtime", "genres"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, movie := range movies {
+		_, err = stmt.ExecContext(mi.ctx,
+			movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Calling Exec with no arguments flushes the buffered rows.
+	_, err = stmt.ExecContext(mi.ctx)
+	return err
+}
+
+// Commit commits the importer's transaction.
+func (mi *MovieImporter) Commit() error {
+	defer mi.cancel()
+	return mi.tx.Commit()
+}
+
+// Rollback rolls back the importer's transaction. It is safe to call after
+// Commit, in which case it does nothing.
+func (mi *MovieImporter) Rollback() error {
+	defer mi.cancel()
+
+	err := mi.tx.Rollback()
+	if errors.Is(err, sql.ErrTxDone) {
+		return nil
+	}
+	return err
+}
+
+// ValidateMovieFilter validates the criteria of a MovieFilter.
+//
+//   - SearchMode must be "fulltext", "fuzzy", or "prefix".
+//   - GenresMode must be "all", "any", or "none".
+//   - Year bounds must be between 1888 and the present, if provided.
+//   - Runtime bounds must be positive, and must fit in the runtime column, if
+//     provided.
+//   - Minimum bounds must not be greater than maximum bounds.
+//   - Person must be positive, if provided. PersonRole must be a credit role,
+//     and can only be provided with a person.
+//   - ReleasedIn must be an ISO 3166-1 code, if provided. CertificationMax
+//     must be a certification in ReleasedIn, or in any country of
+//     Certifications if ReleasedIn isn't provided. ReleasedAfter must not be
+//     later than ReleasedBefore.
+func ValidateMovieFilter(v *validator.Validator, f MovieFilter) {
+	v.CheckCode(validator.PermittedValue(f.SearchMode, SearchModes...), "search_mode",
+		validator.CodeNotPermitted, "must be fulltext, fuzzy, or prefix", "permitted", SearchModes)
+	v.CheckCode(validator.PermittedValue(f.GenresMode, GenresModes...), "genres_mode",
+		validator.CodeNotPermitted, "must be all, any, or none", "permitted", GenresModes)
+
+	thisYear := time.Now().Year()
+	for key, year := range map[string]int{"year_min": f.YearMin, "year_max": f.YearMax} {
+		if year != 0 {
+			v.CheckCode(year >= 1888, key, validator.CodeOutOfRange, "must be after 1888", "min", 1888)
+			v.CheckCode(year <= thisYear, key, validator.CodeOutOfRange, "must not be in the future", "max", thisYear)
+		}
+	}
+
+	for key, runtime := range map[string]int{"runtime_min": f.RuntimeMin, "runtime_max": f.RuntimeMax} {
+		if runtime != 0 {
+			v.CheckCode(runtime > 0, key, validator.CodeOutOfRange, "must be a positive integer", "min", 1)
+			v.CheckCode(runtime <= math.MaxInt32, key, validator.CodeOutOfRange, "must be no more than 2147483647", "max", math.MaxInt32)
+		}
+	}
+
+	if f.YearMin != 0 && f.YearMax != 0 {
+		v.CheckCode(f.YearMin <= f.YearMax, "year_min", validator.CodeOutOfRange, "must not be greater than year_max", "max", f.YearMax)
+	}
+	if f.RuntimeMin != 0 && f.RuntimeMax != 0 {
+		v.CheckCode(f.RuntimeMin <= f.RuntimeMax, "runtime_min", validator.CodeOutOfRange, "must not be greater than runtime_max", "max", f.RuntimeMax)
+	}
+
+	v.CheckCode(f.Person >= 0, "person", validator.CodeOutOfRange, "must be a positive integer", "min", 1)
+	if f.PersonRole != "" {
+		v.CheckCode(validator.PermittedValue(f.PersonRole, CreditRoles...), "person_role",
+			validator.CodeNotPermitted, "must be director, actor, or writer", "permitted", CreditRoles)
+		v.CheckCode(f.Person != 0, "person_role", validator.CodeNotPermitted, "can only be used with a person")
+	}
+
+	if f.ReleasedIn != "" {
+		v.CheckCode(validator.Matches(f.ReleasedIn, RegionRX), "released_in", validator.CodeInvalidFormat,
+			"must be a two letter ISO 3166-1 country code")
+	}
+	if f.CertificationMax != "" {
+		if certifications, ok := Certifications[f.ReleasedIn]; ok {
+			v.CheckCode(validator.PermittedValue(f.CertificationMax, certifications...), "certification_max",
+				validator.CodeNotPermitted, "must be one of "+strings.Join(certifications, ", "), "permitted", certifications)
+		} else if f.ReleasedIn != "" {
+			v.AddErrorCode("certification_max", validator.CodeNotPermitted, "is not supported for this country")
+		} else {
+			v.CheckCode(len(certificationsUpTo("", f.CertificationMax)) > 0, "certification_max", validator.CodeNotPermitted,
+				"must be a known certification")
+		}
+	}
+	if !f.ReleasedAfter.IsZero() && !f.ReleasedBefore.IsZero() {
+		v.CheckCode(!f.ReleasedAfter.After(f.ReleasedBefore.Time), "released_after", validator.CodeOutOfRange,
+			"must not be later than released_before", "max", f.ReleasedBefore.String())
+	}
+}
+
 // ValidateMovie validates the fields of a Movie struct. The fields must meet
 // the following requirements:
 //
@@ -239,21 +1194,34 @@ func (m MovieModel) Delete(id int64) error {
 //   - Title must be less than 500 bytes.
 //   - Year must be between 1888 and the present.
 //   - Runtime must be a positive integer.
-//   - There must be between 1 and 5 unique genres.
-func ValidateMovie(v *validator.Validator, m *Movie) {
+//   - There must be between 1 and 5 unique genres, each of which must be in
+//     the taxonomy. Genres are replaced by their slugs, so aliases such as
+//     "Sci-Fi" are accepted. Unknown and duplicate genres are reported at
+//     their own path, such as "genres[2]".
+func ValidateMovie(v *validator.Validator, m *Movie, taxonomy GenreTaxonomy) {
 
-	v.Check(m.Title != "", "title", "must be provided")
-	v.Check(len(m.Title) < 500, "title", "must be less than 500 bytes")
+	v.CheckCode(m.Title != "", "title", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(m.Title) < 500, "title", validator.CodeTooLong, "must be less than 500 bytes", "max", 499)
 
-	v.Check(m.Year != 0, "year", "must be provided")
-	v.Check(m.Year >= 1888, "year", "must be after 1888")
-	v.Check(m.Year <= int32(time.Now().Year()), "year", "must not be in the future")
+	v.CheckCode(m.Year != 0, "year", validator.CodeRequired, "must be provided")
+	v.CheckCode(m.Year >= 1888, "year", validator.CodeOutOfRange, "must be after 1888", "min", 1888)
+	v.CheckCode(m.Year <= int32(time.Now().Year()), "year", validator.CodeOutOfRange, "must not be in the future", "max", time.Now().Year())
 
-	v.Check(m.Runtime != 0, "runtime", "must be provided")
-	v.Check(m.Runtime > 0, "runtime", "must be a positive integer")
+	v.CheckCode(m.Runtime != 0, "runtime", validator.CodeRequired, "must be provided")
+	v.CheckCode(m.Runtime > 0, "runtime", validator.CodeOutOfRange, "must be a positive integer", "min", 1)
 
-	v.Check(m.Genres != nil, "genres", "must be provided")
-	v.Check(len(m.Genres) >= 1, "genres", "must be at least 1 genre")
-	v.Check(len(m.Genres) <= 5, "genres", "must be no more than 5 genres")
-	v.Check(validator.Unique(m.Genres), "genres", "must not contain duplicate values")
+	v.CheckCode(m.Genres != nil, "genres", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(m.Genres) >= 1, "genres", validator.CodeTooShort, "must be at least 1 genre", "min", 1)
+	v.CheckCode(len(m.Genres) <= 5, "genres", validator.CodeTooLong, "must be no more than 5 genres", "max", 5)
+	for i, genre := range m.Genres {
+		slug, ok := taxonomy.Resolve(genre)
+		if !ok {
+			v.AddErrorCode(validator.Path("genres", i), validator.CodeNotFound, "must be a known genre", "value", genre)
+			continue
+		}
+		m.Genres[i] = slug
+	}
+	for _, i := range validator.Duplicates(m.Genres) {
+		v.AddErrorCode(validator.Path("genres", i), validator.CodeDuplicate, "must not contain duplicate values", "value", m.Genres[i])
+	}
 }
@@ -0,0 +1,76 @@
+package data
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+func TestValidateMovieFilterRuntime(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  MovieFilter
+		wantKey string
+	}{
+		{"Valid", MovieFilter{RuntimeMin: 90, RuntimeMax: 120}, ""},
+		{"Not positive", MovieFilter{RuntimeMin: -1}, "runtime_min"},
+		{"Too large", MovieFilter{RuntimeMax: math.MaxInt32 + 1}, "runtime_max"},
+		{"Reversed", MovieFilter{RuntimeMin: 120, RuntimeMax: 90}, "runtime_min"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.SearchMode, tt.filter.GenresMode = "fulltext", "all"
+
+			v := validator.New()
+			ValidateMovieFilter(v, tt.filter)
+
+			if tt.wantKey == "" {
+				assert.Equal(t, v.Valid(), true)
+				return
+			}
+			assert.Equal(t, len(v.Details[tt.wantKey]), 1)
+		})
+	}
+}
+
+func TestMarkHighlight(t *testing.T) {
+	tests := []struct {
+		name      string
+		highlight string
+		want      string
+	}{
+		{"Empty", "", ""},
+		{"Marked", "The \x02Matrix\x03", "The <mark>Matrix</mark>"},
+		{"Markup in title", "<img src=x onerror=alert(1)> \x02Heat\x03", "&lt;img src=x onerror=alert(1)&gt; <mark>Heat</mark>"},
+		{"Ampersand", "\x02Tom\x03 & Jerry", "<mark>Tom</mark> &amp; Jerry"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, markHighlight(tt.highlight), tt.want)
+		})
+	}
+}
+
+func TestHeadlinePrefix(t *testing.T) {
+	// A movie such as "Le Fabuleux Destin d'Amélie Poulain" matches a prefix
+	// search for "Amélie" only by its alternate title, so its own title must
+	// not be marked. The markup is guarded by the same pattern that matches
+	// the movie's own title in where.
+	filter := MovieFilter{Title: "Amélie_", SearchMode: "prefix", Highlight: true}
+
+	args := queryArgs{}
+	expr := filter.headline(&args)
+
+	assert.Equal(t, strings.HasPrefix(expr, "CASE WHEN title ILIKE $1 THEN "), true)
+	assert.Equal(t, strings.HasSuffix(expr, " ELSE '' END"), true)
+	assert.Equal(t, args[0], any(`Amélie\_%`))
+
+	whereArgs := queryArgs{}
+	filter.where(&whereArgs)
+	assert.Equal(t, whereArgs[0], args[0])
+}
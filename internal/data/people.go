@@ -0,0 +1,200 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+)
+
+// Person is a struct representing one of the directors, cast, or crew of a
+// movie. BirthYear is zero if it isn't known.
+type Person struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name"`
+	BirthYear int32     `json:"birth_year,omitempty"`
+	Version   int32     `json:"version"`
+}
+
+// PersonModel struct wraps an sql.DB connection pool and implements basic
+// CRUD operations on the people table.
+type PersonModel struct {
+	DB *sql.DB
+}
+
+// ValidatePerson validates the fields of a Person struct.
+//
+//   - Name is required, and must be less than 500 bytes.
+//   - BirthYear, if provided, must be between 1800 and the present.
+func ValidatePerson(v *validator.Validator, p *Person) {
+	v.CheckCode(p.Name != "", "name", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(p.Name) < 500, "name", validator.CodeTooLong, "must be less than 500 bytes", "max", 499)
+
+	if p.BirthYear != 0 {
+		v.CheckCode(p.BirthYear >= 1800, "birth_year", validator.CodeOutOfRange, "must be after 1800", "min", 1800)
+		v.CheckCode(p.BirthYear <= int32(time.Now().Year()), "birth_year", validator.CodeOutOfRange, "must not be in the future", "max", time.Now().Year())
+	}
+}
+
+// Insert adds a new record to the people table. The id, created_at, and
+// version fields are generated automatically.
+func (m PersonModel) Insert(person *Person) error {
+	query := `
+		INSERT INTO people (name, birth_year)
+		VALUES ($1, NULLIF($2, 0))
+		RETURNING id, created_at, version`
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, person.Name, person.BirthYear).Scan(
+		&person.ID, &person.CreatedAt, &person.Version)
+}
+
+// Get retrieves a specific record in the people table by its ID. If there is
+// no matching record, an ErrRecordNotFound error is returned.
+func (m PersonModel) Get(id int64) (*Person, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, COALESCE(birth_year, 0), version
+		FROM people
+		WHERE id = $1`
+
+	var person Person
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&person.ID,
+		&person.CreatedAt,
+		&person.Name,
+		&person.BirthYear,
+		&person.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &person, nil
+}
+
+// GetAll retrieves a page of people, sorted and paginated by the Filters. If
+// name is provided, only people whose names begin with it are returned,
+// ignoring case.
+func (m PersonModel) GetAll(name string, filters Filters) ([]*Person, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, COALESCE(birth_year, 0), version
+		FROM people
+		WHERE ($1 = '' OR lower(name) LIKE lower($1) || '%%')
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, likeEscaper.Replace(name), filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	people := []*Person{}
+
+	for rows.Next() {
+		var person Person
+		err = rows.Scan(
+			&totalRecords,
+			&person.ID,
+			&person.CreatedAt,
+			&person.Name,
+			&person.BirthYear,
+			&person.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		people = append(people, &person)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return people, metadata, nil
+}
+
+// Update updates a specific record in the people table, and increments its
+// version. If the version of the record has changed since it was fetched, an
+// ErrEditConflict error is returned.
+func (m PersonModel) Update(person *Person) error {
+	query := `
+		UPDATE people
+		SET name = $1, birth_year = NULLIF($2, 0), version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	args := []any{person.Name, person.BirthYear, person.ID, person.Version}
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete permanently deletes a specific record in the people table, along with
+// their credits. The person is only deleted if their version still matches
+// person.Version, so that an update made since they were fetched isn't
+// silently thrown away. An ErrEditConflict error is returned if there is no
+// matching record.
+func (m PersonModel) Delete(person *Person) error {
+	if person.ID < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM people WHERE id = $1 AND version = $2`
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, person.ID, person.Version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// The person was fetched before being deleted, so if no rows are affected,
+	// they have been updated or deleted since, which is an edit conflict.
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
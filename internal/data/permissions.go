@@ -6,13 +6,29 @@ import (
 	"github.com/lib/pq"
 )
 
-// String type for permission codes. Current options are "movies:read" and
-// "movies:write"
+// String type for permission codes. Current options are "movies:read",
+// "movies:write", "movies:purge", "people:read", "people:write",
+// "genres:write", and "reviews:moderate".
 type PermissionCode string
 
 var MoviesRead = PermissionCode("movies:read")
 var MoviesWrite = PermissionCode("movies:write")
 
+// MoviesPurge allows permanently deleting movies from the trash.
+var MoviesPurge = PermissionCode("movies:purge")
+
+// PeopleRead and PeopleWrite allow reading and writing the people that movies
+// are credited to.
+var PeopleRead = PermissionCode("people:read")
+var PeopleWrite = PermissionCode("people:write")
+
+// GenresWrite allows managing the genre taxonomy, including merging genres.
+var GenresWrite = PermissionCode("genres:write")
+
+// ReviewsModerate allows hiding and restoring reviews, and resolving their
+// reports.
+var ReviewsModerate = PermissionCode("reviews:moderate")
+
 // Permissions is a string slice for storing permission codes.
 type Permissions []PermissionCode
 
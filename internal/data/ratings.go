@@ -0,0 +1,157 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+)
+
+// Rating is a user's rating of a movie, from 1 to 10.
+type Rating struct {
+	MovieID   int64     `json:"movie_id"`
+	Rating    int       `json:"rating"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RatingModel struct wraps an sql.DB connection pool and implements
+// operations on the ratings table. The rating aggregates of movies, and of
+// every rating, are updated in the same transaction as the ratings.
+type RatingModel struct {
+	DB *sql.DB
+}
+
+// ValidateRating checks that a rating is provided, and is between 1 and 10.
+func ValidateRating(v *validator.Validator, rating int) {
+	v.CheckCode(rating != 0, "rating", validator.CodeRequired, "must be provided")
+	v.CheckCode(rating >= 1, "rating", validator.CodeOutOfRange, "must be at least 1", "min", 1)
+	v.CheckCode(rating <= 10, "rating", validator.CodeOutOfRange, "must be no more than 10", "max", 10)
+}
+
+// Set sets a user's rating of a movie, replacing their previous rating if
+// they have one. created is true if the user hadn't rated the movie before.
+// If there is no matching movie, or it is in the trash, an ErrRecordNotFound
+// error is returned.
+func (m RatingModel) Set(userID int64, rating *Rating) (created bool, err error) {
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	// Rolling back a committed transaction does nothing.
+	defer tx.Rollback()
+
+	err = lockMovie(ctx, tx, rating.MovieID)
+	if err != nil {
+		return false, err
+	}
+
+	var previous int
+	err = tx.QueryRowContext(ctx, `
+		SELECT rating FROM ratings WHERE user_id = $1 AND movie_id = $2`,
+		userID, rating.MovieID).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	created = errors.Is(err, sql.ErrNoRows)
+
+	var countDelta, sumDelta int
+	if created {
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO ratings (user_id, movie_id, rating)
+			VALUES ($1, $2, $3)
+			RETURNING updated_at`,
+			userID, rating.MovieID, rating.Rating).Scan(&rating.UpdatedAt)
+		countDelta, sumDelta = 1, rating.Rating
+	} else {
+		err = tx.QueryRowContext(ctx, `
+			UPDATE ratings SET rating = $3, updated_at = NOW()
+			WHERE user_id = $1 AND movie_id = $2
+			RETURNING updated_at`,
+			userID, rating.MovieID, rating.Rating).Scan(&rating.UpdatedAt)
+		countDelta, sumDelta = 0, rating.Rating-previous
+	}
+	if err != nil {
+		return false, err
+	}
+
+	err = updateRatingAggregates(ctx, tx, rating.MovieID, countDelta, sumDelta)
+	if err != nil {
+		return false, err
+	}
+
+	return created, tx.Commit()
+}
+
+// Delete removes a user's rating of a movie. If the user hasn't rated the
+// movie, or there is no matching movie, or it is in the trash, an
+// ErrRecordNotFound error is returned.
+func (m RatingModel) Delete(userID, movieID int64) error {
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction does nothing.
+	defer tx.Rollback()
+
+	err = lockMovie(ctx, tx, movieID)
+	if err != nil {
+		return err
+	}
+
+	var previous int
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM ratings WHERE user_id = $1 AND movie_id = $2
+		RETURNING rating`,
+		userID, movieID).Scan(&previous)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	err = updateRatingAggregates(ctx, tx, movieID, -1, -previous)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateRatingAggregates adds the changes in the number and sum of ratings to
+// the aggregates of a movie, and to those of every movie that isn't in the
+// trash. Only movies that aren't in the trash can be rated. The movie's
+// version isn't incremented, since ratings don't change the movie itself.
+//
+// Every rating updates the single row of rating_stats, so ratings of
+// different movies are serialized on its lock until their transactions
+// commit. The transactions are short, and always lock the movie before
+// rating_stats, so they can't deadlock, but the row caps the rate of rating
+// writes. If that becomes a bottleneck, the row can be split into several
+// that are summed when read.
+func updateRatingAggregates(ctx context.Context, tx *sql.Tx, movieID int64, countDelta, sumDelta int) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE movies
+		SET rating_count = rating_count + $2, rating_sum = rating_sum + $3
+		WHERE id = $1`,
+		movieID, countDelta, sumDelta)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE rating_stats
+		SET rating_count = rating_count + $1, rating_sum = rating_sum + $2`,
+		countDelta, sumDelta)
+	return err
+}
@@ -0,0 +1,49 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+func TestValidateRating(t *testing.T) {
+	tests := []struct {
+		name     string
+		rating   int
+		wantCode string
+	}{
+		{"Valid", 7, ""},
+		{"Missing", 0, validator.CodeRequired},
+		{"Too low", -1, validator.CodeOutOfRange},
+		{"Too high", 11, validator.CodeOutOfRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateRating(v, tt.rating)
+
+			if tt.wantCode == "" {
+				assert.Equal(t, v.Valid(), true)
+				return
+			}
+			assert.Equal(t, len(v.Details["rating"]), 1)
+			assert.Equal(t, v.Details["rating"][0].Code, tt.wantCode)
+		})
+	}
+}
+
+func TestMovieProjectionRating(t *testing.T) {
+	columns, scan := movieProjection([]string{"rating"}, false)
+
+	assert.StringContains(t, columns, "movies.rating_count")
+	assert.StringContains(t, columns, "FROM rating_stats")
+	assert.Equal(t, strings.HasPrefix(columns, "id, "), true)
+
+	var m Movie
+	dst := scan(&m)
+	assert.Equal(t, len(dst), 4)
+	assert.Equal(t, m.Rating != nil, true)
+}
@@ -0,0 +1,196 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// likedRating is the lowest rating that counts as liking a movie, for the
+// co-rating signals of recommendations.
+const likedRating = 7
+
+// The weights of the signals that similar movies are ranked by. Each signal is
+// between 0 and 1, so scores are too.
+//
+//   - Genres: the Jaccard index of the movies' genres.
+//   - Year: 1 for movies released in the same year, falling to 0.5 for
+//     movies released ten years apart.
+//   - Co-rating: the number of users who liked both movies, relative to the
+//     most for any movie.
+const (
+	similarGenreWeight    = 0.6
+	similarYearWeight     = 0.2
+	similarCoRatingWeight = 0.2
+)
+
+// The weights of the signals that recommendations for a user are ranked by.
+// Each signal is between 0 and 1, so scores are too. The user's taste is
+// given by the movies they liked and the movies in their lists, which are
+// weighted by how much the user liked them.
+//
+//   - Genres: how much the user likes the movie's genres, relative to the
+//     best candidate.
+//   - Co-rating: how many users who liked the same movies as the user also
+//     liked this one, relative to the best candidate.
+//   - Quality: the movie's Bayesian rating score, out of 10. Users who haven't
+//     rated or listed any movies are recommended the best rated movies.
+const (
+	recommendGenreWeight    = 0.5
+	recommendCoRatingWeight = 0.3
+	recommendQualityWeight  = 0.2
+)
+
+// Recommendation is a movie that is recommended, with its score, which is
+// between 0 and 1. Higher scores are better recommendations.
+type Recommendation struct {
+	Movie *Movie
+	Score float64
+}
+
+// RecommendationModel struct wraps an sql.DB connection pool and computes
+// recommendations from the movies, ratings, lists, and diary_entries tables.
+// Everything is computed by the database, when requested.
+type RecommendationModel struct {
+	DB *sql.DB
+}
+
+// genreJaccard is the SQL expression for the Jaccard index of the genres of
+// a movie and the target movie, which is the number of genres they share,
+// divided by the number of genres in either of them.
+const genreJaccard = `COALESCE(
+	(SELECT count(*) FROM (SELECT unnest(movies.genres) INTERSECT SELECT unnest(target.genres)) i)::float8 /
+	NULLIF((SELECT count(*) FROM (SELECT unnest(movies.genres) UNION SELECT unnest(target.genres)) u), 0),
+	0)`
+
+// Similar returns up to limit movies that are similar to the movie with the
+// given ID, best first. Only movies that share a genre with it, or that were
+// liked by users who liked it, are returned. Movies in the trash are left
+// out.
+func (m RecommendationModel) Similar(movieID int64, limit int) ([]*Recommendation, error) {
+	query := fmt.Sprintf(`
+		WITH target AS (
+			SELECT id, year, genres FROM movies WHERE id = $1 AND deleted_at IS NULL
+		),
+		co_rated AS (
+			SELECT theirs.movie_id, count(*)::float8 AS raters
+			FROM ratings liked
+			JOIN ratings theirs ON theirs.user_id = liked.user_id AND theirs.movie_id <> liked.movie_id
+			WHERE liked.movie_id = $1 AND liked.rating >= $2 AND theirs.rating >= $2
+			GROUP BY theirs.movie_id
+		),
+		candidates AS (
+			SELECT movies.id AS movie_id,
+				%s AS genre_score,
+				1 / (1 + abs(movies.year - target.year) / 10.0)::float8 AS year_score,
+				COALESCE(co_rated.raters / (SELECT max(raters) FROM co_rated), 0) AS co_rating_score
+			FROM movies
+			CROSS JOIN target
+			LEFT JOIN co_rated ON co_rated.movie_id = movies.id
+			WHERE movies.id <> target.id AND movies.deleted_at IS NULL
+		),
+		scores AS (
+			SELECT movie_id, (%v * genre_score + %v * year_score + %v * co_rating_score)::float8 AS score
+			FROM candidates
+			WHERE genre_score > 0 OR co_rating_score > 0
+		)`,
+		genreJaccard, similarGenreWeight, similarYearWeight, similarCoRatingWeight)
+
+	return m.ranked(query, limit, movieID, likedRating)
+}
+
+// ForUser returns up to limit movies recommended for the user with the given
+// ID, best first. Movies that the user has rated, listed, or logged in their
+// diary are left out, as are movies in the trash.
+func (m RecommendationModel) ForUser(userID int64, limit int) ([]*Recommendation, error) {
+	query := fmt.Sprintf(`
+		WITH listed AS (
+			SELECT list_entries.movie_id
+			FROM list_entries JOIN lists ON lists.id = list_entries.list_id
+			WHERE lists.user_id = $1
+		),
+		seeds AS (
+			SELECT movie_id, max(weight) AS weight
+			FROM (
+				SELECT movie_id, (rating - $2 + 2)::float8 AS weight
+				FROM ratings WHERE user_id = $1 AND rating >= $2
+				UNION ALL
+				SELECT movie_id, 1 FROM listed
+			) s
+			GROUP BY movie_id
+		),
+		seen AS (
+			SELECT movie_id FROM ratings WHERE user_id = $1
+			UNION SELECT movie_id FROM listed
+			UNION SELECT movie_id FROM diary_entries WHERE user_id = $1
+		),
+		genre_prefs AS (
+			SELECT u.genre, sum(seeds.weight) AS weight
+			FROM seeds
+			JOIN movies ON movies.id = seeds.movie_id AND movies.deleted_at IS NULL
+			CROSS JOIN LATERAL unnest(movies.genres) AS u(genre)
+			GROUP BY u.genre
+		),
+		co_rated AS (
+			SELECT theirs.movie_id, sum(seeds.weight) AS weight
+			FROM seeds
+			JOIN ratings liked ON liked.movie_id = seeds.movie_id AND liked.user_id <> $1 AND liked.rating >= $2
+			JOIN ratings theirs ON theirs.user_id = liked.user_id AND theirs.rating >= $2
+			GROUP BY theirs.movie_id
+		),
+		candidates AS (
+			SELECT movies.id AS movie_id,
+				COALESCE((SELECT sum(genre_prefs.weight) FROM genre_prefs WHERE genre_prefs.genre = ANY(movies.genres)), 0) AS genre_weight,
+				COALESCE(co_rated.weight, 0) AS co_rating_weight,
+				%s / 10 AS quality
+			FROM movies
+			LEFT JOIN co_rated ON co_rated.movie_id = movies.id
+			WHERE movies.deleted_at IS NULL AND movies.id NOT IN (SELECT movie_id FROM seen)
+		),
+		scores AS (
+			SELECT movie_id, (
+				%v * COALESCE(genre_weight / NULLIF(max(genre_weight) OVER (), 0), 0) +
+				%v * COALESCE(co_rating_weight / NULLIF(max(co_rating_weight) OVER (), 0), 0) +
+				%v * quality)::float8 AS score
+			FROM candidates
+		)`,
+		ratingScore, recommendGenreWeight, recommendCoRatingWeight, recommendQualityWeight)
+
+	return m.ranked(query, limit, userID, likedRating)
+}
+
+// ranked runs a query that begins with common table expressions, the last of
+// which is "scores", with a movie_id and a score for each movie to return. The
+// query's args are $1 and $2, and the limit is added as $3. It returns the
+// movies with the highest scores, with every field selected, best first.
+func (m RecommendationModel) ranked(ctes string, limit int, args ...any) ([]*Recommendation, error) {
+	columns, scan := movieProjection(nil, false)
+	query := fmt.Sprintf(`%s
+		SELECT %s, round(scores.score::numeric, 3)::float8
+		FROM movies
+		JOIN scores ON scores.movie_id = movies.id
+		ORDER BY scores.score DESC, movies.id ASC
+		LIMIT $3`, ctes, columns)
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recommendations := []*Recommendation{}
+
+	for rows.Next() {
+		var rec Recommendation
+		rec.Movie = &Movie{}
+		err = rows.Scan(append(scan(rec.Movie), &rec.Score)...)
+		if err != nil {
+			return nil, err
+		}
+		recommendations = append(recommendations, &rec)
+	}
+
+	return recommendations, rows.Err()
+}
@@ -0,0 +1,225 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/lib/pq"
+)
+
+// ReleaseTypes are the permitted values of Release.Type.
+var ReleaseTypes = []string{"theatrical", "digital", "festival"}
+
+// Certifications maps the countries whose age certification systems are
+// known to their certifications, from the least to the most restrictive.
+// Releases in these countries must use one of their certifications, and can
+// be filtered by the most restrictive certification to include. Releases in
+// other countries can have any certification, but can't be filtered by it.
+var Certifications = map[string][]string{
+	"AU": {"G", "PG", "M", "MA15+", "R18+", "X18+"},
+	"DE": {"0", "6", "12", "16", "18"},
+	"FR": {"TP", "12", "16", "18"},
+	"GB": {"U", "PG", "12A", "12", "15", "18", "R18"},
+	"US": {"G", "PG", "PG-13", "R", "NC-17"},
+}
+
+// maxReleases is the maximum number of releases of a movie.
+const maxReleases = 500
+
+// Release is a movie's release in a country, with the age certification it
+// was given there. Certification is empty if the release wasn't certified.
+type Release struct {
+	Country       string `json:"country"`
+	Type          string `json:"type"`
+	Date          Date   `json:"release_date"`
+	Certification string `json:"certification,omitempty"`
+}
+
+// ValidateReleases validates the releases of a movie. Errors are reported at
+// the path of the release, such as "releases[2].country".
+//
+//   - There must be no more than maxReleases releases.
+//   - The country must be an ISO 3166-1 code, and the type must be one of
+//     ReleaseTypes.
+//   - The date is required, and must be after 1888. Future releases are
+//     permitted.
+//   - If the country is in Certifications, the certification must be one of
+//     its certifications. Otherwise it must be less than 20 bytes.
+//   - A movie can only have one release of each type in a country.
+func ValidateReleases(v *validator.Validator, releases []Release) {
+	v.CheckCode(len(releases) <= maxReleases, "releases", validator.CodeTooLong,
+		"must not contain more than 500 releases", "max", maxReleases)
+
+	seen := make(map[[2]string]bool, len(releases))
+
+	for i, r := range releases {
+		v.CheckCode(r.Country != "", validator.Path("releases", i, "country"), validator.CodeRequired, "must be provided")
+		v.CheckCode(validator.Matches(r.Country, RegionRX), validator.Path("releases", i, "country"),
+			validator.CodeInvalidFormat, "must be a two letter ISO 3166-1 country code")
+
+		v.CheckCode(validator.PermittedValue(r.Type, ReleaseTypes...), validator.Path("releases", i, "type"),
+			validator.CodeNotPermitted, "must be theatrical, digital, or festival", "permitted", ReleaseTypes)
+
+		v.CheckCode(!r.Date.IsZero(), validator.Path("releases", i, "release_date"), validator.CodeRequired, "must be provided")
+		v.CheckCode(r.Date.Year() >= 1888, validator.Path("releases", i, "release_date"), validator.CodeOutOfRange,
+			"must be after 1888", "min", 1888)
+
+		if certifications, ok := Certifications[r.Country]; ok && r.Certification != "" {
+			v.CheckCode(validator.PermittedValue(r.Certification, certifications...), validator.Path("releases", i, "certification"),
+				validator.CodeNotPermitted, "must be one of "+strings.Join(certifications, ", "), "permitted", certifications)
+		}
+		v.CheckCode(len(r.Certification) < 20, validator.Path("releases", i, "certification"), validator.CodeTooLong,
+			"must be less than 20 bytes", "max", 19)
+
+		key := [2]string{r.Country, r.Type}
+		v.CheckCode(!seen[key], validator.Path("releases", i), validator.CodeDuplicate,
+			"must not repeat a type of release in a country")
+		seen[key] = true
+	}
+}
+
+// certificationsUpTo returns the certifications of each country in
+// Certifications that are no more restrictive than max, keyed by country. If
+// country is non-empty, only that country's certifications are considered.
+// Countries whose systems don't include max are left out.
+func certificationsUpTo(country, max string) map[string][]string {
+	permitted := make(map[string][]string)
+	for c, certifications := range Certifications {
+		if country != "" && c != country {
+			continue
+		}
+		if i := slices.Index(certifications, max); i >= 0 {
+			permitted[c] = certifications[:i+1]
+		}
+	}
+	return permitted
+}
+
+// releaseCondition returns the SQL condition, for MovieFilter.where, that
+// matches movies with a release that meets the filter's release criteria,
+// or an empty string if there are none. Every criterion must be met by the
+// same release.
+func (f MovieFilter) releaseCondition(args *queryArgs) string {
+	if f.ReleasedIn == "" && f.ReleasedAfter.IsZero() && f.ReleasedBefore.IsZero() && f.CertificationMax == "" {
+		return ""
+	}
+
+	conditions := []string{"movie_releases.movie_id = movies.id"}
+
+	if f.ReleasedIn != "" {
+		conditions = append(conditions, fmt.Sprintf("movie_releases.country = %s", args.add(f.ReleasedIn)))
+	}
+	if !f.ReleasedAfter.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("movie_releases.release_date >= %s", args.add(f.ReleasedAfter)))
+	}
+	if !f.ReleasedBefore.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("movie_releases.release_date <= %s", args.add(f.ReleasedBefore)))
+	}
+
+	if f.CertificationMax != "" {
+		permitted := certificationsUpTo(f.ReleasedIn, f.CertificationMax)
+
+		// Countries are sorted, so that the query is the same every time.
+		countries := make([]string, 0, len(permitted))
+		for c := range permitted {
+			countries = append(countries, c)
+		}
+		slices.Sort(countries)
+
+		var certified []string
+		for _, c := range countries {
+			certified = append(certified, fmt.Sprintf("(movie_releases.country = %s AND movie_releases.certification = ANY(%s))",
+				args.add(c), args.add(pq.Array(permitted[c]))))
+		}
+		if len(certified) == 0 {
+			certified = []string{"false"}
+		}
+		conditions = append(conditions, "("+strings.Join(certified, " OR ")+")")
+	}
+
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM movie_releases WHERE %s)", strings.Join(conditions, " AND "))
+}
+
+// ReleaseModel struct wraps an sql.DB connection pool and implements
+// operations on the movie_releases table.
+type ReleaseModel struct {
+	DB *sql.DB
+}
+
+// GetForMovie retrieves the releases of a movie, sorted by country and date.
+func (m ReleaseModel) GetForMovie(movieID int64) ([]Release, error) {
+	query := `
+		SELECT country, release_type, release_date, certification
+		FROM movie_releases
+		WHERE movie_id = $1
+		ORDER BY country, release_date, release_type`
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	releases := []Release{}
+
+	for rows.Next() {
+		var r Release
+		err = rows.Scan(&r.Country, &r.Type, &r.Date, &r.Certification)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+
+	return releases, rows.Err()
+}
+
+// Replace replaces the releases of a movie, in a single transaction. The
+// movie is locked first, so that concurrent replacements are serialized. If
+// the movie doesn't exist, or is in the trash, an ErrRecordNotFound error is
+// returned.
+func (m ReleaseModel) Replace(movieID int64, releases []Release) error {
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction does nothing.
+	defer tx.Rollback()
+
+	err = lockMovie(ctx, tx, movieID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM movie_releases WHERE movie_id = $1`, movieID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO movie_releases (movie_id, country, release_type, release_date, certification)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	for _, r := range releases {
+		_, err = tx.ExecContext(ctx, query, movieID, r.Country, r.Type, r.Date, r.Certification)
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Constraint == "movie_releases_movie_id_fkey" {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
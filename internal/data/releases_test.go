@@ -0,0 +1,103 @@
+package data
+
+import (
+	"testing"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+func TestValidateReleases(t *testing.T) {
+	date, _ := ParseDate("1999-03-31")
+
+	tests := []struct {
+		name     string
+		releases []Release
+		wantKey  string
+	}{
+		{"Valid", []Release{
+			{Country: "US", Type: "theatrical", Date: date, Certification: "R"},
+			{Country: "US", Type: "digital", Date: date},
+			{Country: "JP", Type: "theatrical", Date: date, Certification: "R15+"},
+		}, ""},
+		{"Bad country", []Release{{Country: "usa", Type: "theatrical", Date: date}}, "releases[0].country"},
+		{"Bad type", []Release{{Country: "US", Type: "vhs", Date: date}}, "releases[0].type"},
+		{"Missing date", []Release{{Country: "US", Type: "theatrical"}}, "releases[0].release_date"},
+		{"Unknown certification", []Release{{Country: "GB", Type: "theatrical", Date: date, Certification: "R"}}, "releases[0].certification"},
+		{"Duplicate", []Release{
+			{Country: "FR", Type: "festival", Date: date},
+			{Country: "FR", Type: "festival", Date: date},
+		}, "releases[1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateReleases(v, tt.releases)
+
+			if tt.wantKey == "" {
+				assert.Equal(t, v.Valid(), true)
+				return
+			}
+			assert.Equal(t, len(v.Details[tt.wantKey]), 1)
+		})
+	}
+}
+
+func TestCertificationsUpTo(t *testing.T) {
+	tests := []struct {
+		name    string
+		country string
+		max     string
+		want    map[string]int
+	}{
+		{"Country", "US", "PG-13", map[string]int{"US": 3}},
+		{"Every country", "", "PG", map[string]int{"AU": 2, "GB": 2, "US": 2}},
+		{"Not in country", "DE", "PG-13", map[string]int{}},
+		{"Unknown", "", "XYZ", map[string]int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := certificationsUpTo(tt.country, tt.max)
+			assert.Equal(t, len(got), len(tt.want))
+			for c, n := range tt.want {
+				assert.Equal(t, len(got[c]), n)
+			}
+		})
+	}
+}
+
+func TestValidateMovieFilterReleases(t *testing.T) {
+	after, _ := ParseDate("2021-01-01")
+	before, _ := ParseDate("2020-01-01")
+
+	tests := []struct {
+		name    string
+		filter  MovieFilter
+		wantKey string
+	}{
+		{"Valid", MovieFilter{ReleasedIn: "US", ReleasedAfter: before, ReleasedBefore: after, CertificationMax: "PG-13"}, ""},
+		{"Any country", MovieFilter{CertificationMax: "12A"}, ""},
+		{"Bad country", MovieFilter{ReleasedIn: "usa"}, "released_in"},
+		{"Not in country", MovieFilter{ReleasedIn: "DE", CertificationMax: "PG-13"}, "certification_max"},
+		{"Unsupported country", MovieFilter{ReleasedIn: "JP", CertificationMax: "G"}, "certification_max"},
+		{"Unknown", MovieFilter{CertificationMax: "XYZ"}, "certification_max"},
+		{"Dates reversed", MovieFilter{ReleasedAfter: after, ReleasedBefore: before}, "released_after"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.SearchMode, tt.filter.GenresMode = "fulltext", "all"
+
+			v := validator.New()
+			ValidateMovieFilter(v, tt.filter)
+
+			if tt.wantKey == "" {
+				assert.Equal(t, v.Valid(), true)
+				return
+			}
+			assert.Equal(t, len(v.Details[tt.wantKey]), 1)
+		})
+	}
+}
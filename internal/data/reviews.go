@@ -0,0 +1,395 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/lib/pq"
+)
+
+// Review is a struct representing a user's written review of a movie.
+//
+// Hidden reviews have a HiddenAt time, and are only shown to moderators.
+// ReportCount is the number of reports that haven't been resolved by a
+// moderator. Neither is part of a review's public JSON representation.
+type Review struct {
+	ID        int64        `json:"id"`
+	MovieID   int64        `json:"movie_id"`
+	Author    ReviewAuthor `json:"author"`
+	Body      string       `json:"body"`
+	Spoiler   bool         `json:"spoiler"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	Version   int32        `json:"version"`
+
+	HiddenAt    *time.Time `json:"-"`
+	ReportCount int        `json:"-"`
+}
+
+// ReviewAuthor is the user who wrote a review.
+type ReviewAuthor struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// ReviewReport is a user's report of a review, with their reason for it.
+type ReviewReport struct {
+	UserID    int64     `json:"user_id"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReviewModel struct wraps an sql.DB connection pool and implements
+// operations on the reviews and review_reports tables.
+type ReviewModel struct {
+	DB *sql.DB
+}
+
+// ValidateReview validates the fields of a Review struct. The body is
+// required, and must be less than 10,000 bytes.
+func ValidateReview(v *validator.Validator, r *Review) {
+	v.CheckCode(r.Body != "", "body", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(r.Body) < 10_000, "body", validator.CodeTooLong, "must be less than 10,000 bytes", "max", 9_999)
+}
+
+// ValidateReportReason checks that the reason for a report, which is
+// optional, is less than 1,000 bytes.
+func ValidateReportReason(v *validator.Validator, reason string) {
+	v.CheckCode(len(reason) < 1_000, "reason", validator.CodeTooLong, "must be less than 1,000 bytes", "max", 999)
+}
+
+// reviewColumns are the columns of a Review, with its author's name, which
+// are selected from reviewTables.
+const (
+	reviewColumns = `reviews.id, reviews.movie_id, reviews.user_id, users.name, reviews.body, reviews.spoiler,
+		reviews.created_at, reviews.updated_at, reviews.hidden_at, reviews.report_count, reviews.version`
+	reviewTables = `reviews JOIN users ON users.id = reviews.user_id`
+)
+
+// dests returns the destinations to scan reviewColumns into.
+func (r *Review) dests() []any {
+	return []any{
+		&r.ID,
+		&r.MovieID,
+		&r.Author.ID,
+		&r.Author.Name,
+		&r.Body,
+		&r.Spoiler,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+		&r.HiddenAt,
+		&r.ReportCount,
+		&r.Version,
+	}
+}
+
+// Insert adds a new record to the reviews table. The review's MovieID and
+// Author.ID must be set. The id, timestamps, and version are generated
+// automatically. If the movie no longer exists, an ErrRecordNotFound error is
+// returned.
+func (m ReviewModel) Insert(review *Review) error {
+	query := `
+		INSERT INTO reviews (movie_id, user_id, body, spoiler)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at, version`
+
+	args := []any{review.MovieID, review.Author.ID, review.Body, review.Spoiler}
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&review.ID, &review.CreatedAt, &review.UpdatedAt, &review.Version)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Constraint == "reviews_movie_id_fkey" {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Get retrieves a specific review by its ID, whether or not it is hidden. If
+// there is no matching record, an ErrRecordNotFound error is returned.
+func (m ReviewModel) Get(id int64) (*Review, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + reviewColumns + `
+		FROM ` + reviewTables + `
+		WHERE reviews.id = $1`
+
+	var review Review
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(review.dests()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &review, nil
+}
+
+// GetForMovie retrieves a page of the reviews of a movie that aren't hidden,
+// sorted and paginated by the Filters.
+func (m ReviewModel) GetForMovie(movieID int64, filters Filters) ([]*Review, Metadata, error) {
+	return m.getAll("reviews.movie_id = $1 AND reviews.hidden_at IS NULL", movieID, filters)
+}
+
+// GetForModeration retrieves a page of the reviews that are waiting for a
+// moderator, sorted and paginated by the Filters. If hidden is false, these
+// are the visible reviews with unresolved reports. If hidden is true, they
+// are the hidden reviews, which can be restored.
+func (m ReviewModel) GetForModeration(hidden bool, filters Filters) ([]*Review, Metadata, error) {
+	if hidden {
+		return m.getAll("reviews.hidden_at IS NOT NULL", nil, filters)
+	}
+	return m.getAll("reviews.report_count > 0 AND reviews.hidden_at IS NULL", nil, filters)
+}
+
+// getAll retrieves a page of the reviews that match the condition, sorted and
+// paginated by the Filters. If arg is non-nil, the condition can refer to it
+// as $1.
+func (m ReviewModel) getAll(condition string, arg any, filters Filters) ([]*Review, Metadata, error) {
+	args := queryArgs{}
+	if arg != nil {
+		args.add(arg)
+	}
+
+	// The sort column is qualified, since the users table has some of the same
+	// columns.
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM %s
+		WHERE %s
+		ORDER BY reviews.%s %s, reviews.id ASC
+		LIMIT %s OFFSET %s`,
+		reviewColumns, reviewTables, condition, filters.sortColumn(), filters.sortDirection(),
+		args.add(filters.limit()), args.add(filters.offset()))
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+		err = rows.Scan(append([]any{&totalRecords}, review.dests()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		reviews = append(reviews, &review)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return reviews, metadata, nil
+}
+
+// Update updates the body and spoiler flag of a review that isn't hidden. Its
+// updated_at time is set, and its version is incremented. If the version
+// doesn't match, or the review was hidden or deleted, an ErrEditConflict
+// error is returned.
+func (m ReviewModel) Update(review *Review) error {
+	query := `
+		UPDATE reviews
+		SET body = $1, spoiler = $2, updated_at = NOW(), version = version + 1
+		WHERE id = $3 AND version = $4 AND hidden_at IS NULL
+		RETURNING updated_at, version`
+
+	args := []any{review.Body, review.Spoiler, review.ID, review.Version}
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&review.UpdatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete permanently deletes a review, along with its reports. The review is
+// only deleted if its version still matches review.Version, so that an edit
+// made since it was fetched isn't silently thrown away. If there is no
+// matching record, an ErrEditConflict error is returned.
+func (m ReviewModel) Delete(review *Review) error {
+	if review.ID < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM reviews WHERE id = $1 AND version = $2`, review.ID, review.Version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Report records a user's report of a review, which puts it in the moderation
+// queue. A user's further reports of the same review are ignored until a
+// moderator resolves them. If the review no longer exists, an
+// ErrRecordNotFound error is returned.
+func (m ReviewModel) Report(reviewID, userID int64, reason string) error {
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction does nothing.
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO review_reports (review_id, user_id, reason)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`,
+		reviewID, userID, reason)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Constraint == "review_reports_review_id_fkey" {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected > 0 {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE reviews SET report_count = report_count + 1 WHERE id = $1`,
+			reviewID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetReports returns the unresolved reports of the reviews with the given
+// IDs, oldest first, keyed by review ID.
+func (m ReviewModel) GetReports(reviewIDs []int64) (map[int64][]ReviewReport, error) {
+	query := `
+		SELECT review_id, user_id, reason, created_at
+		FROM review_reports
+		WHERE review_id = ANY($1)
+		ORDER BY created_at, user_id`
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(reviewIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := make(map[int64][]ReviewReport)
+
+	for rows.Next() {
+		var reviewID int64
+		var report ReviewReport
+		err = rows.Scan(&reviewID, &report.UserID, &report.Reason, &report.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		reports[reviewID] = append(reports[reviewID], report)
+	}
+
+	return reports, rows.Err()
+}
+
+// SetHidden hides or restores a review, and resolves its reports. The
+// review's version is incremented, so that pending edits by its author result
+// in an edit conflict. If there is no matching record, an ErrRecordNotFound
+// error is returned.
+func (m ReviewModel) SetHidden(id int64, hidden bool) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction does nothing.
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE reviews SET
+			hidden_at = CASE WHEN $2 THEN COALESCE(hidden_at, NOW()) END,
+			report_count = 0,
+			version = version + 1
+		WHERE id = $1`,
+		id, hidden)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM review_reports WHERE review_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
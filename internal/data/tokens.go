@@ -101,8 +101,8 @@ func generateToken(userID int64, ttl time.Duration, scope Scope) (*Token, error)
 // string provided is exactly 26 bytes long. This is the number of bytes
 // generated with 16 bytes of randomness are encoded into base-32.
 func ValidateTokenPlaintext(v *validator.Validator, plaintext string) {
-	v.Check(plaintext != "", "token", "must be provided")
-	v.Check(len(plaintext) == 26, "token", "must be 26 bytes long")
+	v.CheckCode(plaintext != "", "token", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(plaintext) == 26, "token", validator.CodeInvalidFormat, "must be 26 bytes long")
 }
 
 // The TokenModel struct encapsulates database interactions with the tokens
@@ -0,0 +1,192 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+)
+
+var (
+	// LanguageRX matches a lowercase ISO 639 language code, such as "es".
+	LanguageRX = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+	// RegionRX matches an uppercase ISO 3166-1 country code, such as "MX".
+	RegionRX = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// maxTranslations is the maximum number of translations of a movie.
+const maxTranslations = 200
+
+// MovieTranslation is a movie's alternate title and synopsis in a language.
+// Region is empty if the translation applies to every region where the
+// language is spoken.
+type MovieTranslation struct {
+	Language string `json:"language"`
+	Region   string `json:"region,omitempty"`
+	Title    string `json:"title"`
+	Synopsis string `json:"synopsis,omitempty"`
+}
+
+// Tag returns the translation's language tag, such as "es" or "es-MX".
+func (t MovieTranslation) Tag() string {
+	if t.Region == "" {
+		return t.Language
+	}
+	return t.Language + "-" + t.Region
+}
+
+// BestTranslation returns the translation that best matches a language range
+// from an Accept-Language header, such as "es-mx". A translation for the same
+// language and region is preferred, then one for the language in every
+// region, then one for the language in another region. ok is false if no
+// translation is in the range's language.
+func BestTranslation(translations []MovieTranslation, languageRange string) (t MovieTranslation, ok bool) {
+	language, region, _ := strings.Cut(strings.ToLower(languageRange), "-")
+
+	best := -1
+	for _, tr := range translations {
+		if tr.Language != language {
+			continue
+		}
+
+		rank := 0
+		switch {
+		case region != "" && strings.EqualFold(tr.Region, region):
+			rank = 2
+		case tr.Region == "":
+			rank = 1
+		}
+
+		if rank > best {
+			t, best = tr, rank
+		}
+	}
+
+	return t, best >= 0
+}
+
+// ValidateTranslations validates the translations of a movie. Errors are
+// reported at the path of the translation, such as "translations[2].title".
+//
+//   - There must be no more than maxTranslations translations.
+//   - The language must be an ISO 639 code, and the region, if provided, an
+//     ISO 3166-1 code.
+//   - The title is required, and must be less than 500 bytes, like the
+//     movie's own title. The synopsis must be less than 10,000 bytes.
+//   - A language and region can only be translated once.
+func ValidateTranslations(v *validator.Validator, translations []MovieTranslation) {
+	v.CheckCode(len(translations) <= maxTranslations, "translations", validator.CodeTooLong,
+		"must not contain more than 200 translations", "max", maxTranslations)
+
+	seen := make(map[string]bool, len(translations))
+
+	for i, t := range translations {
+		v.CheckCode(t.Language != "", validator.Path("translations", i, "language"), validator.CodeRequired, "must be provided")
+		v.CheckCode(validator.Matches(t.Language, LanguageRX), validator.Path("translations", i, "language"),
+			validator.CodeInvalidFormat, "must be a two or three letter ISO 639 language code")
+		v.CheckCode(t.Region == "" || validator.Matches(t.Region, RegionRX), validator.Path("translations", i, "region"),
+			validator.CodeInvalidFormat, "must be a two letter ISO 3166-1 country code")
+
+		v.CheckCode(t.Title != "", validator.Path("translations", i, "title"), validator.CodeRequired, "must be provided")
+		v.CheckCode(len(t.Title) < 500, validator.Path("translations", i, "title"), validator.CodeTooLong,
+			"must be less than 500 bytes", "max", 499)
+		v.CheckCode(len(t.Synopsis) < 10_000, validator.Path("translations", i, "synopsis"), validator.CodeTooLong,
+			"must be less than 10,000 bytes", "max", 9_999)
+
+		v.CheckCode(!seen[t.Tag()], validator.Path("translations", i), validator.CodeDuplicate,
+			"must not repeat a language and region", "value", t.Tag())
+		seen[t.Tag()] = true
+	}
+}
+
+// TranslationModel struct wraps an sql.DB connection pool and implements
+// operations on the movie_translations table.
+type TranslationModel struct {
+	DB *sql.DB
+}
+
+// GetForMovie retrieves the translations of a movie, sorted by language and
+// region.
+func (m TranslationModel) GetForMovie(movieID int64) ([]MovieTranslation, error) {
+	query := `
+		SELECT language, region, title, synopsis
+		FROM movie_translations
+		WHERE movie_id = $1
+		ORDER BY language, region`
+
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := []MovieTranslation{}
+
+	for rows.Next() {
+		var t MovieTranslation
+		err = rows.Scan(&t.Language, &t.Region, &t.Title, &t.Synopsis)
+		if err != nil {
+			return nil, err
+		}
+		translations = append(translations, t)
+	}
+
+	return translations, rows.Err()
+}
+
+// Replace replaces the translations of a movie, in a single transaction. The
+// movie's version is incremented, since its localized representations
+// change, and movie.Version is set to the new version. The translations are
+// only replaced if the movie's version still matches movie.Version, so that
+// an update made since the movie was fetched isn't silently thrown away. If
+// it doesn't, an ErrEditConflict error is returned. If the movie doesn't
+// exist, or is in the trash, an ErrRecordNotFound error is returned.
+func (m TranslationModel) Replace(movie *Movie, translations []MovieTranslation) error {
+	ctx, cancel := CreateTimeoutContext(QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction does nothing.
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE movies SET version = version + 1
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+		RETURNING version`,
+		movie.ID, movie.Version).Scan(&movie.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return movieConflict(ctx, tx, movie.ID)
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM movie_translations WHERE movie_id = $1`, movie.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO movie_translations (movie_id, language, region, title, synopsis)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	for _, t := range translations {
+		_, err = tx.ExecContext(ctx, query, movie.ID, t.Language, t.Region, t.Title, t.Synopsis)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
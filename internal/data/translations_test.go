@@ -0,0 +1,75 @@
+package data
+
+import (
+	"testing"
+
+	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+func TestBestTranslation(t *testing.T) {
+	translations := []MovieTranslation{
+		{Language: "es", Region: "ES", Title: "Los caballeros de la mesa cuadrada"},
+		{Language: "es", Title: "Los caballeros de la mesa cuadrada y sus locos seguidores"},
+		{Language: "es", Region: "MX", Title: "Monty Python y el Santo Grial"},
+		{Language: "fr", Region: "CA", Title: "Monty Python: Sacré Graal!"},
+	}
+
+	tests := []struct {
+		name      string
+		lang      string
+		wantTitle string
+		wantOK    bool
+	}{
+		{"Language and region", "es-mx", "Monty Python y el Santo Grial", true},
+		{"Language only", "es", "Los caballeros de la mesa cuadrada y sus locos seguidores", true},
+		{"Unknown region", "es-ar", "Los caballeros de la mesa cuadrada y sus locos seguidores", true},
+		{"Other region", "fr", "Monty Python: Sacré Graal!", true},
+		{"Unknown language", "de", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := BestTranslation(translations, tt.lang)
+			assert.Equal(t, ok, tt.wantOK)
+			assert.Equal(t, got.Title, tt.wantTitle)
+		})
+	}
+}
+
+func TestValidateTranslations(t *testing.T) {
+	tests := []struct {
+		name         string
+		translations []MovieTranslation
+		wantKey      string
+	}{
+		{"Valid", []MovieTranslation{{Language: "es", Region: "MX", Title: "Título"}, {Language: "es", Title: "Título"}}, ""},
+		{"Bad language", []MovieTranslation{{Language: "spanish", Title: "Título"}}, "translations[0].language"},
+		{"Bad region", []MovieTranslation{{Language: "es", Region: "mx", Title: "Título"}}, "translations[0].region"},
+		{"Missing title", []MovieTranslation{{Language: "es"}}, "translations[0].title"},
+		{"Duplicate", []MovieTranslation{{Language: "es", Title: "A"}, {Language: "es", Title: "B"}}, "translations[1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateTranslations(v, tt.translations)
+
+			if tt.wantKey == "" {
+				assert.Equal(t, v.Valid(), true)
+				return
+			}
+			assert.Equal(t, len(v.Details[tt.wantKey]), 1)
+		})
+	}
+}
+
+func TestMovieLocalize(t *testing.T) {
+	m := Movie{Title: "Spirited Away"}
+	m.Localize(MovieTranslation{Language: "ja", Title: "千と千尋の神隠し", Synopsis: "..."})
+
+	assert.Equal(t, m.Title, "千と千尋の神隠し")
+	assert.Equal(t, m.OriginalTitle, "Spirited Away")
+	assert.Equal(t, m.Language, "ja")
+	assert.Equal(t, m.Synopsis, "...")
+}
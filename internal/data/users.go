@@ -3,9 +3,11 @@ package data
 import (
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	validator "github.com/kvnloughead/greenlight/internal"
+	"github.com/kvnloughead/greenlight/internal/i18n"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -27,9 +29,14 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
+	Locale    string    `json:"locale"`
 	Version   int32     `json:"-"`
 }
 
+// UserFields are the fields of a User that can be selected with a sparse
+// fieldset.
+var UserFields = []string{"id", "created_at", "name", "email", "activated", "locale"}
+
 // AnonymousUser is a pointer to an empty, non-activated, User struct.
 var AnonymousUser = &User{}
 
@@ -50,11 +57,11 @@ type UserModel struct {
 // returned.
 func (m UserModel) Insert(user *User) error {
 	query := `
-		INSERT INTO users (name, email, password_hash, activated)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO users (name, email, password_hash, activated, locale)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at, version`
 
-	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated, user.Locale}
 
 	ctx, cancel := CreateTimeoutContext(QueryTimeout)
 	defer cancel()
@@ -79,7 +86,7 @@ func (m UserModel) Insert(user *User) error {
 // If no such record exists, it returns an ErrRecordNotFound error.
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, created_at, name, email, password_hash, activated, version
+		SELECT id, created_at, name, email, password_hash, activated, locale, version
 		FROM users
 		where email = $1`
 
@@ -99,6 +106,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Locale,
 		&user.Version,
 	)
 
@@ -119,7 +127,7 @@ func (m UserModel) GetForToken(scope Scope, tokenPlaintext string) (*User, error
 	tokenHash := CalculateHash(tokenPlaintext)
 
 	query := `
-		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.locale, users.version
 		FROM users
 		INNER JOIN tokens
 		ON users.id = tokens.user_id
@@ -140,6 +148,7 @@ func (m UserModel) GetForToken(scope Scope, tokenPlaintext string) (*User, error
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Locale,
 		&user.Version,
 	)
 	if err != nil {
@@ -164,9 +173,9 @@ func (m UserModel) GetForToken(scope Scope, tokenPlaintext string) (*User, error
 func (m UserModel) Update(user *User) error {
 	query := `
 		UPDATE users
-		SET name = $1, email = $2, password_hash = $3, activated = $4,
+		SET name = $1, email = $2, password_hash = $3, activated = $4, locale = $5,
 			version = version + 1
-		WHERE id = $5 and version = $6
+		WHERE id = $6 and version = $7
 		RETURNING version`
 
 	args := []any{
@@ -174,6 +183,7 @@ func (m UserModel) Update(user *User) error {
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.Locale,
 		user.ID,
 		user.Version,
 	}
@@ -242,11 +252,12 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 // using validator.EmailRX to determine validity. If any checks fail, errors
 // are added to the validator's Errors map.
 func ValidateEmail(v *validator.Validator, email string) {
-	v.Check(email != "", "email", "must be provided")
-	v.Check(validator.Matches(
+	v.CheckCode(email != "", "email", validator.CodeRequired, "must be provided")
+	v.CheckCode(validator.Matches(
 		email,
 		validator.EmailRX),
 		"email",
+		validator.CodeInvalidFormat,
 		"must be a valid email adress",
 	)
 }
@@ -255,9 +266,9 @@ func ValidateEmail(v *validator.Validator, email string) {
 // and between 8 and 72 bytes long. If any checks fail, errors
 // are added to the validator's Errors map.
 func ValidatePasswordPlaintext(v *validator.Validator, password string) {
-	v.Check(password != "", "password", "must be provided")
-	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
-	v.Check(len(password) <= 72, "password", "must be no more than 72 bytes long")
+	v.CheckCode(password != "", "password", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(password) >= 8, "password", validator.CodeTooShort, "must be at least 8 bytes long", "min", 8)
+	v.CheckCode(len(password) <= 72, "password", validator.CodeTooLong, "must be no more than 72 bytes long", "max", 72)
 }
 
 // ValidateUser checks various aspects of a user object. If any checks fail,
@@ -266,13 +277,20 @@ func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 //   - Name should be non-empty and no more than 500 bytes
 //   - Email should be non-empty and valid (ie, matching validator.EmailRX)
 //   - Password.plaintext should be non-empty and between 8 and 72 bytes long
+//   - Locale should be one of the locales supported by package i18n. It is
+//     normalized first, so "ES" and "fr-FR" are accepted as "es" and "fr".
 //
 // A panic occurs if Password.hash is nil.
 func ValidateUser(v *validator.Validator, u *User) {
-	v.Check(u.Name != "", "name", "must be provided")
-	v.Check(len(u.Name) < 500, "name", "must be no more than 500 bytes long")
+	v.CheckCode(u.Name != "", "name", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(u.Name) < 500, "name", validator.CodeTooLong, "must be no more than 500 bytes long", "max", 499)
 	ValidateEmail(v, u.Email)
 
+	u.Locale = i18n.Normalize(u.Locale)
+	locales := i18n.Locales()
+	v.CheckCode(i18n.Supported(u.Locale), "locale", validator.CodeNotPermitted,
+		"must be one of "+strings.Join(locales, ", "), "permitted", locales)
+
 	// The plaintext password will be nil in some circumstances, so we omit the
 	// validation in these cases.
 	if u.Password.plaintext != nil {
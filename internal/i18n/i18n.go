@@ -0,0 +1,230 @@
+// Package i18n translates the API's messages into the languages that it
+// supports. Translations are loaded from the JSON files embedded in the
+// "./locales" directory, one for each locale, named after its language tag.
+//
+// English is the source language. Its messages are written in the code, and
+// passed to Translate as defaults, so it doesn't have a catalogue of its own.
+// Messages that are missing from a catalogue are sent in English.
+package i18n
+
+import (
+	"cmp"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+//go:embed "locales"
+var localeFS embed.FS
+
+// DefaultLocale is the locale of the messages written in the code. It is used
+// when the client doesn't accept any of the supported locales.
+const DefaultLocale = "en"
+
+// catalogues maps each supported locale, other than DefaultLocale, to its
+// messages, keyed by message key.
+var catalogues = mustLoad()
+
+// mustLoad reads the catalogues from the embedded locales directory. Since
+// the files are compiled into the binary, a malformed file is a programming
+// error, and causes a panic.
+func mustLoad() map[string]map[string]string {
+	entries, err := localeFS.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	catalogues := make(map[string]map[string]string, len(entries))
+	for _, entry := range entries {
+		js, err := localeFS.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+
+		var messages map[string]string
+		err = json.Unmarshal(js, &messages)
+		if err != nil {
+			panic(fmt.Sprintf("i18n: %s: %v", entry.Name(), err))
+		}
+
+		locale := strings.ToLower(strings.TrimSuffix(entry.Name(), ".json"))
+		catalogues[locale] = messages
+	}
+	return catalogues
+}
+
+// Locales returns the supported locales, in alphabetical order.
+func Locales() []string {
+	locales := []string{DefaultLocale}
+	for locale := range catalogues {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales)
+	return locales
+}
+
+// Supported reports whether a locale is one of the supported locales.
+func Supported(locale string) bool {
+	_, ok := catalogues[locale]
+	return ok || locale == DefaultLocale
+}
+
+// Preferences returns the language ranges of an Accept-Language header, most
+// preferred first, with ties in the order they were listed. Ranges are
+// lowercased. The "*" range, ranges with malformed quality values, and ranges
+// that the client refuses with a quality value of zero are left out.
+func Preferences(acceptLanguage string) []string {
+	type preference struct {
+		tag string
+		q   float64
+	}
+
+	var prefs []preference
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if s, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			q, err = strconv.ParseFloat(s, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		prefs = append(prefs, preference{tag, q})
+	}
+
+	slices.SortStableFunc(prefs, func(a, b preference) int {
+		return cmp.Compare(b.q, a.q)
+	})
+
+	tags := make([]string, len(prefs))
+	for i, pref := range prefs {
+		tags[i] = pref.tag
+	}
+	return tags
+}
+
+// Match chooses a supported locale from the value of an Accept-Language
+// header. The language range with the highest quality value that matches a
+// supported locale is chosen, with ties going to the range listed first. A
+// range such as "es-MX" matches the "es" locale if there isn't an "es-mx"
+// locale. DefaultLocale is returned if no range matches.
+func Match(acceptLanguage string) string {
+	for _, tag := range Preferences(acceptLanguage) {
+		if locale, ok := lookup(tag); ok {
+			return locale
+		}
+	}
+
+	return DefaultLocale
+}
+
+// Normalize returns the supported locale that a language tag matches, in the
+// same way as Match, so that a tag such as "ES" or "fr-FR" is accepted as a
+// user's locale. Underscores are treated as hyphens. If the tag doesn't match
+// a supported locale, it is returned lowercased, and Supported reports false
+// for it.
+func Normalize(tag string) string {
+	tag = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(tag)), "_", "-")
+	if locale, ok := lookup(tag); ok {
+		return locale
+	}
+	return tag
+}
+
+// lookup returns the supported locale that a lowercase language tag matches,
+// removing subtags from the end of the tag until one does.
+func lookup(tag string) (string, bool) {
+	for tag != "" {
+		if Supported(tag) {
+			return tag, true
+		}
+		i := strings.LastIndex(tag, "-")
+		if i < 0 {
+			break
+		}
+		tag = tag[:i]
+	}
+	return "", false
+}
+
+// Translate returns the message with the key in the locale's catalogue, with
+// the params substituted for its placeholders. A placeholder is a param's name
+// in braces, such as "{max}". Slices are joined with commas.
+//
+// If the catalogue doesn't have the message, the default is returned as it is,
+// and ok is false.
+func Translate(locale, key, def string, params map[string]any) (msg string, ok bool) {
+	msg, ok = catalogues[locale][key]
+	if !ok {
+		return def, false
+	}
+
+	for name, value := range params {
+		msg = strings.ReplaceAll(msg, "{"+name+"}", format(value))
+	}
+	return msg, true
+}
+
+// format returns the text of a param.
+func format(value any) string {
+	switch v := value.(type) {
+	case []string:
+		return strings.Join(v, ", ")
+	case []any:
+		parts := make([]string, len(v))
+		for i, elem := range v {
+			parts[i] = format(elem)
+		}
+		return strings.Join(parts, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Message is a message that can be translated. Key identifies the message in
+// the catalogues, and Default is its English text, with the params already
+// substituted. Message implements fmt.Stringer, so that it is logged in
+// English.
+type Message struct {
+	Key     string
+	Default string
+	Params  map[string]any
+}
+
+// NewMessage returns a Message. The params are alternating names and values,
+// as in log/slog.
+func NewMessage(key, def string, params ...any) Message {
+	msg := Message{Key: key, Default: def}
+	if len(params) > 0 {
+		msg.Params = make(map[string]any, len(params)/2)
+		for i := 0; i+1 < len(params); i += 2 {
+			msg.Params[fmt.Sprint(params[i])] = params[i+1]
+		}
+	}
+	return msg
+}
+
+// String returns the English text of the message.
+func (m Message) String() string {
+	return m.Default
+}
+
+// In returns the text of the message in a locale.
+func (m Message) In(locale string) string {
+	msg, _ := Translate(locale, m.Key, m.Default, m.Params)
+	return msg
+}
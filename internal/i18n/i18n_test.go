@@ -0,0 +1,100 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"No header", "", DefaultLocale},
+		{"Exact", "es", "es"},
+		{"Region", "fr-CA", "fr"},
+		{"Case-insensitive", "ES-mx", "es"},
+		{"Quality", "es;q=0.5, fr", "fr"},
+		{"First of equal quality", "fr, es", "fr"},
+		{"Unsupported skipped", "de, es;q=0.2", "es"},
+		{"Refused", "es;q=0", DefaultLocale},
+		{"Wildcard", "*", DefaultLocale},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Match(tt.header), tt.want)
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		want string
+	}{
+		{"Exact", "es", "es"},
+		{"Uppercase", "ES", "es"},
+		{"Region", "fr-FR", "fr"},
+		{"Underscore", "es_MX", "es"},
+		{"Default", "en-GB", DefaultLocale},
+		{"Unsupported", "DE", "de"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Normalize(tt.tag), tt.want)
+		})
+	}
+}
+
+func TestPreferences(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   []string
+	}{
+		{"No header", "", []string{}},
+		{"Quality order", "es;q=0.5, ja-JP, fr;q=0.8", []string{"ja-jp", "fr", "es"}},
+		{"Ties keep order", "fr, es", []string{"fr", "es"}},
+		{"Refused and wildcard skipped", "de;q=0, *, es;q=0.2", []string{"es"}},
+		{"Malformed quality skipped", "de;q=x, es", []string{"es"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, strings.Join(Preferences(tt.header), ","), strings.Join(tt.want, ","))
+		})
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	msg, ok := Translate("es", "validation.too_long.max", "too long", map[string]any{"max": 5})
+	assert.Equal(t, ok, true)
+	assert.Equal(t, msg, "es demasiado largo (máximo 5)")
+
+	msg, ok = Translate("en", "validation.too_long.max", "too long", nil)
+	assert.Equal(t, ok, false)
+	assert.Equal(t, msg, "too long")
+
+	m := NewMessage("validation.not_permitted.permitted", "must be a or b", "permitted", []string{"a", "b"})
+	assert.Equal(t, m.String(), "must be a or b")
+	assert.Equal(t, m.In("fr"), "doit être l'un de a, b")
+}
+
+// TestCataloguesComplete checks that every catalogue has the same messages.
+func TestCataloguesComplete(t *testing.T) {
+	for locale, messages := range catalogues {
+		for other, otherMessages := range catalogues {
+			for key := range otherMessages {
+				if _, ok := messages[key]; !ok {
+					t.Errorf("%s: missing %q, which is in %s", locale, key, other)
+				}
+			}
+		}
+	}
+}
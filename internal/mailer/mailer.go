@@ -1,11 +1,17 @@
 // Package mailer declares an embedded file system to store our email templates,
 // which are stored in the "./templates" directory in the same package.
+//
+// English templates are stored in the directory itself. Translations are
+// stored in subdirectories named after their locale, such as
+// "./templates/es", with the same file names as the English templates.
 package mailer
 
 import (
 	"bytes"
 	"embed"
 	"html/template"
+	"io/fs"
+	"path"
 	"time"
 
 	"github.com/go-mail/mail/v2"
@@ -39,9 +45,17 @@ func New(host string, port int, username, password, sender string) Mailer {
 // recipient. Errors are returned if the template file, or its "subject"
 // sub-template, can't be parsed. The data object is used to provide data for
 // interpolation in the templates.
-func (m Mailer) Send(recipient, tmplFile string, data any) error {
-	// Parse the provided template file.
-	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+tmplFile)
+//
+// The email is sent in the recipient's locale if the template has been
+// translated into it, and in English otherwise.
+func (m Mailer) Send(recipient, locale, tmplFile string, data any) error {
+	// Parse the provided template file, in the recipient's locale if possible.
+	tmplPath := path.Join("templates", locale, tmplFile)
+	if _, err := fs.Stat(templateFS, tmplPath); locale == "" || err != nil {
+		tmplPath = path.Join("templates", tmplFile)
+	}
+
+	tmpl, err := template.New("email").ParseFS(templateFS, tmplPath)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,472 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902)
+// documents to JSON documents. Documents are decoded into generic values, so
+// the patches can be applied to any resource representation.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidPatch is returned if a patch document is malformed, for example
+	// if an operation is missing a required member.
+	ErrInvalidPatch = errors.New("invalid patch document")
+
+	// ErrPathNotFound is returned if an operation refers to a location that
+	// doesn't exist in the target document.
+	ErrPathNotFound = errors.New("path not found")
+
+	// ErrTestFailed is returned if a "test" operation doesn't match.
+	ErrTestFailed = errors.New("test operation failed")
+)
+
+// Merge applies a JSON Merge Patch to the doc, and returns the patched
+// document. Members of the patch replace the corresponding members of the
+// document, members with a null value are removed, and objects are merged
+// recursively.
+func Merge(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	return json.Marshal(mergeValue(target, p))
+}
+
+// mergeValue implements the MergePatch function from RFC 7396.
+func mergeValue(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = mergeValue(t[key], value)
+	}
+
+	return t
+}
+
+// operation is a single operation of a JSON Patch document.
+type operation struct {
+	Op       string
+	Path     []string
+	From     []string
+	Value    any
+	HasValue bool
+}
+
+// Apply applies a JSON Patch to the doc, and returns the patched document.
+// The operations are applied in order, and if any of them fails the whole
+// patch fails.
+func Apply(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	ops, err := parseOperations(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		target, err = op.apply(target)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+// parseOperations decodes a JSON Patch document into a slice of operations,
+// checking that each operation has the members its op requires.
+func parseOperations(patch []byte) ([]operation, error) {
+	var raw []map[string]json.RawMessage
+
+	err := json.Unmarshal(patch, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: must be an array of operations", ErrInvalidPatch)
+	}
+
+	ops := make([]operation, 0, len(raw))
+
+	for i, members := range raw {
+		var op operation
+
+		err = json.Unmarshal(members["op"], &op.Op)
+		if err != nil {
+			return nil, fmt.Errorf("%w: operation %d is missing \"op\"", ErrInvalidPatch, i)
+		}
+
+		var path string
+		err = json.Unmarshal(members["path"], &path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: operation %d is missing \"path\"", ErrInvalidPatch, i)
+		}
+		op.Path, err = parsePointer(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %v", ErrInvalidPatch, i, err)
+		}
+
+		switch op.Op {
+		case "add", "replace", "test":
+			value, ok := members["value"]
+			if !ok {
+				return nil, fmt.Errorf("%w: operation %d is missing \"value\"", ErrInvalidPatch, i)
+			}
+			op.Value, err = decode(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: operation %d: %v", ErrInvalidPatch, i, err)
+			}
+			op.HasValue = true
+
+		case "move", "copy":
+			var from string
+			err = json.Unmarshal(members["from"], &from)
+			if err != nil {
+				return nil, fmt.Errorf("%w: operation %d is missing \"from\"", ErrInvalidPatch, i)
+			}
+			op.From, err = parsePointer(from)
+			if err != nil {
+				return nil, fmt.Errorf("%w: operation %d: %v", ErrInvalidPatch, i, err)
+			}
+
+		case "remove":
+
+		default:
+			return nil, fmt.Errorf("%w: operation %d has unknown op %q", ErrInvalidPatch, i, op.Op)
+		}
+
+		ops = append(ops, op)
+	}
+
+	return ops, nil
+}
+
+// apply applies the operation to the document, and returns the new document.
+func (op operation) apply(doc any) (any, error) {
+	switch op.Op {
+	case "add":
+		return add(doc, op.Path, op.Value)
+
+	case "remove":
+		doc, _, err := remove(doc, op.Path)
+		return doc, err
+
+	case "replace":
+		doc, _, err := remove(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, op.Value)
+
+	case "move":
+		if isProperPrefix(op.From, op.Path) {
+			return nil, fmt.Errorf("%w: cannot move a value into one of its children", ErrInvalidPatch)
+		}
+		doc, value, err := remove(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, value)
+
+	case "copy":
+		value, err := get(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, deepCopy(value))
+
+	case "test":
+		value, err := get(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(value, op.Value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+
+	return nil, ErrInvalidPatch
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its reference tokens. The
+// empty string refers to the whole document.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i := range tokens {
+		tokens[i] = strings.ReplaceAll(tokens[i], "~1", "/")
+		tokens[i] = strings.ReplaceAll(tokens[i], "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// isProperPrefix reports whether the prefix pointer refers to an ancestor of
+// the location referred to by the tokens pointer.
+func isProperPrefix(prefix, tokens []string) bool {
+	if len(prefix) >= len(tokens) {
+		return false
+	}
+
+	for i := range prefix {
+		if prefix[i] != tokens[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// arrayIndex parses an array index token. If end is true, the index may be
+// equal to the length of the array, and "-" refers to that position.
+func arrayIndex(token string, length int, end bool) (int, error) {
+	if end && token == "-" {
+		return length, nil
+	}
+
+	// Leading zeros aren't permitted by RFC 6901.
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrPathNotFound, token)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > length || (i == length && !end) {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrPathNotFound, token)
+	}
+
+	return i, nil
+}
+
+// get returns the value at the location referred to by the tokens.
+func get(doc any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: %q", ErrPathNotFound, token)
+			}
+			doc = value
+
+		case []any:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrPathNotFound, token)
+		}
+	}
+
+	return doc, nil
+}
+
+// add adds the value at the location referred to by the tokens, and returns
+// the new document. Object members are created or replaced, and values are
+// inserted into arrays.
+func add(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	token, rest := tokens[0], tokens[1:]
+
+	switch node := doc.(type) {
+	case map[string]any:
+		if len(rest) == 0 {
+			node[token] = value
+			return node, nil
+		}
+
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrPathNotFound, token)
+		}
+
+		child, err := add(child, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+
+	case []any:
+		i, err := arrayIndex(token, len(node), len(rest) == 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(rest) == 0 {
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+
+		node[i], err = add(node[i], rest, value)
+		if err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrPathNotFound, token)
+}
+
+// remove removes the value at the location referred to by the tokens. It
+// returns the new document and the removed value.
+func remove(doc any, tokens []string) (any, any, error) {
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+
+	token, rest := tokens[0], tokens[1:]
+
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %q", ErrPathNotFound, token)
+		}
+
+		if len(rest) == 0 {
+			delete(node, token)
+			return node, child, nil
+		}
+
+		child, removed, err := remove(child, rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		node[token] = child
+		return node, removed, nil
+
+	case []any:
+		i, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(rest) == 0 {
+			removed := node[i]
+			return append(node[:i], node[i+1:]...), removed, nil
+		}
+
+		child, removed, err := remove(node[i], rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		node[i] = child
+		return node, removed, nil
+	}
+
+	return nil, nil, fmt.Errorf("%w: %q", ErrPathNotFound, token)
+}
+
+// decode decodes a JSON document into a generic value. Numbers are decoded as
+// json.Number, so they aren't altered by a round trip through float64.
+func decode(doc []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+
+	var value any
+	err := dec.Decode(&value)
+	return value, err
+}
+
+// deepCopy returns a copy of a generic value that shares no objects or arrays
+// with the original.
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for key, child := range v {
+			c[key] = deepCopy(child)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, child := range v {
+			c[i] = deepCopy(child)
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// equal reports whether two generic values are equal, as defined by the
+// "test" operation. Numbers are equal if their numeric values are equal.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, errA := a.Float64()
+		y, errB := b.Float64()
+		return errA == nil && errB == nil && x == y
+
+	default:
+		return a == b
+	}
+}
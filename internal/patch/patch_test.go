@@ -0,0 +1,154 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+// normalize re-encodes a JSON document, so that documents can be compared
+// regardless of formatting and member order.
+func normalize(t *testing.T, doc string) string {
+	t.Helper()
+
+	var value any
+	err := json.Unmarshal([]byte(doc), &value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	js, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(js)
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"Replace member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"Add member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"Remove member", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"Replace array", `{"a":["b"]}`, `{"a":["c","d"]}`, `{"a":["c","d"]}`},
+		{"Nested", `{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{"Non-object patch", `{"a":"b"}`, `["c"]`, `["c"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Merge([]byte(tt.doc), []byte(tt.patch))
+			assert.IsNil(t, err)
+			assert.Equal(t, normalize(t, string(got)), normalize(t, tt.want))
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "Add member",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz","value":"qux"}]`,
+			want:  `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			name:  "Add array element",
+			doc:   `{"foo":["bar","baz"]}`,
+			patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			want:  `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:  "Append array element",
+			doc:   `{"foo":["bar"]}`,
+			patch: `[{"op":"add","path":"/foo/-","value":"baz"}]`,
+			want:  `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:  "Remove array element",
+			doc:   `{"foo":["bar","qux","baz"]}`,
+			patch: `[{"op":"remove","path":"/foo/1"}]`,
+			want:  `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:  "Replace member",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			want:  `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:  "Move member",
+			doc:   `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			want:  `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:  "Copy member",
+			doc:   `{"foo":["a"]}`,
+			patch: `[{"op":"copy","from":"/foo","path":"/bar"}]`,
+			want:  `{"foo":["a"],"bar":["a"]}`,
+		},
+		{
+			name:  "Escaped pointer",
+			doc:   `{"a/b":1,"m~n":2}`,
+			patch: `[{"op":"remove","path":"/a~1b"},{"op":"remove","path":"/m~0n"}]`,
+			want:  `{}`,
+		},
+		{
+			name:  "Test passes",
+			doc:   `{"year":1999}`,
+			patch: `[{"op":"test","path":"/year","value":1999.0}]`,
+			want:  `{"year":1999}`,
+		},
+		{
+			name:    "Test fails",
+			doc:     `{"year":1999}`,
+			patch:   `[{"op":"test","path":"/year","value":2000}]`,
+			wantErr: ErrTestFailed,
+		},
+		{
+			name:    "Missing path",
+			doc:     `{"foo":"bar"}`,
+			patch:   `[{"op":"remove","path":"/baz"}]`,
+			wantErr: ErrPathNotFound,
+		},
+		{
+			name:    "Missing value",
+			doc:     `{"foo":"bar"}`,
+			patch:   `[{"op":"add","path":"/baz"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "Unknown op",
+			doc:     `{"foo":"bar"}`,
+			patch:   `[{"op":"frobnicate","path":"/foo"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+
+			if tt.wantErr != nil {
+				assert.Equal(t, errors.Is(err, tt.wantErr), true)
+				return
+			}
+
+			assert.IsNil(t, err)
+			assert.Equal(t, normalize(t, string(got)), normalize(t, tt.want))
+		})
+	}
+}
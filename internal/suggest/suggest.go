@@ -0,0 +1,122 @@
+// Package suggest provides an in-memory prefix index of titles, for serving
+// type-ahead suggestions without a database round trip.
+package suggest
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// An Entry is a title, and the ID of the record it belongs to.
+type Entry struct {
+	ID    int64
+	Title string
+}
+
+// node is a node of the trie. Children are kept sorted by key, so that a
+// depth-first walk visits titles in alphabetical order.
+type node struct {
+	key      rune
+	children []*node
+	entries  []Entry
+}
+
+// child returns the child of the node with the key, creating it if create is
+// true. If the child doesn't exist and create is false, nil is returned.
+func (n *node) child(key rune, create bool) *node {
+	i := sort.Search(len(n.children), func(i int) bool { return n.children[i].key >= key })
+	if i < len(n.children) && n.children[i].key == key {
+		return n.children[i]
+	}
+	if !create {
+		return nil
+	}
+
+	c := &node{key: key}
+	n.children = append(n.children, nil)
+	copy(n.children[i+1:], n.children[i:])
+	n.children[i] = c
+	return c
+}
+
+// collect appends the entries of the node and its descendants to dst, in
+// alphabetical order, until dst holds limit entries.
+func (n *node) collect(dst []Entry, limit int) []Entry {
+	for _, e := range n.entries {
+		if len(dst) >= limit {
+			return dst
+		}
+		dst = append(dst, e)
+	}
+	for _, c := range n.children {
+		if len(dst) >= limit {
+			return dst
+		}
+		dst = c.collect(dst, limit)
+	}
+	return dst
+}
+
+// Trie is a prefix index of titles. Titles are matched case-insensitively.
+// A Trie is safe for concurrent use, and the zero value is an empty index.
+type Trie struct {
+	mu   sync.RWMutex
+	root *node
+	size int
+}
+
+// normalize returns the key that a title is indexed under.
+func normalize(title string) string {
+	return strings.ToLower(strings.TrimSpace(title))
+}
+
+// Load replaces the contents of the trie with the entries. The new index is
+// built before the old one is swapped out, so searches are never blocked for
+// longer than the swap.
+func (t *Trie) Load(entries []Entry) {
+	root := &node{}
+	for _, e := range entries {
+		n := root
+		for _, r := range normalize(e.Title) {
+			n = n.child(r, true)
+		}
+		n.entries = append(n.entries, e)
+	}
+
+	t.mu.Lock()
+	t.root = root
+	t.size = len(entries)
+	t.mu.Unlock()
+}
+
+// Len returns the number of entries in the trie.
+func (t *Trie) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.size
+}
+
+// Search returns up to limit entries whose titles begin with the prefix, in
+// alphabetical order of their titles. Entries with the same title are
+// returned in the order they were loaded.
+func (t *Trie) Search(prefix string, limit int) []Entry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	results := []Entry{}
+
+	n := t.root
+	if n == nil || limit <= 0 {
+		return results
+	}
+
+	for _, r := range normalize(prefix) {
+		n = n.child(r, false)
+		if n == nil {
+			return results
+		}
+	}
+
+	return n.collect(results, limit)
+}
@@ -0,0 +1,61 @@
+package suggest
+
+import (
+	"testing"
+
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+func TestTrieSearch(t *testing.T) {
+	var trie Trie
+	trie.Load([]Entry{
+		{ID: 1, Title: "The Matrix"},
+		{ID: 2, Title: "The Breakfast Club"},
+		{ID: 3, Title: "Moana"},
+		{ID: 4, Title: "the matrix"},
+		{ID: 5, Title: "The Matrix Reloaded"},
+		{ID: 6, Title: "Black Panther"},
+	})
+
+	tests := []struct {
+		name   string
+		prefix string
+		limit  int
+		want   []int64
+	}{
+		{"Single match", "moa", 10, []int64{3}},
+		{"Alphabetical order", "the", 10, []int64{2, 1, 4, 5}},
+		{"Case insensitive", "THE MAT", 10, []int64{1, 4, 5}},
+		{"Limit", "the", 2, []int64{2, 1}},
+		{"No match", "star", 10, []int64{}},
+		{"Zero limit", "the", 0, []int64{}},
+		{"Empty prefix", "", 3, []int64{6, 3, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := trie.Search(tt.prefix, tt.limit)
+
+			assert.Equal(t, len(got), len(tt.want))
+			for i := range got {
+				if i < len(tt.want) {
+					assert.Equal(t, got[i].ID, tt.want[i])
+				}
+			}
+		})
+	}
+
+	assert.Equal(t, trie.Len(), 6)
+}
+
+func TestTrieLoadReplaces(t *testing.T) {
+	var trie Trie
+	assert.Equal(t, len(trie.Search("a", 10)), 0)
+
+	trie.Load([]Entry{{ID: 1, Title: "Alien"}})
+	trie.Load([]Entry{{ID: 2, Title: "Aliens"}})
+
+	got := trie.Search("alien", 10)
+	assert.Equal(t, len(got), 1)
+	assert.Equal(t, got[0].ID, int64(2))
+}
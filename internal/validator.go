@@ -1,23 +1,60 @@
 package validator
 
 import (
+	"fmt"
 	"regexp"
 	"slices"
+	"strings"
 )
 
 // EmailRX is a regex pattern matching a valid email, recommended by W3C.
 // https://html.spec.whatwg.org/multipage/input.html#valid-e-mail-address
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+// Machine-readable error codes. Clients can rely on the code of an error,
+// while its message is meant for people, and may change.
+const (
+	CodeRequired      = "required"       // The value is missing or empty.
+	CodeTooShort      = "too_short"      // The value is shorter than "min".
+	CodeTooLong       = "too_long"       // The value is longer than "max".
+	CodeOutOfRange    = "out_of_range"   // The value is less than "min", or greater than "max".
+	CodeNotPermitted  = "not_permitted"  // The value isn't one of "permitted", or isn't allowed with the request's other values.
+	CodeDuplicate     = "duplicate"      // The value appears more than once.
+	CodeInvalidType   = "invalid_type"   // The value has the wrong type, such as text for an integer.
+	CodeInvalidFormat = "invalid_format" // The value doesn't match the expected format, such as a country code.
+	CodeNotFound      = "not_found"      // The value doesn't refer to an existing record.
+	CodeConflict      = "conflict"       // The value conflicts with an existing record.
+	CodeInvalid       = "invalid"        // Any other error.
+)
+
+// FieldError is a single validation error. Params holds the values that the
+// error's code depends on, such as the maximum length of a too_long error.
+type FieldError struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Params  map[string]any `json:"params,omitempty"`
+}
+
 // Validator is a struct for validating JSON responses. It contains several
-// validation methods and an Error map to store error messages.
+// validation methods, and records every error for each field in Details.
+//
+// Errors is the compatibility view of Details, with only the first message
+// for each top-level field. For example, an error in "genres[2]" is recorded
+// under "genres".
 type Validator struct {
-	Errors map[string]string
+	Errors  map[string]string
+	Details map[string][]FieldError
+
+	// paths are the keys of Details, in the order they were added.
+	paths []string
 }
 
-// New returns a Validator instance with an empty Errors map.
+// New returns a Validator instance with empty Errors and Details maps.
 func New() *Validator {
-	return &Validator{Errors: make(map[string]string)}
+	return &Validator{
+		Errors:  make(map[string]string),
+		Details: make(map[string][]FieldError),
+	}
 }
 
 // Validator.Valid returns true if the validator's Errors map is empty.
@@ -25,21 +62,104 @@ func (v *Validator) Valid() bool {
 	return len(v.Errors) == 0
 }
 
-// Validator.AddError adds an error to the validator's Errors map (as long as
-// if it doesn't already exist.
+// Validator.AddError adds an error with the code "invalid" to the validator.
+// Use AddErrorCode to give the error a more specific code.
 func (v *Validator) AddError(key, message string) {
-	if _, exists := v.Errors[key]; !exists {
-		v.Errors[key] = message
+	v.AddErrorCode(key, CodeInvalid, message)
+}
+
+// Validator.AddErrorCode adds an error to the field at the path key. The
+// params are alternating names and values, as in log/slog.
+//
+// Once a field has a "required" error, further errors for it are ignored,
+// since they would only follow from the missing value.
+func (v *Validator) AddErrorCode(key, code, message string, params ...any) {
+	for _, e := range v.Details[key] {
+		if e.Code == CodeRequired {
+			return
+		}
+	}
+
+	e := FieldError{Code: code, Message: message}
+	if len(params) > 0 {
+		e.Params = make(map[string]any, len(params)/2)
+		for i := 0; i+1 < len(params); i += 2 {
+			e.Params[fmt.Sprint(params[i])] = params[i+1]
+		}
+	}
+	if _, exists := v.Details[key]; !exists {
+		v.paths = append(v.paths, key)
+	}
+	v.Details[key] = append(v.Details[key], e)
+
+	field := Field(key)
+	if _, exists := v.Errors[field]; !exists {
+		v.Errors[field] = message
 	}
 }
 
-// Validator.Check adds an error to Validator.Errors if ok is false.
+// Validator.Check adds an error to the validator if ok is false. The error
+// has the code "invalid". Use CheckCode to give it a more specific code.
 func (v *Validator) Check(ok bool, key, message string) {
 	if !ok {
 		v.AddError(key, message)
 	}
 }
 
+// Validator.CheckCode adds an error with a code and params to the validator
+// if ok is false. See AddErrorCode for details.
+func (v *Validator) CheckCode(ok bool, key, code, message string, params ...any) {
+	if !ok {
+		v.AddErrorCode(key, code, message, params...)
+	}
+}
+
+// Validator.Translate replaces the message of each error with the result of
+// fn, in both Details and Errors. If fn returns an empty string, the message
+// is left as it is.
+func (v *Validator) Translate(fn func(FieldError) string) {
+	clear(v.Errors)
+	for _, path := range v.paths {
+		for i, e := range v.Details[path] {
+			if msg := fn(e); msg != "" {
+				v.Details[path][i].Message = msg
+			}
+		}
+
+		field := Field(path)
+		if _, exists := v.Errors[field]; !exists {
+			v.Errors[field] = v.Details[path][0].Message
+		}
+	}
+}
+
+// Path returns the path of a nested field, from its top-level name and the
+// indexes and names of the values it is nested in. For example,
+// Path("genres", 2) is "genres[2]", and Path("credits", 0, "role") is
+// "credits[0].role".
+func Path(field string, elems ...any) string {
+	var b strings.Builder
+	b.WriteString(field)
+	for _, elem := range elems {
+		switch elem := elem.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", elem)
+		default:
+			fmt.Fprintf(&b, ".%v", elem)
+		}
+	}
+	return b.String()
+}
+
+// Field returns the top-level field of a path. For example, Field("genres[2]")
+// is "genres".
+func Field(path string) string {
+	if i := strings.IndexAny(path, "[."); i > 0 {
+		return path[:i]
+	}
+	return path
+}
+
 // Returns true if the string matches the regex.
 func Matches(s string, rx *regexp.Regexp) bool {
 	return rx.MatchString(s)
@@ -61,3 +181,19 @@ func Unique[T comparable](values []T) bool {
 
 	return len(values) == len(uniqueValues)
 }
+
+// Duplicates returns the indexes of the values in a slice that are equal to
+// an earlier value.
+func Duplicates[T comparable](values []T) []int {
+	var indexes []int
+	seen := make(map[T]bool, len(values))
+
+	for i, v := range values {
+		if seen[v] {
+			indexes = append(indexes, i)
+		}
+		seen[v] = true
+	}
+
+	return indexes
+}
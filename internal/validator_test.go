@@ -0,0 +1,50 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/kvnloughead/greenlight/internal/assert"
+)
+
+func TestValidator(t *testing.T) {
+	v := New()
+	v.CheckCode(false, "year", CodeRequired, "must be provided")
+	v.CheckCode(false, "year", CodeOutOfRange, "must be after 1888", "min", 1888)
+	v.CheckCode(false, "runtime", CodeOutOfRange, "must be a positive integer", "min", 1)
+	v.CheckCode(true, "runtime", CodeRequired, "must be provided")
+	v.Check(false, "runtime", "must be a number")
+	v.AddErrorCode(Path("genres", 1), CodeDuplicate, "must not contain duplicate values")
+	v.AddErrorCode(Path("genres", 3), CodeDuplicate, "must not contain duplicate values")
+
+	assert.Equal(t, v.Valid(), false)
+	assert.Equal(t, len(v.Errors), 3)
+	assert.Equal(t, v.Errors["year"], "must be provided")
+	assert.Equal(t, v.Errors["runtime"], "must be a positive integer")
+	assert.Equal(t, v.Errors["genres"], "must not contain duplicate values")
+
+	assert.Equal(t, len(v.Details["year"]), 1)
+	assert.Equal(t, len(v.Details["runtime"]), 2)
+	assert.Equal(t, v.Details["runtime"][0].Params["min"], any(1))
+	assert.Equal(t, v.Details["runtime"][1].Code, CodeInvalid)
+	assert.Equal(t, len(v.Details["genres[1]"]), 1)
+	assert.Equal(t, len(v.Details["genres[3]"]), 1)
+}
+
+func TestPath(t *testing.T) {
+	assert.Equal(t, Path("title"), "title")
+	assert.Equal(t, Path("genres", 2), "genres[2]")
+	assert.Equal(t, Path("credits", 0, "role"), "credits[0].role")
+
+	assert.Equal(t, Field("credits[0].role"), "credits")
+	assert.Equal(t, Field("title"), "title")
+}
+
+func TestDuplicates(t *testing.T) {
+	assert.Equal(t, len(Duplicates([]string{"a", "b"})), 0)
+
+	got := Duplicates([]string{"a", "b", "a", "c", "b", "a"})
+	assert.Equal(t, len(got), 3)
+	assert.Equal(t, got[0], 2)
+	assert.Equal(t, got[1], 4)
+	assert.Equal(t, got[2], 5)
+}
@@ -0,0 +1,12 @@
+--- deleted_at is NULL for live movies. Soft-deleted movies keep their row until
+--- they are purged, so they can be restored from the trash.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+
+--- A partial index on the trash keeps trash listings and scheduled purges from
+--- scanning the live catalogue.
+CREATE INDEX IF NOT EXISTS movies_deleted_at_idx
+  ON movies (deleted_at)
+  WHERE deleted_at IS NOT NULL;
+
+INSERT INTO permissions (code)
+VALUES ('movies:purge');
@@ -0,0 +1,9 @@
+--- Indexes supporting the year and runtime range filters on the movie list.
+--- Soft-deleted movies are never listed, so they are left out of the indexes.
+CREATE INDEX IF NOT EXISTS movies_year_idx
+  ON movies (year)
+  WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS movies_runtime_idx
+  ON movies (runtime)
+  WHERE deleted_at IS NULL;
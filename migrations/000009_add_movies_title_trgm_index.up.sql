@@ -0,0 +1,6 @@
+--- Trigram index supporting fuzzy and prefix searches on movie titles. The
+--- pg_trgm extension provides the similarity functions and operators.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS movies_title_trgm_idx
+  ON movies USING GIN (title gin_trgm_ops);
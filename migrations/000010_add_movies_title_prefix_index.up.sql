@@ -0,0 +1,6 @@
+--- Index supporting case-insensitive title prefix searches, as used by the
+--- autocomplete endpoint. The text_pattern_ops operator class allows LIKE
+--- 'prefix%' queries to use the index regardless of the database's collation.
+CREATE INDEX IF NOT EXISTS movies_title_prefix_idx
+  ON movies (lower(title) text_pattern_ops)
+  WHERE deleted_at IS NULL;
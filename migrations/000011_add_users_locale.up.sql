@@ -0,0 +1,3 @@
+--- The user's preferred locale, which emails are sent in. Existing users keep
+--- receiving English emails.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale text NOT NULL DEFAULT 'en';
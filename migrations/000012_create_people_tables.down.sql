@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code IN ('people:read', 'people:write');
+DROP TABLE IF EXISTS movie_credits;
+DROP TABLE IF EXISTS people;
@@ -0,0 +1,41 @@
+--- The people table stores the directors, cast, and crew of movies.
+CREATE TABLE IF NOT EXISTS people (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  name text NOT NULL,
+  birth_year integer,
+  version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS people_name_idx ON people (lower(name) text_pattern_ops);
+
+--- The movie_credits table is a join table linking people to the movies they
+--- worked on. A person can have several credits on a movie, such as director
+--- and writer, or two characters. character is empty for roles other than
+--- actor. Credits are deleted along with their movie or person.
+CREATE TABLE IF NOT EXISTS movie_credits (
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  person_id bigint NOT NULL REFERENCES people ON DELETE CASCADE,
+  role text NOT NULL CHECK (role IN ('director', 'actor', 'writer')),
+  character text NOT NULL DEFAULT '',
+  billing_order integer NOT NULL DEFAULT 0 CHECK (billing_order >= 0),
+  PRIMARY KEY (movie_id, person_id, role, character)
+);
+
+--- Supports filtering movies by person, and listing a person's filmography.
+CREATE INDEX IF NOT EXISTS movie_credits_person_id_idx ON movie_credits (person_id);
+
+INSERT INTO permissions (code)
+VALUES
+  ('people:read'),
+  ('people:write');
+
+--- Every existing user who can read movies can also read people. New users
+--- get the permission when they register.
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users_permissions.user_id, people_read.id
+FROM users_permissions
+JOIN permissions movies_read ON movies_read.id = users_permissions.permission_id AND movies_read.code = 'movies:read'
+CROSS JOIN permissions people_read
+WHERE people_read.code = 'people:read'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,14 @@
+--- Restore the display names of genres to movies, since the original
+--- spellings aren't kept.
+UPDATE movies SET
+  genres = ARRAY(
+    SELECT COALESCE(genres.name, t.slug)
+    FROM unnest(movies.genres) WITH ORDINALITY AS t(slug, n)
+    LEFT JOIN genres ON genres.slug = t.slug
+    ORDER BY t.n
+  ),
+  version = version + 1;
+
+DELETE FROM permissions WHERE code = 'genres:write';
+
+DROP TABLE IF EXISTS genres;
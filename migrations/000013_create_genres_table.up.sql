@@ -0,0 +1,44 @@
+--- The genres table is the taxonomy of genres that movies can have. Movies
+--- refer to genres by slug, such as 'science-fiction'. name is the display
+--- name, and aliases are other lowercase spellings that map to the genre,
+--- such as 'sci-fi'.
+CREATE TABLE IF NOT EXISTS genres (
+  slug text PRIMARY KEY CHECK (slug ~ '^[a-z0-9]+(-[a-z0-9]+)*$'),
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  name text NOT NULL,
+  aliases text[] NOT NULL DEFAULT '{}',
+  version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS genres_aliases_idx ON genres USING GIN (aliases);
+
+--- Seed the taxonomy from the genres that movies already have. Spellings with
+--- the same slug become one genre, named after its most common spelling, with
+--- the other spellings as aliases.
+WITH existing AS (
+  SELECT genre, trim(BOTH '-' FROM regexp_replace(lower(genre), '[^a-z0-9]+', '-', 'g')) AS slug
+  FROM movies, unnest(genres) AS genre
+)
+INSERT INTO genres (slug, name, aliases)
+SELECT slug, mode() WITHIN GROUP (ORDER BY genre), array_remove(array_agg(DISTINCT lower(genre)), slug)
+FROM existing
+WHERE slug <> ''
+GROUP BY slug;
+
+--- Replace the genres of movies with their slugs, keeping the first of any
+--- that are now duplicates.
+UPDATE movies SET
+  genres = ARRAY(
+    SELECT slug
+    FROM (
+      SELECT trim(BOTH '-' FROM regexp_replace(lower(genre), '[^a-z0-9]+', '-', 'g')) AS slug, n
+      FROM unnest(genres) WITH ORDINALITY AS t(genre, n)
+    ) AS slugs
+    WHERE slug <> ''
+    GROUP BY slug
+    ORDER BY min(n)
+  ),
+  version = version + 1;
+
+INSERT INTO permissions (code)
+VALUES ('genres:write');
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS rating_stats;
+
+DROP TABLE IF EXISTS ratings;
+
+ALTER TABLE movies
+  DROP COLUMN IF EXISTS rating_sum,
+  DROP COLUMN IF EXISTS rating_count;
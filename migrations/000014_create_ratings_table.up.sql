@@ -0,0 +1,27 @@
+--- The rating aggregates of each movie are maintained incrementally, as
+--- ratings are set and removed, so that reading them is cheap.
+ALTER TABLE movies
+  ADD COLUMN IF NOT EXISTS rating_count integer NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS rating_sum bigint NOT NULL DEFAULT 0;
+
+--- The ratings table stores one rating from 1 to 10 per user per movie.
+CREATE TABLE IF NOT EXISTS ratings (
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  rating smallint NOT NULL CHECK (rating BETWEEN 1 AND 10),
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS ratings_movie_id_idx ON ratings (movie_id);
+
+--- The rating_stats table has a single row with the aggregates of every
+--- rating, from which the mean rating used by the Bayesian score is computed.
+CREATE TABLE IF NOT EXISTS rating_stats (
+  id boolean PRIMARY KEY DEFAULT true CHECK (id),
+  rating_count bigint NOT NULL DEFAULT 0,
+  rating_sum bigint NOT NULL DEFAULT 0
+);
+
+INSERT INTO rating_stats DEFAULT VALUES ON CONFLICT DO NOTHING;
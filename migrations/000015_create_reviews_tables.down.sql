@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE code = 'reviews:moderate';
+
+DROP TABLE IF EXISTS review_reports;
+
+DROP TABLE IF EXISTS reviews;
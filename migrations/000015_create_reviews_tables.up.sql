@@ -0,0 +1,36 @@
+--- The reviews table stores users' written reviews of movies. Hidden reviews
+--- have a hidden_at time, and are only shown to moderators. report_count is
+--- the number of reports that haven't been resolved by a moderator.
+CREATE TABLE IF NOT EXISTS reviews (
+  id bigserial PRIMARY KEY,
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  body text NOT NULL,
+  spoiler boolean NOT NULL DEFAULT false,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  hidden_at timestamp(0) with time zone,
+  report_count integer NOT NULL DEFAULT 0,
+  version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS reviews_movie_id_idx ON reviews (movie_id);
+
+--- A partial index on reported reviews keeps the moderation queue from
+--- scanning every review.
+CREATE INDEX IF NOT EXISTS reviews_report_count_idx
+  ON reviews (report_count)
+  WHERE report_count > 0;
+
+--- The review_reports table stores the unresolved reports of reviews, one per
+--- user per review. Reports are deleted when a moderator resolves them.
+CREATE TABLE IF NOT EXISTS review_reports (
+  review_id bigint NOT NULL REFERENCES reviews ON DELETE CASCADE,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  reason text NOT NULL DEFAULT '',
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (review_id, user_id)
+);
+
+INSERT INTO permissions (code)
+VALUES ('reviews:moderate');
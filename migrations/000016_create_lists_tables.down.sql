@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS list_entries;
+
+DROP TABLE IF EXISTS lists;
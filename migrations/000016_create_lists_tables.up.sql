@@ -0,0 +1,35 @@
+--- The lists table stores users' lists of movies. Private lists are only
+--- visible to their owners, unlisted lists are visible to anyone with their
+--- ID, and public lists are also listed on their owners' profiles. Each user
+--- has one watchlist, which can't be deleted.
+CREATE TABLE IF NOT EXISTS lists (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  name text NOT NULL,
+  privacy text NOT NULL DEFAULT 'private' CHECK (privacy IN ('private', 'unlisted', 'public')),
+  watchlist boolean NOT NULL DEFAULT false,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS lists_user_id_idx ON lists (user_id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS lists_watchlist_idx ON lists (user_id) WHERE watchlist;
+
+--- The list_entries table stores the movies in each list, in the order of
+--- their positions, with an optional note. A movie can only be in a list once.
+CREATE TABLE IF NOT EXISTS list_entries (
+  list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  position integer NOT NULL,
+  note text NOT NULL DEFAULT '',
+  added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (list_id, movie_id)
+);
+
+--- Every existing user gets a watchlist. New users get theirs when they
+--- register.
+INSERT INTO lists (user_id, name, watchlist)
+SELECT id, 'Watchlist', true FROM users
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,16 @@
+--- The diary_entries table stores each time a user watched a movie. A movie
+--- can be logged more than once, and rewatches are flagged by the user. The
+--- optional rating is the user's rating of that viewing, and is separate from
+--- their rating of the movie in the ratings table.
+CREATE TABLE IF NOT EXISTS diary_entries (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  watched_on date NOT NULL,
+  rewatch boolean NOT NULL DEFAULT false,
+  rating smallint CHECK (rating BETWEEN 1 AND 10),
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS diary_entries_user_id_watched_on_idx ON diary_entries (user_id, watched_on);
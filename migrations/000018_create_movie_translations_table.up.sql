@@ -0,0 +1,21 @@
+--- The movie_translations table stores the alternate titles and synopses of
+--- movies in other languages. Language is an ISO 639 code, such as "es", and
+--- region is an optional ISO 3166-1 code, such as "MX", for titles that differ
+--- between countries that share a language. It is empty if the translation
+--- applies to every region.
+CREATE TABLE IF NOT EXISTS movie_translations (
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  language text NOT NULL CHECK (language ~ '^[a-z]{2,3}$'),
+  region text NOT NULL DEFAULT '' CHECK (region ~ '^([A-Z]{2})?$'),
+  title text NOT NULL,
+  synopsis text NOT NULL DEFAULT '',
+  PRIMARY KEY (movie_id, language, region)
+);
+
+--- Alternate titles are searched like original titles. The 'simple' text
+--- search configuration is used, since the titles aren't in English.
+CREATE INDEX IF NOT EXISTS movie_translations_title_idx
+  ON movie_translations USING GIN (to_tsvector('simple', title));
+
+CREATE INDEX IF NOT EXISTS movie_translations_title_trgm_idx
+  ON movie_translations USING GIN (title gin_trgm_ops);
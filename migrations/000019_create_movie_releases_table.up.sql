@@ -0,0 +1,17 @@
+--- The movie_releases table stores the release dates of movies in each
+--- country, by type of release, with the age certification they were given
+--- there. Country is an ISO 3166-1 code, such as "US". Certification is empty
+--- if the release wasn't certified.
+CREATE TABLE IF NOT EXISTS movie_releases (
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  country text NOT NULL CHECK (country ~ '^[A-Z]{2}$'),
+  release_type text NOT NULL CHECK (release_type IN ('theatrical', 'digital', 'festival')),
+  release_date date NOT NULL,
+  certification text NOT NULL DEFAULT '',
+  PRIMARY KEY (movie_id, country, release_type)
+);
+
+--- Supports the released_in, released_after, and released_before filters of
+--- movie lists.
+CREATE INDEX IF NOT EXISTS movie_releases_country_release_date_idx
+  ON movie_releases (country, release_date);
@@ -0,0 +1,3 @@
+UPDATE rating_stats SET
+  rating_count = (SELECT COALESCE(sum(rating_count), 0) FROM movies),
+  rating_sum = (SELECT COALESCE(sum(rating_sum), 0) FROM movies);
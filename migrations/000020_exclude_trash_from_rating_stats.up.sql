@@ -0,0 +1,6 @@
+--- Movies in the trash no longer count towards the mean rating. Their ratings
+--- are removed from rating_stats when they are trashed, and added back when
+--- they are restored, so the stats are recomputed without them.
+UPDATE rating_stats SET
+  rating_count = (SELECT COALESCE(sum(rating_count), 0) FROM movies WHERE deleted_at IS NULL),
+  rating_sum = (SELECT COALESCE(sum(rating_sum), 0) FROM movies WHERE deleted_at IS NULL);